@@ -2,9 +2,12 @@ package main
 
 import (
 	"booking/internal/models"
+	"booking/internal/schedule"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"net/http"
 	"strconv"
+	"time"
 )
 
 func (app *application) createComputer(c *gin.Context) {
@@ -15,6 +18,10 @@ func (app *application) createComputer(c *gin.Context) {
 		return
 	}
 
+	if !app.validateRoom(c, &computer) {
+		return
+	}
+
 	if err := app.db.Create(&computer).Error; err != nil {
 		app.logger.Error("Failed to create computer: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create computer"})
@@ -26,7 +33,7 @@ func (app *application) createComputer(c *gin.Context) {
 
 func (app *application) getComputers(c *gin.Context) {
 	var computers []models.Computer
-	query := app.db
+	query := scopeComputers(c, app.db, app.db)
 
 	search := c.Query("search")
 	if search != "" {
@@ -84,6 +91,10 @@ func (app *application) updateComputer(c *gin.Context) {
 		return
 	}
 
+	if !app.validateRoom(c, &computer) {
+		return
+	}
+
 	if err := app.db.Save(&computer).Error; err != nil {
 		app.logger.Error("Failed to update computer: " + err.Error())
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update computer"})
@@ -105,31 +116,103 @@ func (app *application) deleteComputer(c *gin.Context) {
 }
 
 func (app *application) createBooking(c *gin.Context) {
-	var booking models.Booking
-	if err := c.BindJSON(&booking); err != nil {
+	var request struct {
+		ComputerID uint      `json:"computer_id"`
+		UserID     string    `json:"user_id"`
+		Email      string    `json:"email"`
+		StartTime  time.Time `json:"start_time"`
+		EndTime    time.Time `json:"end_time"`
+		Status     string    `json:"status"`
+	}
+	if err := c.BindJSON(&request); err != nil {
 		app.logger.Error("Invalid request format: " + err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
 
-	if err := app.db.Create(&booking).Error; err != nil {
-		app.logger.Error("Failed to create booking: " + err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create booking"})
+	booking := models.Booking{
+		ComputerID: request.ComputerID,
+		UserID:     request.UserID,
+		Email:      request.Email,
+		StartTime:  request.StartTime,
+		EndTime:    request.EndTime,
+		Status:     request.Status,
+	}
+	switch booking.Status {
+	case "":
+		booking.Status = models.BookingConfirmed
+	case models.BookingPending, models.BookingConfirmed:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New bookings must be pending or confirmed"})
+		return
+	}
+
+	computer, ok := app.checkAdminBooking(c, &booking)
+	if !ok {
+		return
+	}
+
+	err := app.bookingTx([]uint{booking.ComputerID}, func(tx *gorm.DB) error {
+		return reserve(tx, &booking)
+	})
+	if err != nil {
+		app.bookingErrorResponse(c, err, "Failed to create booking")
 		return
 	}
 
+	if err := refreshComputerStatus(app.db, computer); err != nil {
+		app.logger.Error("Failed to update computer status: " + err.Error())
+	}
+
 	c.JSON(http.StatusCreated, booking)
 }
 
+// checkAdminBooking loads the computer of a booking made or changed by staff
+// and checks that it is in service and neither under maintenance nor closed
+// during the booking. Staff are not held to the booking policy. It writes the
+// error response itself.
+func (app *application) checkAdminBooking(c *gin.Context, booking *models.Booking) (*models.Computer, bool) {
+	var computer models.Computer
+	if err := app.db.First(&computer, booking.ComputerID).Error; err != nil {
+		app.logger.Error("Computer not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Computer not found"})
+		return nil, false
+	}
+
+	if !isBookable(&computer) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Computer is out of service"})
+		return nil, false
+	}
+
+	if !booking.EndTime.After(booking.StartTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidWindow.Error()})
+		return nil, false
+	}
+
+	windows := []schedule.Interval{{Start: booking.StartTime, End: booking.EndTime}}
+	if !app.checkMaintenance(c, computer.ID, windows) || !app.checkOpeningHours(c, computer.ID, windows) {
+		return nil, false
+	}
+	return &computer, true
+}
+
 func (app *application) getBookings(c *gin.Context) {
 	var bookings []models.Booking
 	query := app.db
+	if scope := scopedComputerIDs(c, app.db); scope != nil {
+		query = query.Where("computer_id IN (?)", scope)
+	}
 
 	search := c.Query("search")
 	if search != "" {
 		query = query.Where("description LIKE ?", "%"+search+"%")
 	}
 
+	status := c.Query("status")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
 	sort := c.Query("sort")
 	if sort != "" {
 		query = query.Order(sort)
@@ -175,28 +258,78 @@ func (app *application) updateBooking(c *gin.Context) {
 		return
 	}
 
+	status, computerID := booking.Status, booking.ComputerID
 	if err := c.BindJSON(&booking); err != nil {
 		app.logger.Error("Invalid request format: " + err.Error())
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
 		return
 	}
+	// Status only changes through the transitions endpoint.
+	booking.Status = status
+
+	if !booking.IsActive() {
+		if !booking.EndTime.After(booking.StartTime) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidWindow.Error()})
+			return
+		}
+	} else if _, ok := app.checkAdminBooking(c, &booking); !ok {
+		return
+	}
 
-	if err := app.db.Save(&booking).Error; err != nil {
-		app.logger.Error("Failed to update booking: " + err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking"})
+	// Active bookings are priced afresh and the owner charged or refunded the
+	// difference; inactive ones were settled when they ended.
+	err := app.bookingTx([]uint{computerID, booking.ComputerID}, func(tx *gorm.DB) error {
+		if !booking.IsActive() {
+			return tx.Save(&booking).Error
+		}
+
+		conflict, err := findConflict(tx, booking.ComputerID, booking.StartTime, booking.EndTime, booking.ID)
+		if err != nil {
+			return err
+		}
+		if conflict != nil {
+			return &conflictError{booking: conflict}
+		}
+		if err := priceBooking(tx, &booking); err != nil {
+			return err
+		}
+		if err := tx.Save(&booking).Error; err != nil {
+			return err
+		}
+		return chargeBooking(tx, &booking)
+	})
+	if err != nil {
+		app.bookingErrorResponse(c, err, "Failed to update booking")
 		return
 	}
 
+	for _, id := range []uint{computerID, booking.ComputerID} {
+		var computer models.Computer
+		if err := app.db.First(&computer, id).Error; err != nil {
+			continue
+		}
+		if err := refreshComputerStatus(app.db, &computer); err != nil {
+			app.logger.Error("Failed to update computer status: " + err.Error())
+		}
+	}
+
 	c.JSON(http.StatusOK, booking)
 }
 
+// deleteBooking cancels the booking; bookings are kept for their history.
 func (app *application) deleteBooking(c *gin.Context) {
 	id := c.Param("id")
-	if err := app.db.Delete(&models.Booking{}, id).Error; err != nil {
-		app.logger.Error("Failed to delete booking: " + err.Error())
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete booking"})
+	var booking models.Booking
+	if err := app.db.First(&booking, id).Error; err != nil {
+		app.logger.Error("Booking not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+
+	if err := app.transitionBooking(app.db, &booking, models.BookingCancelled, c.GetString("userID"), c.Query("reason")); err != nil {
+		app.transitionResponse(c, err)
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Booking deleted successfully"})
+	c.JSON(http.StatusOK, gin.H{"message": "Booking cancelled successfully"})
 }
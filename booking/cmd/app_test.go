@@ -1,11 +1,19 @@
 package main
 
 import (
+	"booking/internal/config"
 	db2 "booking/internal/db"
 	"booking/internal/jwt"
 	"booking/internal/logger"
 	"booking/internal/models"
+	"booking/internal/payments"
+	"booking/internal/policy"
+	"booking/internal/pricing"
+	"booking/internal/publisher"
+	"booking/internal/scheduler"
+	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -13,81 +21,2237 @@ import (
 	logger2 "gorm.io/gorm/logger"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// testPublisher records published messages instead of sending them.
+type testPublisher struct {
+	mu       sync.Mutex
+	messages []publisher.Message
+}
+
+func (p *testPublisher) PublishMessage(msg publisher.Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func (p *testPublisher) sent(msgType string) []publisher.Message {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var matching []publisher.Message
+	for _, msg := range p.messages {
+		if msg.Type == msgType {
+			matching = append(matching, msg)
+		}
+	}
+	return matching
+}
+
 func setupTestApp() (*application, error) {
+	return setupTestAppWithDSN(":memory:")
+}
+
+func setupTestAppWithDSN(dsn string) (*application, error) {
 	gin.SetMode(gin.TestMode)
 	logger := logger.NewLogger("../logs/test.log")
 
-	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
-		Logger: logger2.Default.LogMode(logger2.Silent),
-	})
-	if err != nil {
-		return nil, err
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
+		Logger: logger2.Default.LogMode(logger2.Silent),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.AutoMigrate(
+		&models.Location{},
+		&models.Room{},
+		&models.OpeningHours{},
+		&models.Closure{},
+		&models.FloorPlan{},
+		&models.Seat{},
+		&models.Computer{},
+		&models.MaintenanceWindow{},
+		&models.Booking{},
+		&models.BookingSeries{},
+		&models.BookingGroup{},
+		&models.WaitlistEntry{},
+		&models.Issue{},
+		&models.IssueComment{},
+		&models.BookingTransition{},
+		&models.BookingReminder{},
+		&models.Tariff{},
+		&models.TariffPeak{},
+		&models.TariffClass{},
+		&models.Wallet{},
+		&models.LedgerEntry{},
+		&models.Payment{},
+		&models.IdempotencyKey{},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db2.EnsureBookingConstraints(db); err != nil {
+		return nil, err
+	}
+
+	jwtUtil := jwt.NewJWTUtil("test-secret")
+
+	app := &application{
+		router: gin.New(),
+		db:     db,
+		logger: logger,
+		config: &config.Config{
+			WaitlistClaimTTL:  15 * time.Minute,
+			CheckInEarly:      15 * time.Minute,
+			NoShowGracePeriod: 15 * time.Minute,
+			ReminderOffsets:   []time.Duration{24 * time.Hour, 15 * time.Minute},
+			IdempotencyTTL:    time.Hour,
+			HoldTTL:           10 * time.Minute,
+
+			HighSeverityMaintenance: true,
+
+			Policy: policy.Default(),
+
+			PaymentReconcileAfter: 10 * time.Minute,
+		},
+		jwtUtil:   jwtUtil,
+		rabbit:    &testPublisher{},
+		payments:  payments.NewFake("test-secret", 0, ""),
+		scheduler: scheduler.New(logger),
+	}
+
+	app.initializeRoutes()
+
+	return app, nil
+}
+
+// allowBookingAhead lifts the booking horizon of the default policy for tests
+// that book on fixed dates years ahead.
+func allowBookingAhead(app *application) {
+	app.config.Policy.MaxAdvance = policy.None
+}
+
+func TestBookComputer(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/book", strings.NewReader(`{"computer_id": 1, "start_time": "2030-06-01T10:00:00Z", "end_time": "2030-06-01T12:00:00Z"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	app.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Computer booked successfully")
+}
+
+func TestBookComputerConflict(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+
+	book := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/book", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := book(`{"computer_id": 1, "start_time": "2030-06-01T10:00:00Z", "end_time": "2030-06-01T12:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = book(`{"computer_id": 1, "start_time": "2030-06-01T11:00:00Z", "end_time": "2030-06-01T13:00:00Z"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "2030-06-01T10:00:00Z")
+
+	w = book(`{"computer_id": 1, "start_time": "2030-06-01T12:00:00Z", "end_time": "2030-06-01T13:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = book(`{"computer_id": 1, "start_time": "2030-06-02T12:00:00Z", "end_time": "2030-06-02T11:00:00Z"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var stored models.Computer
+	app.db.First(&stored, computer.ID)
+	assert.Equal(t, "available", stored.Status)
+}
+
+func TestConcurrentBookingsHaveOneWinnerPerSlot(t *testing.T) {
+	// A file database lets requests use separate connections. Immediate
+	// transactions take SQLite's write lock up front, which is its equivalent
+	// of the row lock taken on Postgres.
+	dsn := "file:" + filepath.Join(t.TempDir(), "booking.db") + "?_txlock=immediate&_busy_timeout=30000&_journal_mode=WAL"
+	app, err := setupTestAppWithDSN(dsn)
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	const slots, attempts = 4, 50
+	for i := 1; i <= slots; i++ {
+		app.db.Create(&models.Computer{Number: i, Status: "available"})
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, slots*attempts)
+	for i := 0; i < slots*attempts; i++ {
+		token, err := app.jwtUtil.GenerateToken("user"+strconv.Itoa(i), "user", "email@mail.com")
+		assert.NoError(t, err)
+
+		// Requests for the same computer race for overlapping windows.
+		body := fmt.Sprintf(`{"computer_id": %d, "start_time": "2030-06-01T10:%02d:00Z", "end_time": "2030-06-01T12:00:00Z"}`, i%slots+1, i%6*5)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest("POST", "/book", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+			req.Header.Set("Content-Type", "application/json")
+			app.router.ServeHTTP(w, req)
+			codes <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	counts := map[int]int{}
+	for code := range codes {
+		counts[code]++
+	}
+	assert.Equal(t, slots, counts[http.StatusOK])
+	assert.Equal(t, slots*(attempts-1), counts[http.StatusConflict])
+
+	for i := 1; i <= slots; i++ {
+		var count int64
+		app.db.Model(&models.Booking{}).Where("computer_id = ?", i).Count(&count)
+		assert.Equal(t, int64(1), count)
+	}
+}
+
+func TestOverlapGuard(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	first := models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)}
+	assert.NoError(t, app.db.Create(&first).Error)
+
+	// Writes that bypass the application check are still rejected.
+	second := models.Booking{UserID: "user456", ComputerID: computer.ID, StartTime: stTime.Add(time.Hour), EndTime: stTime.Add(3 * time.Hour)}
+	err = app.db.Create(&second).Error
+	assert.True(t, db2.IsOverlapError(err))
+
+	second.StartTime = stTime.Add(2 * time.Hour)
+	assert.NoError(t, app.db.Create(&second).Error)
+	assert.True(t, db2.IsOverlapError(app.db.Model(&second).Update("start_time", stTime.Add(time.Hour)).Error))
+
+	// Inactive bookings do not take part.
+	assert.NoError(t, app.db.Model(&first).Update("status", models.BookingCancelled).Error)
+	assert.NoError(t, app.db.Model(&second).Update("start_time", stTime.Add(time.Hour)).Error)
+}
+
+func TestIdempotentBooking(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	app.db.Create(&models.Computer{Number: 1, Status: "available"})
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+
+	book := func(key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/book", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	body := `{"computer_id": 1, "start_time": "2030-06-01T10:00:00Z", "end_time": "2030-06-01T12:00:00Z"}`
+	first := book("retry-1", body)
+	assert.Equal(t, http.StatusOK, first.Code)
+
+	retry := book("retry-1", body)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+
+	var count int64
+	app.db.Model(&models.Booking{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	reused := book("retry-1", `{"computer_id": 1, "start_time": "2030-06-02T10:00:00Z", "end_time": "2030-06-02T12:00:00Z"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, reused.Code)
+
+	// Once the key expires it can be used again.
+	app.db.Model(&models.IdempotencyKey{}).Where("idempotency_key = ?", "retry-1").Update("expires_at", time.Now().Add(-time.Minute))
+	fresh := book("retry-1", `{"computer_id": 1, "start_time": "2030-06-02T10:00:00Z", "end_time": "2030-06-02T12:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, fresh.Code)
+
+	assert.NoError(t, app.purgeIdempotencyKeys(time.Now().Add(2*time.Hour)))
+	app.db.Model(&models.IdempotencyKey{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestIdempotencyKeyReleasedOnFailure(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	fail := true
+	app.router.POST("/flaky", app.authMiddleware, app.idempotencyMiddleware, func(c *gin.Context) {
+		if fail {
+			panic("handler failed")
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "created"})
+	})
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	post := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/flaky", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "flaky-1")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Panics(t, func() { post() })
+	var count int64
+	app.db.Model(&models.IdempotencyKey{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	// The retry runs the handler again rather than finding the key in use.
+	fail = false
+	assert.Equal(t, http.StatusCreated, post().Code)
+	assert.Equal(t, "true", post().Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotentAdminCreateComputer(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	token, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+
+	create := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/admin/computers", strings.NewReader(`{"number": 2, "status": "available"}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "computer-2")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusCreated, create().Code)
+	assert.Equal(t, http.StatusCreated, create().Code)
+
+	var count int64
+	app.db.Model(&models.Computer{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+}
+
+func TestHolds(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	holder, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	other, err := app.jwtUtil.GenerateToken("user456", "user", "other@mail.com")
+	assert.NoError(t, err)
+
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	window := `{"computer_id": 1, "start_time": "2030-06-01T10:00:00Z", "end_time": "2030-06-01T12:00:00Z"}`
+	w := request("POST", "/holds", holder, window)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var hold models.Booking
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hold))
+	assert.Equal(t, models.BookingPending, hold.Status)
+
+	// The held window is not available to anyone else.
+	assert.Equal(t, http.StatusConflict, request("POST", "/book", other, window).Code)
+
+	holdURL := "/holds/" + strconv.Itoa(int(hold.ID))
+	assert.Equal(t, http.StatusForbidden, request("POST", holdURL+"/confirm", other, "").Code)
+	assert.Equal(t, http.StatusOK, request("POST", holdURL+"/confirm", holder, "").Code)
+
+	var confirmed models.Booking
+	app.db.First(&confirmed, hold.ID)
+	assert.Equal(t, models.BookingConfirmed, confirmed.Status)
+	assert.Nil(t, confirmed.HoldExpiresAt)
+	assert.Equal(t, http.StatusConflict, request("DELETE", holdURL, holder, "").Code)
+
+	// Unconfirmed holds are released by the sweeper.
+	w = request("POST", "/holds", holder, `{"computer_id": 1, "start_time": "2030-06-02T10:00:00Z", "end_time": "2030-06-02T12:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hold))
+
+	released, err := app.releaseExpiredHolds(time.Now())
+	assert.NoError(t, err)
+	assert.Equal(t, 0, released)
+
+	released, err = app.releaseExpiredHolds(time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, released)
+
+	app.db.First(&hold, hold.ID)
+	assert.Equal(t, models.BookingCancelled, hold.Status)
+	assert.Equal(t, http.StatusOK, request("POST", "/book", other, `{"computer_id": 1, "start_time": "2030-06-02T10:00:00Z", "end_time": "2030-06-02T12:00:00Z"}`).Code)
+}
+
+func TestGetAvailableComputers(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	db2.SeedComputers(app.db)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	app.db.Create(&models.Booking{UserID: "user123", ComputerID: 1, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)})
+
+	var computers []models.Computer
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/available", nil)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+	assert.Len(t, computers, 6)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/available?from=2030-06-01T11:00:00Z&to=2030-06-01T13:00:00Z", nil)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+	assert.Len(t, computers, 5)
+	for _, computer := range computers {
+		assert.NotEqual(t, uint(1), computer.ID)
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/available?from=2030-06-01T12:00:00Z&to=2030-06-01T13:00:00Z", nil)
+	app.router.ServeHTTP(w, req)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+	assert.Len(t, computers, 6)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/available?from=2030-06-01T12:00:00Z&to=2030-06-01T11:00:00Z", nil)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAvailableComputersSpecFilter(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	db2.SeedComputers(app.db)
+
+	token, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("PUT", "/admin/computers/2", strings.NewReader(`{"GPU": "RTX 4070", "RAMGB": 32, "Tags": ["streaming"]}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	app.db.Model(&models.Computer{}).Where("number = ?", 3).Update("ram_gb", 16)
+
+	numbers := func(query string) []int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/available?"+query, nil)
+		app.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var computers []models.Computer
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+		var result []int
+		for _, computer := range computers {
+			result = append(result, computer.Number)
+		}
+		return result
+	}
+
+	assert.Equal(t, []int{2}, numbers("spec=gpu%3Drtx*"))
+	assert.Equal(t, []int{2, 3}, numbers("spec=ram_gb%3E%3D16"))
+	assert.Equal(t, []int{3}, numbers("spec=ram_gb%3E%3D16&spec=tag!%3Dstreaming"))
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/available?spec=disk%3Dssd", nil)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLocations(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	token, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/admin/locations", `{"Name": "Moon", "TimeZone": "Moon/Base"}`).Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/locations", `{"Name": "North Lab", "TimeZone": "America/New_York"}`).Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/locations", `{"Name": "South Lab", "TimeZone": "Europe/Berlin"}`).Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/locations/1/rooms", `{"Name": "101"}`).Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/locations/2/rooms", `{"Name": "A"}`).Code)
+
+	// Names are unique, rooms' within their location, until they are deleted.
+	assert.Equal(t, http.StatusConflict, request("POST", "/admin/locations", `{"Name": "North Lab"}`).Code)
+	assert.Equal(t, http.StatusConflict, request("PUT", "/admin/locations/2", `{"Name": "North Lab"}`).Code)
+	assert.Equal(t, http.StatusConflict, request("POST", "/admin/locations/1/rooms", `{"Name": "101"}`).Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/locations/2/rooms", `{"Name": "101"}`).Code)
+	assert.Equal(t, http.StatusConflict, request("PUT", "/admin/rooms/3", `{"Name": "A"}`).Code)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/admin/rooms/3", "").Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/locations/2/rooms", `{"Name": "101"}`).Code)
+
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/admin/computers", `{"Number": 9, "RoomID": 42}`).Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/computers", `{"Number": 1, "RoomID": 1}`).Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/computers", `{"Number": 2, "RoomID": 1}`).Code)
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/computers", `{"Number": 3, "RoomID": 2}`).Code)
+
+	assert.Equal(t, http.StatusConflict, request("DELETE", "/admin/rooms/1", "").Code)
+	assert.Equal(t, http.StatusConflict, request("DELETE", "/admin/locations/1", "").Code)
+
+	var computers []models.Computer
+	w := request("GET", "/admin/computers?location_id=1", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+	assert.Len(t, computers, 2)
+
+	// 10:00-12:00 UTC is 06:00-08:00 in New York.
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+	app.db.Create(&models.Booking{UserID: "user123", ComputerID: 1, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)})
+
+	w = request("GET", "/available?location_id=1&from=2030-06-01T07:00&to=2030-06-01T07:30", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+	assert.Len(t, computers, 1)
+	assert.Equal(t, 2, computers[0].Number)
+
+	w = request("GET", "/available?location_id=1&from=2030-06-01T10:00&to=2030-06-01T10:30", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+	assert.Len(t, computers, 2)
+
+	assert.Equal(t, http.StatusNotFound, request("GET", "/available?location_id=99", "").Code)
+
+	w = request("GET", "/computers/1/schedule?from=2030-06-01T00:00&to=2030-06-02T00:00", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var schedule struct {
+		TimeZone string `json:"time_zone"`
+		Busy     []struct {
+			StartTime string `json:"start_time"`
+		} `json:"busy"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedule))
+	assert.Equal(t, "America/New_York", schedule.TimeZone)
+	assert.Len(t, schedule.Busy, 1)
+	assert.Equal(t, "2030-06-01T06:00:00-04:00", schedule.Busy[0].StartTime)
+}
+
+func TestRoomLayout(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	token, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	location := models.Location{Name: "Lab", TimeZone: "UTC"}
+	app.db.Create(&location)
+	room := models.Room{LocationID: location.ID, Name: "101"}
+	other := models.Room{LocationID: location.ID, Name: "102"}
+	app.db.Create(&room)
+	app.db.Create(&other)
+	for number, roomID := range []uint{room.ID, room.ID, room.ID, other.ID} {
+		roomID := roomID
+		app.db.Create(&models.Computer{Number: number + 1, Status: "available", RoomID: &roomID})
+	}
+	app.db.Model(&models.Computer{}).Where("number = ?", 3).Update("status", "retired")
+
+	assert.Equal(t, http.StatusNotFound, request("GET", "/rooms/1/layout", "").Code)
+
+	assert.Equal(t, http.StatusBadRequest, request("PUT", "/admin/rooms/1/layout", `{"rows": 1, "columns": 1, "seats": [{"computer_id": 1, "row": 0, "column": 3}]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("PUT", "/admin/rooms/1/layout", `{"rows": 1, "columns": 1, "seats": [{"computer_id": 4, "row": 0, "column": 0}]}`).Code)
+
+	w := request("PUT", "/admin/rooms/1/layout", `{"rows": 2, "columns": 3, "seats": [
+		{"computer_id": 1, "row": 0, "column": 0, "orientation": "north", "label": "Window corner"},
+		{"computer_id": 2, "row": 0, "column": 1, "orientation": "north"},
+		{"computer_id": 3, "row": 1, "column": 2, "orientation": "south"}
+	]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+	app.db.Create(&models.Booking{UserID: "user123", ComputerID: 1, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)})
+
+	w = request("GET", "/rooms/1/layout?from=2030-06-01T11:00:00Z&to=2030-06-01T12:00:00Z", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var layout struct {
+		Rows    int          `json:"rows"`
+		Columns int          `json:"columns"`
+		Seats   []layoutSeat `json:"seats"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &layout))
+	assert.Equal(t, 2, layout.Rows)
+	assert.Equal(t, 3, layout.Columns)
+	assert.Len(t, layout.Seats, 3)
+
+	assert.Equal(t, "Window corner", layout.Seats[0].Label)
+	assert.Equal(t, seatBusy, layout.Seats[0].Status)
+	assert.Equal(t, []uint{2}, layout.Seats[0].Neighbours)
+	assert.Equal(t, seatAvailable, layout.Seats[1].Status)
+	assert.Equal(t, []uint{1}, layout.Seats[1].Neighbours)
+	assert.Equal(t, seatOutOfService, layout.Seats[2].Status)
+	assert.Empty(t, layout.Seats[2].Neighbours)
+
+	// The room goes with its floor plan once its computers have moved out.
+	assert.Equal(t, http.StatusConflict, request("DELETE", "/admin/rooms/1", "").Code)
+	app.db.Model(&models.Computer{}).Where("room_id = ?", room.ID).Update("room_id", other.ID)
+	assert.Equal(t, http.StatusOK, request("DELETE", "/admin/rooms/1", "").Code)
+	var seats, plans int64
+	app.db.Model(&models.Seat{}).Where("room_id = ?", room.ID).Count(&seats)
+	app.db.Model(&models.FloorPlan{}).Where("room_id = ?", room.ID).Count(&plans)
+	assert.Zero(t, seats)
+	assert.Zero(t, plans)
+}
+
+func TestGroupBooking(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	location := models.Location{Name: "Lab", TimeZone: "UTC"}
+	app.db.Create(&location)
+	room := models.Room{LocationID: location.ID, Name: "101"}
+	app.db.Create(&room)
+	for number := 1; number <= 4; number++ {
+		app.db.Create(&models.Computer{Number: number, Status: "available", RoomID: &room.ID})
+	}
+	app.db.Create(&models.FloorPlan{RoomID: room.ID, Rows: 1, Columns: 4})
+	for column := 0; column < 4; column++ {
+		app.db.Create(&models.Seat{RoomID: room.ID, ComputerID: uint(column + 1), Column: column})
+	}
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+	// Computer 2 is taken, so the only run of two is 3 and 4.
+	app.db.Create(&models.Booking{UserID: "someone", ComputerID: 2, StartTime: stTime, EndTime: stTime.Add(time.Hour)})
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	window := `"start_time": "2030-06-01T10:00:00Z", "end_time": "2030-06-01T12:00:00Z"`
+	assert.Equal(t, http.StatusConflict, request("POST", "/groups", `{"size": 3, `+window+`}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/groups", `{"size": 0, `+window+`}`).Code)
+
+	w := request("POST", "/groups", `{"size": 2, "room_id": 1, `+window+`}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response struct {
+		GroupID     uint   `json:"group_id"`
+		ComputerIDs []uint `json:"computer_ids"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []uint{3, 4}, response.ComputerIDs)
+
+	// An explicit list is booked all or nothing.
+	assert.Equal(t, http.StatusConflict, request("POST", "/groups", `{"computer_ids": [1, 4], `+window+`}`).Code)
+	var count int64
+	app.db.Model(&models.Booking{}).Where("computer_id = ?", 1).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	other, err := app.jwtUtil.GenerateToken("user456", "user", "other@mail.com")
+	assert.NoError(t, err)
+	groupURL := "/groups/" + strconv.Itoa(int(response.GroupID))
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", groupURL, nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = request("DELETE", groupURL, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	app.db.Model(&models.Booking{}).Where("group_id = ? AND status = ?", response.GroupID, models.BookingCancelled).Count(&count)
+	assert.Equal(t, int64(2), count)
+
+	assert.Equal(t, http.StatusOK, request("POST", "/groups", `{"computer_ids": [1, 4], `+window+`}`).Code)
+}
+
+func TestFindSlots(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	for number := 1; number <= 3; number++ {
+		app.db.Create(&models.Computer{Number: number, Status: "available", RAMGB: 8 * number})
+	}
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+	// Computer 1 is busy 10-12 and 13-15, computer 2 is busy 10-11.
+	app.db.Create(&models.Booking{UserID: "someone", ComputerID: 1, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)})
+	app.db.Create(&models.Booking{UserID: "someone", ComputerID: 1, StartTime: stTime.Add(3 * time.Hour), EndTime: stTime.Add(5 * time.Hour)})
+	app.db.Create(&models.Booking{UserID: "someone", ComputerID: 2, StartTime: stTime, EndTime: stTime.Add(time.Hour)})
+	// The caller has used computer 3 before.
+	app.db.Create(&models.Booking{UserID: "user123", ComputerID: 3, StartTime: stTime.Add(-48 * time.Hour), EndTime: stTime.Add(-47 * time.Hour), Status: models.BookingCompleted})
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	search := func(query string) []slotCandidate {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/slots?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		app.router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Candidates []slotCandidate `json:"candidates"`
+		}
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Candidates
+	}
+
+	window := "from=2030-06-01T10:00:00Z&to=2030-06-01T18:00:00Z"
+	candidates := search("duration=2h&" + window)
+	assert.Len(t, candidates, 3)
+	assert.Equal(t, 3, candidates[0].ComputerNumber)
+	assert.Equal(t, 2, candidates[1].ComputerNumber)
+	assert.Equal(t, stTime.Add(time.Hour), candidates[1].StartTime)
+	// Computer 1's 12-13 gap is too short, so it fits only after 15:00.
+	assert.Equal(t, 1, candidates[2].ComputerNumber)
+	assert.Equal(t, stTime.Add(5*time.Hour), candidates[2].StartTime)
+
+	candidates = search("duration=1h&from=2030-06-01T11:00:00Z&to=2030-06-01T18:00:00Z")
+	assert.Equal(t, []int{2, 3}, []int{candidates[0].ComputerNumber, candidates[1].ComputerNumber})
+	candidates = search("duration=1h&prefer=history&from=2030-06-01T11:00:00Z&to=2030-06-01T18:00:00Z")
+	assert.Equal(t, []int{3, 2}, []int{candidates[0].ComputerNumber, candidates[1].ComputerNumber})
+	assert.Equal(t, 1, candidates[0].PreviousUses)
+
+	candidates = search("duration=2h&spec=ram_gb%3C%3D16&limit=1&" + window)
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, 2, candidates[0].ComputerNumber)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/slots?duration=soon", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestBookingPolicy(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	location := models.Location{Name: "Lab", TimeZone: "UTC"}
+	app.db.Create(&location)
+	room := models.Room{LocationID: location.ID, Name: "101"}
+	app.db.Create(&room)
+	app.db.Create(&models.Computer{Number: 1, Status: "available"})
+	app.db.Create(&models.Computer{Number: 2, Status: "available"})
+	app.db.Create(&models.Computer{Number: 3, Status: "available", RoomID: &room.ID})
+
+	app.config.Policy = policy.Config{
+		Scope: policy.Scope{
+			Rules: policy.Rules{
+				MaxDuration:   policy.Duration(2 * time.Hour),
+				Alignment:     policy.Duration(15 * time.Minute),
+				MaxConcurrent: 1,
+			},
+			Roles: map[string]policy.Rules{"staff": {MaxConcurrent: -1}},
+		},
+		Locations: map[string]policy.Scope{
+			strconv.Itoa(int(location.ID)): {Rules: policy.Rules{MaxDuration: policy.Duration(4 * time.Hour)}},
+		},
+	}
+
+	book := func(role, body string) *httptest.ResponseRecorder {
+		token, err := app.jwtUtil.GenerateToken("user-"+role, role, "email@mail.com")
+		assert.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/book", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := book("user", `{"computer_id": 1, "start_time": "2030-06-01T10:05:00Z", "end_time": "2030-06-01T13:00:00Z"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var response struct {
+		Violations []policy.Violation `json:"violations"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, []policy.Violation{
+		{Field: "end_time", Code: "too_long", Message: "bookings may last at most 2h0m0s"},
+		{Field: "start_time", Code: "misaligned", Message: "start_time must be a multiple of 15m0s past the hour"},
+	}, response.Violations)
+
+	// The location allows longer bookings.
+	assert.Equal(t, http.StatusOK, book("user", `{"computer_id": 3, "start_time": "2030-06-01T10:00:00Z", "end_time": "2030-06-01T13:00:00Z"}`).Code)
+
+	// One booking at a time, except for staff.
+	assert.Equal(t, http.StatusUnprocessableEntity, book("user", `{"computer_id": 1, "start_time": "2030-06-01T12:00:00Z", "end_time": "2030-06-01T14:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusOK, book("user", `{"computer_id": 1, "start_time": "2030-06-01T13:00:00Z", "end_time": "2030-06-01T14:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusOK, book("staff", `{"computer_id": 2, "start_time": "2030-06-01T12:00:00Z", "end_time": "2030-06-01T14:00:00Z"}`).Code)
+
+	// Moving a booking is held to the same rules, without counting itself.
+	token, err := app.jwtUtil.GenerateToken("user-user", "user", "email@mail.com")
+	assert.NoError(t, err)
+	patch := func(body string) int {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", "/bookings/2", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusUnprocessableEntity, patch(`{"end_time": "2030-06-01T13:10:00Z"}`))
+	assert.Equal(t, http.StatusOK, patch(`{"end_time": "2030-06-01T14:00:00Z"}`))
+}
+
+func TestGroupBookingPolicy(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	lab := models.Location{Name: "Lab", TimeZone: "UTC"}
+	app.db.Create(&lab)
+	annex := models.Location{Name: "Annex", TimeZone: "UTC"}
+	app.db.Create(&annex)
+	labRoom := models.Room{LocationID: lab.ID, Name: "101"}
+	app.db.Create(&labRoom)
+	annexRoom := models.Room{LocationID: annex.ID, Name: "1"}
+	app.db.Create(&annexRoom)
+	for number := 1; number <= 9; number++ {
+		app.db.Create(&models.Computer{Number: number, Status: "available", RoomID: &labRoom.ID})
+	}
+	app.db.Create(&models.Computer{Number: 10, Status: "available", RoomID: &annexRoom.ID})
+	app.config.Policy.Locations = map[string]policy.Scope{
+		strconv.Itoa(int(annex.ID)): {Rules: policy.Rules{MaxDuration: policy.Duration(2 * time.Hour)}},
+	}
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	start := time.Now().UTC().Truncate(24 * time.Hour).Add(48*time.Hour + 10*time.Hour)
+	group := func(ids string, hours int) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"computer_ids": [%s], "start_time": %q, "end_time": %q}`, ids,
+			start.Format(time.RFC3339), start.Add(time.Duration(hours)*time.Hour).Format(time.RFC3339))
+		req, _ := http.NewRequest("POST", "/groups", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A three seat session for three hours is one booking, not three.
+	assert.Equal(t, http.StatusOK, group("1, 2, 3", 3).Code)
+	assert.Equal(t, http.StatusOK, group("4, 5, 6", 3).Code)
+
+	// Two groups already run at once, the default limit.
+	w := group("7, 8, 9", 1)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "max_concurrent")
+
+	// Each location's own rules apply to its computers.
+	app.db.Model(&models.Booking{}).Where("1 = 1").Update("status", models.BookingCancelled)
+	w = group("7, 10", 3)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "too_long")
+	assert.Equal(t, http.StatusOK, group("7, 10", 2).Code)
+}
+
+func TestSeriesBookingPolicy(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+
+	series := func(start time.Time) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		body := fmt.Sprintf(`{"computer_id": 1, "start_time": %q, "end_time": %q, "rrule": "FREQ=WEEKLY;COUNT=16"}`,
+			start.Format(time.RFC3339), start.Add(2*time.Hour).Format(time.RFC3339))
+		req, _ := http.NewRequest("POST", "/book", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// A semester long series only has to start within the booking horizon.
+	start := time.Now().UTC().Truncate(24*time.Hour).AddDate(0, 0, 7).Add(14 * time.Hour)
+	w := series(start)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var count int64
+	app.db.Model(&models.Booking{}).Where("user_id = ?", "user123").Count(&count)
+	assert.Equal(t, int64(16), count)
+
+	w = series(start.AddDate(0, 0, 40))
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "too_far_ahead")
+}
+
+func TestOpeningHoursAndClosures(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+	rabbit := app.rabbit.(*testPublisher)
+
+	location := models.Location{Name: "Lab", TimeZone: "Europe/Berlin"}
+	app.db.Create(&location)
+	room := models.Room{LocationID: location.ID, Name: "101"}
+	app.db.Create(&room)
+	app.db.Create(&models.Computer{Number: 1, Status: "available", RoomID: &room.ID})
+	app.db.Create(&models.Computer{Number: 2, Status: "available"})
+
+	adminToken, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+	userToken, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	request := func(token, method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "PUT", "/admin/locations/1/hours", `{"hours": [{"weekday": 1, "opens": "17:00", "closes": "09:00"}]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "PUT", "/admin/locations/1/hours", `{"hours": [{"weekday": 1, "opens": "9am", "closes": "17:00"}]}`).Code)
+	// Monday and Tuesday, 09:00-17:00 Berlin time (UTC+2 in June).
+	assert.Equal(t, http.StatusOK, request(adminToken, "PUT", "/admin/locations/1/hours", `{"hours": [
+		{"weekday": 1, "opens": "09:00", "closes": "17:00"},
+		{"weekday": 2, "opens": "09:00", "closes": "17:00"}
+	]}`).Code)
+
+	w := request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "2030-06-03T06:00:00Z", "end_time": "2030-06-03T08:00:00Z"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	var rejected struct {
+		Closed []struct {
+			StartTime string `json:"start_time"`
+			EndTime   string `json:"end_time"`
+		} `json:"closed"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &rejected))
+	assert.Len(t, rejected.Closed, 1)
+	assert.Equal(t, "2030-06-03T08:00:00+02:00", rejected.Closed[0].StartTime)
+	assert.Equal(t, "2030-06-03T09:00:00+02:00", rejected.Closed[0].EndTime)
+
+	// Computers outside any location are always open.
+	assert.Equal(t, http.StatusOK, request(userToken, "POST", "/book", `{"computer_id": 2, "start_time": "2030-06-03T06:00:00Z", "end_time": "2030-06-03T08:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusOK, request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "2030-06-03T08:00:00Z", "end_time": "2030-06-03T10:00:00Z"}`).Code)
+
+	var computers []models.Computer
+	w = request(userToken, "GET", "/available?from=2030-06-03T16:00:00Z&to=2030-06-03T17:00:00Z", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+	assert.Len(t, computers, 1)
+	assert.Equal(t, 2, computers[0].Number)
+
+	w = request(userToken, "GET", "/computers/1/schedule?from=2030-06-03T00:00&to=2030-06-04T00:00", "")
+	var schedule struct {
+		Free   []json.RawMessage `json:"free"`
+		Closed []json.RawMessage `json:"closed"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &schedule))
+	assert.Len(t, schedule.Closed, 2)
+	// 09:00-10:00 and 12:00-17:00 around the booking.
+	assert.Len(t, schedule.Free, 2)
+
+	// A closure over a booking cancels it and tells its owner.
+	w = request(adminToken, "POST", "/admin/locations/1/closures", `{"kind": "closure", "reason": "Power outage", "start_time": "2030-06-03T11:00", "end_time": "2030-06-03T13:00"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Cancelled []uint `json:"cancelled_bookings"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, []uint{2}, created.Cancelled)
+	var booking models.Booking
+	app.db.First(&booking, 2)
+	assert.Equal(t, models.BookingCancelled, booking.Status)
+	assert.Len(t, rabbit.sent("booking_cancelled"), 1)
+
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", "/admin/locations/1/closures", `{"kind": "holiday", "date": "June 4th"}`).Code)
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/locations/1/closures", `{"kind": "holiday", "reason": "Founders' day", "date": "2030-06-04"}`).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "2030-06-04T08:00:00Z", "end_time": "2030-06-04T09:00:00Z"}`).Code)
+
+	w = request(userToken, "GET", "/locations/1/hours", "")
+	var calendar struct {
+		Hours    []models.OpeningHours `json:"hours"`
+		Closures []models.Closure      `json:"closures"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &calendar))
+	assert.Len(t, calendar.Hours, 2)
+	assert.Len(t, calendar.Closures, 2)
+
+	assert.Equal(t, http.StatusOK, request(adminToken, "DELETE", fmt.Sprintf("/admin/closures/%d", calendar.Closures[1].ID), "").Code)
+	assert.Equal(t, http.StatusOK, request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "2030-06-04T08:00:00Z", "end_time": "2030-06-04T09:00:00Z"}`).Code)
+}
+
+func TestMaintenanceWindows(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	rabbit := app.rabbit.(*testPublisher)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+	app.db.Create(&models.Computer{Number: 2, Status: "available"})
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	at := func(offset time.Duration) string {
+		return now.Add(offset).Format(time.RFC3339)
+	}
+	app.db.Create(&models.Booking{UserID: "user123", Email: "email@mail.com", ComputerID: computer.ID, StartTime: now.Add(2 * time.Hour), EndTime: now.Add(3 * time.Hour), Status: models.BookingConfirmed})
+	app.db.Create(&models.Booking{UserID: "user123", Email: "email@mail.com", ComputerID: computer.ID, StartTime: now.Add(30 * time.Hour), EndTime: now.Add(31 * time.Hour), Status: models.BookingConfirmed})
+
+	adminToken, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+	userToken, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	request := func(token, method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", "/admin/computers/1/maintenance", `{"expected_end": "`+at(24*time.Hour)+`"}`).Code)
+	w := request(adminToken, "POST", "/admin/computers/1/maintenance", `{"reason": "Broken PSU", "reported_by": "helpdesk", "expected_end": "`+at(24*time.Hour)+`"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created struct {
+		Maintenance models.MaintenanceWindow `json:"maintenance"`
+		Cancelled   []uint                   `json:"cancelled_bookings"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, "helpdesk", created.Maintenance.ReportedBy)
+	assert.Equal(t, []uint{1}, created.Cancelled)
+	assert.Len(t, rabbit.sent("booking_cancelled"), 1)
+
+	app.db.First(&computer, computer.ID)
+	assert.Equal(t, models.ComputerMaintenance, computer.Status)
+
+	// The window blocks bookings and availability, but not the time after it.
+	assert.Equal(t, http.StatusConflict, request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "`+at(4*time.Hour)+`", "end_time": "`+at(5*time.Hour)+`"}`).Code)
+	assert.Equal(t, http.StatusOK, request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "`+at(26*time.Hour)+`", "end_time": "`+at(27*time.Hour)+`"}`).Code)
+
+	var computers []models.Computer
+	w = request(userToken, "GET", "/available?from="+at(4*time.Hour)+"&to="+at(5*time.Hour), "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &computers))
+	assert.Len(t, computers, 1)
+	assert.Equal(t, 2, computers[0].Number)
+
+	var windows []models.MaintenanceWindow
+	w = request(adminToken, "GET", "/admin/maintenance?active=true", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &windows))
+	assert.Len(t, windows, 1)
+
+	// The computer reopens by itself once the expected end has passed.
+	assert.NoError(t, app.applyMaintenance(now.Add(25*time.Hour)))
+	app.db.First(&computer, computer.ID)
+	assert.Equal(t, models.ComputerAvailable, computer.Status)
+
+	// An open-ended window lasts until it is ended by hand.
+	var other models.Computer
+	app.db.Where("number = ?", 2).First(&other)
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/computers/2/maintenance", `{"reason": "Reimaging"}`).Code)
+	app.db.First(&other, other.ID)
+	assert.Equal(t, models.ComputerMaintenance, other.Status)
+	w = request(adminToken, "PUT", "/admin/maintenance/2", `{"expected_end": "`+at(-time.Hour)+`"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "expected_end")
+	assert.Equal(t, http.StatusOK, request(adminToken, "PUT", "/admin/maintenance/2", `{"reason": "Reimaging and updates", "expected_end": "`+at(48*time.Hour)+`"}`).Code)
+	var updated models.MaintenanceWindow
+	app.db.First(&updated, 2)
+	assert.Equal(t, "Reimaging and updates", updated.Reason)
+	assert.NotNil(t, updated.ExpectedEnd)
+	assert.Equal(t, http.StatusOK, request(adminToken, "POST", "/admin/maintenance/2/end", "").Code)
+	assert.Equal(t, http.StatusConflict, request(adminToken, "POST", "/admin/maintenance/2/end", "").Code)
+	app.db.First(&other, other.ID)
+	assert.Equal(t, models.ComputerAvailable, other.Status)
+
+	w = request(adminToken, "GET", "/admin/computers/2/maintenance", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &windows))
+	assert.Len(t, windows, 1)
+	assert.Equal(t, "Reimaging and updates", windows[0].Reason)
+	assert.Equal(t, "admin1", windows[0].ReportedBy)
+	assert.NotNil(t, windows[0].EndedAt)
+
+	w = request(adminToken, "GET", "/admin/maintenance", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &windows))
+	assert.Len(t, windows, 2)
+}
+
+func TestIssueReporting(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	rabbit := app.rabbit.(*testPublisher)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+	now := time.Now().UTC().Truncate(time.Hour)
+	app.db.Create(&models.Booking{UserID: "user123", Email: "email@mail.com", ComputerID: computer.ID, StartTime: now.Add(-time.Hour), EndTime: now.Add(time.Hour), Status: models.BookingCheckedIn})
+	app.db.Create(&models.Booking{UserID: "user456", Email: "other@mail.com", ComputerID: computer.ID, StartTime: now.Add(3 * time.Hour), EndTime: now.Add(4 * time.Hour), Status: models.BookingConfirmed})
+
+	adminToken, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+	userToken, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	otherToken, err := app.jwtUtil.GenerateToken("user456", "user", "other@mail.com")
+	assert.NoError(t, err)
+	request := func(token, method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request(userToken, "POST", "/issues", `{"computer_id": 1}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(userToken, "POST", "/issues", `{"computer_id": 1, "title": "Mouse", "severity": "urgent"}`).Code)
+	assert.Equal(t, http.StatusNotFound, request(userToken, "POST", "/issues", `{"computer_id": 9, "title": "Mouse"}`).Code)
+	assert.Equal(t, http.StatusForbidden, request(userToken, "POST", "/issues", `{"computer_id": 1, "booking_id": 2, "title": "Mouse"}`).Code)
+
+	w := request(userToken, "POST", "/issues", `{"computer_id": 1, "booking_id": 1, "title": "Mouse double-clicks", "severity": "low"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var issue models.Issue
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issue))
+	assert.Equal(t, models.IssueOpen, issue.Status)
+	assert.Nil(t, issue.MaintenanceWindowID)
+
+	// A high severity report from someone checked in takes the computer out
+	// of service for new bookings, but keeps the ones already made.
+	w = request(userToken, "POST", "/issues", `{"computer_id": 1, "booking_id": 1, "title": "Monitor is dead", "severity": "high"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issue))
+	assert.NotNil(t, issue.MaintenanceWindowID)
+	app.db.First(&computer, computer.ID)
+	assert.Equal(t, models.ComputerMaintenance, computer.Status)
+	var booking models.Booking
+	app.db.First(&booking, 2)
+	assert.Equal(t, models.BookingConfirmed, booking.Status)
+	assert.Empty(t, rabbit.sent("booking_cancelled"))
+	w = request(otherToken, "POST", "/book", fmt.Sprintf(`{"computer_id": 1, "start_time": %q, "end_time": %q}`,
+		now.Add(5*time.Hour).Format(time.RFC3339), now.Add(6*time.Hour).Format(time.RFC3339)))
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	assert.Equal(t, http.StatusForbidden, request(otherToken, "GET", "/issues/2", "").Code)
+	assert.Equal(t, http.StatusForbidden, request(userToken, "POST", "/admin/issues/2/transitions", `{"status": "acknowledged"}`).Code)
+
+	assert.Equal(t, http.StatusOK, request(adminToken, "PUT", "/admin/issues/2/assignee", `{"assignee_id": "admin1"}`).Code)
+	assert.Equal(t, http.StatusOK, request(adminToken, "POST", "/admin/issues/2/transitions", `{"status": "in_progress"}`).Code)
+	assert.Equal(t, http.StatusConflict, request(adminToken, "POST", "/admin/issues/2/transitions", `{"status": "acknowledged"}`).Code)
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/issues/2/comments", `{"body": "Replacement ordered"}`).Code)
+	assert.Equal(t, http.StatusCreated, request(userToken, "POST", "/issues/2/comments", `{"body": "Thanks"}`).Code)
+
+	w = request(adminToken, "POST", "/admin/issues/2/transitions", `{"status": "resolved", "comment": "Monitor replaced"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issue))
+	assert.NotNil(t, issue.ResolvedAt)
+	app.db.First(&computer, computer.ID)
+	assert.NotEqual(t, models.ComputerMaintenance, computer.Status)
+
+	// Status changes and admin comments reach the reporter.
+	assert.Len(t, rabbit.sent("issue_updated"), 3)
+
+	w = request(userToken, "GET", "/issues/2", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issue))
+	assert.Equal(t, "admin1", issue.AssigneeID)
+	assert.Len(t, issue.Comments, 5)
+	assert.Equal(t, "Status changed from in_progress to resolved: Monitor replaced", issue.Comments[4].Body)
+
+	var issues []models.Issue
+	w = request(userToken, "GET", "/issues", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issues))
+	assert.Len(t, issues, 2)
+	w = request(adminToken, "GET", "/admin/issues?severity=high&status=resolved", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issues))
+	assert.Len(t, issues, 1)
+
+	// Anyone else's high severity report waits for an admin to acknowledge it.
+	w = request(otherToken, "POST", "/issues", `{"computer_id": 1, "title": "Smoke from the case", "severity": "high"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issue))
+	assert.Nil(t, issue.MaintenanceWindowID)
+	app.db.First(&computer, computer.ID)
+	assert.NotEqual(t, models.ComputerMaintenance, computer.Status)
+
+	w = request(adminToken, "POST", "/admin/issues/3/transitions", `{"status": "acknowledged"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &issue))
+	assert.NotNil(t, issue.MaintenanceWindowID)
+	app.db.First(&computer, computer.ID)
+	assert.Equal(t, models.ComputerMaintenance, computer.Status)
+	app.db.First(&booking, 2)
+	assert.Equal(t, models.BookingConfirmed, booking.Status)
+}
+
+func TestTariffsAndQuotes(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	location := models.Location{Name: "Lab", TimeZone: "Europe/Berlin"}
+	app.db.Create(&location)
+	room := models.Room{LocationID: location.ID, Name: "101"}
+	app.db.Create(&room)
+	app.db.Create(&models.Computer{Number: 1, Status: "available", Class: "gpu", RoomID: &room.ID})
+	app.db.Create(&models.Computer{Number: 2, Status: "available"})
+
+	adminToken, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+	userToken, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	request := func(token, method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+	type quoteResponse struct {
+		Tariff *string `json:"tariff"`
+		Quote  *struct {
+			Currency string `json:"currency"`
+			Lines    []struct {
+				Rate   string `json:"rate"`
+				Amount int64  `json:"amount"`
+			} `json:"lines"`
+			Total int64 `json:"total"`
+		} `json:"quote"`
+	}
+	quote := func(url string) quoteResponse {
+		w := request("", "GET", url, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response quoteResponse
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	// Without tariffs bookings are free.
+	response := quote("/quote?computer_id=1&start_time=2030-06-03T11:00&end_time=2030-06-03T13:00")
+	assert.Nil(t, response.Tariff)
+	assert.Nil(t, response.Quote)
+
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/tariffs", `{"Name": "Standard", "Currency": "EUR", "HourlyRate": 400, "MinimumCharge": 200}`).Code)
+	assert.Equal(t, http.StatusConflict, request(adminToken, "POST", "/admin/tariffs", `{"Name": "Other", "Currency": "EUR", "HourlyRate": 500}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", "/admin/tariffs", `{"Name": "Lab", "LocationID": 1, "Currency": "EUR", "HourlyRate": 600, "Peaks": [
+		{"Weekday": 1, "Starts": "12:00", "Ends": "14:00", "Multiplier": 1.5},
+		{"Weekday": 1, "Starts": "13:00", "Ends": "15:00", "Multiplier": 2}
+	]}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", "/admin/tariffs", `{"Name": "Lab", "LocationID": 9, "Currency": "EUR", "HourlyRate": 600}`).Code)
+	// Monday lunchtime is peak at the lab, and GPU machines cost double.
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/tariffs", `{"Name": "Lab", "LocationID": 1, "Currency": "EUR", "HourlyRate": 600,
+		"Peaks": [{"Weekday": 1, "Starts": "12:00", "Ends": "14:00", "Multiplier": 1.5}],
+		"Classes": [{"Class": "gpu", "Multiplier": 2}]
+	}`).Code)
+
+	response = quote("/quote?computer_id=1&start_time=2030-06-03T11:00&end_time=2030-06-03T13:00")
+	assert.Equal(t, "Lab", *response.Tariff)
+	assert.Equal(t, "EUR", response.Quote.Currency)
+	assert.Len(t, response.Quote.Lines, 2)
+	assert.Equal(t, "peak", response.Quote.Lines[1].Rate)
+	assert.Equal(t, int64(3000), response.Quote.Total)
+	// Computers outside the lab fall back to the default tariff.
+	response = quote("/quote?computer_id=2&start_time=2030-06-03T11:00:00Z&end_time=2030-06-03T11:15:00Z")
+	assert.Equal(t, "Standard", *response.Tariff)
+	assert.Equal(t, int64(200), response.Quote.Total)
+	assert.Equal(t, http.StatusBadRequest, request("", "GET", "/quote?computer_id=1&start_time=2030-06-03T13:00&end_time=2030-06-03T11:00", "").Code)
+
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/wallets/user123/entries", `{"kind": "top_up", "currency": "EUR", "amount": 5000}`).Code)
+	w := request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "2030-06-03T09:00:00Z", "end_time": "2030-06-03T11:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var booking models.Booking
+	assert.NoError(t, app.db.First(&booking).Error)
+	assert.Equal(t, int64(3000), booking.Price)
+	assert.Equal(t, "EUR", booking.Currency)
+
+	// Moving the booking off-peak reprices it.
+	w = request(userToken, "PATCH", "/bookings/1", `{"start_time": "2030-06-03T08:00:00Z", "end_time": "2030-06-03T09:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, app.db.First(&booking, booking.ID).Error)
+	assert.Equal(t, int64(1200), booking.Price)
+
+	// Editing the tariff replaces its rules but leaves booked prices alone.
+	w = request(adminToken, "PUT", "/admin/tariffs/2", `{"Name": "Lab", "LocationID": 1, "Currency": "EUR", "HourlyRate": 1000}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tariff models.Tariff
+	w = request(adminToken, "GET", "/admin/tariffs/2", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &tariff))
+	assert.Empty(t, tariff.Peaks)
+	assert.Empty(t, tariff.Classes)
+	response = quote("/quote?computer_id=1&start_time=2030-06-03T11:00&end_time=2030-06-03T13:00")
+	assert.Equal(t, int64(2000), response.Quote.Total)
+	assert.NoError(t, app.db.First(&booking, booking.ID).Error)
+	assert.Equal(t, int64(1200), booking.Price)
+
+	assert.Equal(t, http.StatusOK, request(adminToken, "DELETE", "/admin/tariffs/2", "").Code)
+	response = quote("/quote?computer_id=1&start_time=2030-06-03T11:00&end_time=2030-06-03T13:00")
+	assert.Equal(t, "Standard", *response.Tariff)
+	assert.Equal(t, int64(800), response.Quote.Total)
+
+	// Names are unique, but a deleted tariff's name is free again.
+	assert.Equal(t, http.StatusConflict, request(adminToken, "POST", "/admin/tariffs", `{"Name": "Standard", "LocationID": 1, "Currency": "EUR", "HourlyRate": 600}`).Code)
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/tariffs", `{"Name": "Lab", "LocationID": 1, "Currency": "EUR", "HourlyRate": 600}`).Code)
+	assert.Equal(t, http.StatusForbidden, request(userToken, "GET", "/admin/tariffs", "").Code)
+}
+
+func TestWalletCharges(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+	app.config.Refunds = pricing.RefundPolicy{FullNotice: 24 * time.Hour, LatePercent: 50}
+	app.db.Create(&models.Computer{Number: 1, Status: "available"})
+	app.db.Create(&models.Tariff{Name: "Standard", Currency: "EUR", HourlyRate: 400})
+
+	adminToken, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+	userToken, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	request := func(token, method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+	balance := func() int64 {
+		var wallet models.Wallet
+		assert.NoError(t, app.db.Where("user_id = ? AND currency = ?", "user123", "EUR").First(&wallet).Error)
+		return wallet.Balance
+	}
+
+	// Nothing to pay with yet; the booking is not made.
+	w := request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "2030-06-03T09:00:00Z", "end_time": "2030-06-03T10:00:00Z"}`)
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	assert.Contains(t, w.Body.String(), `"amount":400`)
+	var bookings int64
+	app.db.Model(&models.Booking{}).Count(&bookings)
+	assert.Zero(t, bookings)
+
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", "/admin/wallets/user123/entries", `{"kind": "top_up", "currency": "EUR", "amount": -100}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", "/admin/wallets/user123/entries", `{"kind": "adjustment", "currency": "EUR", "amount": 100}`).Code)
+	assert.Equal(t, http.StatusBadRequest, request(adminToken, "POST", "/admin/wallets/user123/entries", `{"kind": "refund", "currency": "EUR", "amount": 100}`).Code)
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/wallets/user123/entries", `{"kind": "top_up", "currency": "eur", "amount": 1000, "note": "Paid at the desk"}`).Code)
+	assert.Equal(t, int64(1000), balance())
+
+	w = request(userToken, "POST", "/book", `{"computer_id": 1, "start_time": "2030-06-03T09:00:00Z", "end_time": "2030-06-03T11:00:00Z"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(200), balance())
+
+	// Shortening the booking refunds the difference.
+	assert.Equal(t, http.StatusOK, request(userToken, "PATCH", "/bookings/1", `{"start_time": "2030-06-03T09:00:00Z", "end_time": "2030-06-03T10:00:00Z"}`).Code)
+	assert.Equal(t, int64(600), balance())
+	// Lengthening it beyond the balance is refused and changes nothing.
+	assert.Equal(t, http.StatusPaymentRequired, request(userToken, "PATCH", "/bookings/1", `{"start_time": "2030-06-03T09:00:00Z", "end_time": "2030-06-03T13:00:00Z"}`).Code)
+	assert.Equal(t, int64(600), balance())
+
+	// Cancelling at short notice refunds half.
+	start := time.Now().UTC().Add(time.Hour).Truncate(5 * time.Minute)
+	w = request(userToken, "POST", "/book", fmt.Sprintf(`{"computer_id": 1, "start_time": %q, "end_time": %q}`,
+		start.Format(time.RFC3339), start.Add(time.Hour).Format(time.RFC3339)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, int64(200), balance())
+	assert.Equal(t, http.StatusOK, request(userToken, "DELETE", "/cancel/2", "").Code)
+	assert.Equal(t, int64(400), balance())
+
+	// Cancelling well ahead, or by an admin, refunds everything.
+	assert.Equal(t, http.StatusOK, request(adminToken, "DELETE", "/admin/bookings/1", "").Code)
+	assert.Equal(t, int64(800), balance())
+
+	w = request(adminToken, "POST", "/admin/wallets/user123/entries", `{"kind": "adjustment", "currency": "EUR", "amount": -900, "note": "Correction"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, http.StatusCreated, request(adminToken, "POST", "/admin/wallets/user123/entries", `{"kind": "adjustment", "currency": "EUR", "amount": -100, "note": "Correction"}`).Code)
+	assert.Equal(t, int64(700), balance())
+
+	var wallets struct {
+		Wallets []models.Wallet `json:"wallets"`
+	}
+	w = request(userToken, "GET", "/me/wallet", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &wallets))
+	assert.Len(t, wallets.Wallets, 1)
+	assert.Equal(t, int64(700), wallets.Wallets[0].Balance)
+
+	var statement struct {
+		Entries []struct {
+			Kind     string
+			Amount   int64
+			Balance  int64
+			Currency string
+		} `json:"entries"`
+	}
+	w = request(userToken, "GET", "/me/wallet/statement?currency=eur", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &statement))
+	kinds := make([]string, 0, len(statement.Entries))
+	var sum int64
+	for _, entry := range statement.Entries {
+		kinds = append(kinds, entry.Kind)
+		sum += entry.Amount
+		assert.Equal(t, "EUR", entry.Currency)
+	}
+	assert.Equal(t, []string{"adjustment", "refund", "refund", "charge", "refund", "charge", "top_up"}, kinds)
+	assert.Equal(t, int64(700), sum)
+	assert.Equal(t, int64(700), statement.Entries[0].Balance)
+
+	w = request(adminToken, "GET", "/admin/wallets/user123/statement", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &statement))
+	assert.Len(t, statement.Entries, 7)
+	assert.Equal(t, http.StatusForbidden, request(userToken, "GET", "/admin/wallets/user123", "").Code)
+}
+
+func TestPaymentTopUps(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	rabbit := app.rabbit.(*testPublisher)
+	fake := app.payments.(*payments.Fake)
+
+	adminToken, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+	userToken, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	request := func(token, method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+	webhook := func(payload []byte, signature string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/payments/webhook", strings.NewReader(string(payload)))
+		req.Header.Set(payments.SignatureHeader, signature)
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+	balance := func() int64 {
+		var wallet models.Wallet
+		app.db.Where("user_id = ? AND currency = ?", "user123", "EUR").First(&wallet)
+		return wallet.Balance
+	}
+	topUp := func(method string) (*httptest.ResponseRecorder, models.Payment) {
+		w := request(userToken, "POST", "/me/wallet/top-ups", fmt.Sprintf(`{"amount": 1000, "currency": "eur", "method": %q}`, method))
+		var payment models.Payment
+		app.db.Order("id DESC").First(&payment)
+		return w, payment
+	}
+
+	assert.Equal(t, http.StatusBadRequest, request(userToken, "POST", "/me/wallet/top-ups", `{"amount": 0, "currency": "EUR"}`).Code)
+
+	w, payment := topUp(payments.FakeSucceed)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, models.PaymentSucceeded, payment.Status)
+	assert.Equal(t, int64(1000), balance())
+	assert.Len(t, rabbit.sent("payment_succeeded"), 1)
+
+	w, payment = topUp(payments.FakeDecline)
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	assert.Equal(t, models.PaymentFailed, payment.Status)
+	assert.Equal(t, "card declined", payment.FailureReason)
+	assert.Equal(t, int64(1000), balance())
+	assert.Len(t, rabbit.sent("payment_failed"), 1)
+
+	// A delayed payment is credited when the provider's webhook arrives, once.
+	w, payment = topUp(payments.FakeDelay)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, models.PaymentPending, payment.Status)
+	assert.Equal(t, int64(1000), balance())
+
+	payload, signature, err := fake.Webhook(payment.ProviderRef)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, webhook(payload, "t=1,v1=forged").Code)
+	assert.Equal(t, http.StatusUnauthorized, webhook([]byte(strings.Replace(string(payload), "1000", "100000", 1)), signature).Code)
+	assert.Equal(t, int64(1000), balance())
+	assert.Equal(t, http.StatusOK, webhook(payload, signature).Code)
+	assert.Equal(t, int64(2000), balance())
+	assert.Equal(t, http.StatusOK, webhook(payload, signature).Code)
+	assert.Equal(t, int64(2000), balance())
+
+	// Payments whose webhook never came, or whose capture was lost, are
+	// reconciled with the provider once they are old enough.
+	w, _ = topUp(payments.FakeDelay)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	intent, err := fake.CreateIntent(context.Background(), payments.IntentRequest{Amount: 500, Currency: "EUR"})
+	assert.NoError(t, err)
+	app.db.Create(&models.Payment{UserID: "user123", Provider: "fake", ProviderRef: intent.ID, Amount: 500, Currency: "EUR", Status: models.PaymentPending})
+	app.db.Create(&models.Payment{UserID: "user123", Provider: "fake", Amount: 700, Currency: "EUR", Status: models.PaymentPending})
+
+	settled, err := app.reconcilePayments(context.Background(), time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, settled)
+	settled, err = app.reconcilePayments(context.Background(), time.Now().Add(time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, settled)
+	assert.Equal(t, int64(3500), balance())
+	var failed int64
+	app.db.Model(&models.Payment{}).Where("status = ?", models.PaymentFailed).Count(&failed)
+	assert.Equal(t, int64(2), failed)
+
+	var list []models.Payment
+	w = request(userToken, "GET", "/me/payments", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list, 6)
+
+	// Refunds take the top-up back out of the wallet.
+	assert.Equal(t, http.StatusOK, request(adminToken, "POST", "/admin/payments/1/refund", "").Code)
+	assert.Equal(t, int64(2500), balance())
+	assert.Equal(t, http.StatusConflict, request(adminToken, "POST", "/admin/payments/1/refund", "").Code)
+	assert.Equal(t, http.StatusConflict, request(adminToken, "POST", "/admin/payments/2/refund", "").Code)
+	refunded, err := fake.Intent(context.Background(), "pi_fake_1")
+	assert.NoError(t, err)
+	assert.Equal(t, payments.IntentRefunded, refunded.Status)
+
+	w = request(adminToken, "GET", "/admin/payments?status=refunded", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	assert.Len(t, list, 1)
+}
+
+func TestGetComputerSchedule(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:10:00Z")
+	assert.NoError(t, err)
+
+	app.db.Create(&models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: stTime, EndTime: stTime.Add(40 * time.Minute)})
+	app.db.Create(&models.Booking{UserID: "user456", ComputerID: computer.ID, StartTime: stTime.Add(time.Hour), EndTime: stTime.Add(2 * time.Hour)})
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/computers/1/schedule?from=2030-06-01T09:00:00Z&to=2030-06-01T13:00:00Z&slot=30m", nil)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response struct {
+		Busy []struct {
+			StartTime time.Time `json:"start_time"`
+			EndTime   time.Time `json:"end_time"`
+		} `json:"busy"`
+		Free []struct {
+			StartTime time.Time `json:"start_time"`
+			EndTime   time.Time `json:"end_time"`
+		} `json:"free"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Busy, 1)
+	assert.Equal(t, "2030-06-01T10:00:00Z", response.Busy[0].StartTime.UTC().Format(time.RFC3339))
+	assert.Equal(t, "2030-06-01T12:30:00Z", response.Busy[0].EndTime.UTC().Format(time.RFC3339))
+	assert.Len(t, response.Free, 2)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/computers/1/schedule?slot=10s", nil)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestComputerScheduleWithClosure(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	location := models.Location{Name: "Main", TimeZone: "UTC"}
+	app.db.Create(&location)
+	room := models.Room{LocationID: location.ID, Name: "Lab"}
+	app.db.Create(&room)
+	computer := models.Computer{Number: 1, Status: "available", RoomID: &room.ID}
+	app.db.Create(&computer)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:10:00Z")
+	assert.NoError(t, err)
+	app.db.Create(&models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: stTime, EndTime: stTime.Add(40 * time.Minute)})
+	app.db.Create(&models.Closure{LocationID: location.ID, Kind: models.ClosureAdHoc, StartTime: stTime.Add(time.Hour), EndTime: stTime.Add(90 * time.Minute)})
+
+	// Neither the window nor the closure is aligned to the slots.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/computers/1/schedule?from=2030-06-01T09:07:00Z&to=2030-06-01T13:07:00Z&slot=30m", nil)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	type interval struct {
+		StartTime time.Time `json:"start_time"`
+		EndTime   time.Time `json:"end_time"`
+	}
+	var response struct {
+		Busy   []interval `json:"busy"`
+		Free   []interval `json:"free"`
+		Closed []interval `json:"closed"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	format := func(intervals []interval) []string {
+		formatted := make([]string, 0, len(intervals))
+		for _, interval := range intervals {
+			formatted = append(formatted, interval.StartTime.UTC().Format("15:04")+"-"+interval.EndTime.UTC().Format("15:04"))
+		}
+		return formatted
+	}
+	assert.Equal(t, []string{"10:00-12:00"}, format(response.Busy))
+	assert.Equal(t, []string{"09:07-10:00", "12:00-13:07"}, format(response.Free))
+	assert.Equal(t, []string{"11:10-11:40"}, format(response.Closed))
+}
+
+func TestBookRecurringSeries(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-09-17T14:00:00Z")
+	assert.NoError(t, err)
+
+	// The fourth Tuesday is already taken, so the whole series is rejected.
+	blocker := models.Booking{UserID: "user456", ComputerID: computer.ID, StartTime: stTime.AddDate(0, 0, 21), EndTime: stTime.AddDate(0, 0, 21).Add(time.Hour)}
+	app.db.Create(&blocker)
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+
+	book := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/book", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := book(`{"computer_id": 1, "start_time": "2030-09-17T14:00:00Z", "end_time": "2030-09-17T16:00:00Z", "rrule": "FREQ=WEEKLY;COUNT=16"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	var count int64
+	app.db.Model(&models.Booking{}).Where("user_id = ?", "user123").Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	w = book(`{"computer_id": 1, "start_time": "2030-09-17T14:00:00Z", "end_time": "2030-09-17T16:00:00Z", "rrule": "FREQ=WEEKLY;COUNT=16", "exdates": ["2030-10-08T14:00:00Z"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var created struct {
+		SeriesID   uint   `json:"series_id"`
+		BookingIDs []uint `json:"booking_ids"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Len(t, created.BookingIDs, 15)
+
+	seriesURL := "/series/" + strconv.Itoa(int(created.SeriesID))
+
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest("DELETE", seriesURL+"/occurrences/"+strconv.Itoa(int(created.BookingIDs[0])), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	other, err := app.jwtUtil.GenerateToken("user456", "user", "other@mail.com")
+	assert.NoError(t, err)
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", seriesURL, nil)
+	req.Header.Set("Authorization", "Bearer "+other)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", seriesURL, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"cancelled":14`)
+
+	app.db.Model(&models.Booking{}).Where("user_id = ? AND status = ?", "user123", models.BookingCancelled).Count(&count)
+	assert.Equal(t, int64(15), count)
+}
+
+func TestBookSeriesAcrossDSTChange(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+
+	location := models.Location{Name: "Lab", TimeZone: "Europe/Berlin"}
+	app.db.Create(&location)
+	room := models.Room{LocationID: location.ID, Name: "101"}
+	app.db.Create(&room)
+	app.db.Create(&models.Computer{Number: 1, Status: "available", RoomID: &room.ID})
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+
+	// Berlin leaves summer time on 2030-10-27; the session stays at 14:00
+	// local time, an hour later in UTC.
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/book", strings.NewReader(`{"computer_id": 1, "start_time": "2030-10-15T14:00:00+02:00", "end_time": "2030-10-15T16:00:00+02:00", "rrule": "FREQ=WEEKLY;COUNT=3"}`))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var bookings []models.Booking
+	app.db.Order("start_time").Find(&bookings)
+	var starts, ends []string
+	for _, booking := range bookings {
+		starts = append(starts, booking.StartTime.UTC().Format(time.RFC3339))
+		ends = append(ends, booking.EndTime.UTC().Format(time.RFC3339))
 	}
+	assert.Equal(t, []string{"2030-10-15T12:00:00Z", "2030-10-22T12:00:00Z", "2030-10-29T13:00:00Z"}, starts)
+	assert.Equal(t, []string{"2030-10-15T14:00:00Z", "2030-10-22T14:00:00Z", "2030-10-29T15:00:00Z"}, ends)
+}
 
-	err = db.AutoMigrate(&models.Computer{}, &models.Booking{})
-	if err != nil {
-		return nil, err
+func TestLocalRequestTimes(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+	// One caller books all of them at once.
+	app.config.Policy.MaxConcurrent = -1
+
+	location := models.Location{Name: "Lab", TimeZone: "Europe/Berlin"}
+	app.db.Create(&location)
+	room := models.Room{LocationID: location.ID, Name: "101"}
+	app.db.Create(&room)
+	for i := 1; i <= 3; i++ {
+		app.db.Create(&models.Computer{Number: i, Status: "available", RoomID: &room.ID})
 	}
 
-	jwtUtil := jwt.NewJWTUtil("test-secret")
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+	utc := func(t time.Time) string {
+		return t.UTC().Format(time.RFC3339)
+	}
 
-	app := &application{
-		router:  gin.New(),
-		db:      db,
-		logger:  logger,
-		jwtUtil: jwtUtil,
+	// Berlin is two hours ahead of UTC in summer.
+	assert.Equal(t, http.StatusBadRequest, request("POST", "/book", `{"computer_id": 1, "start_time": "10 o'clock", "end_time": "2030-06-01T12:00"}`).Code)
+	assert.Equal(t, http.StatusOK, request("POST", "/book", `{"computer_id": 1, "start_time": "2030-06-01T10:00", "end_time": "2030-06-01T12:00"}`).Code)
+	assert.Equal(t, http.StatusOK, request("PATCH", "/bookings/1", `{"end_time": "2030-06-01T12:30"}`).Code)
+	var booking models.Booking
+	app.db.First(&booking, 1)
+	assert.Equal(t, "2030-06-01T08:00:00Z", utc(booking.StartTime))
+	assert.Equal(t, "2030-06-01T10:30:00Z", utc(booking.EndTime))
+
+	assert.Equal(t, http.StatusCreated, request("POST", "/holds", `{"computer_id": 2, "start_time": "2030-06-01T10:00", "end_time": "2030-06-01T11:00"}`).Code)
+	var hold models.Booking
+	app.db.Where("computer_id = ?", 2).First(&hold)
+	assert.Equal(t, "2030-06-01T08:00:00Z", utc(hold.StartTime))
+
+	assert.Equal(t, http.StatusOK, request("POST", "/groups", `{"computer_ids": [3], "start_time": "2030-06-01T10:00", "end_time": "2030-06-01T11:00"}`).Code)
+	var group models.BookingGroup
+	app.db.First(&group)
+	assert.Equal(t, "2030-06-01T08:00:00Z", utc(group.StartTime))
+
+	assert.Equal(t, http.StatusCreated, request("POST", "/waitlist", `{"computer_id": 1, "start_time": "2030-06-01T11:00", "end_time": "2030-06-01T12:00"}`).Code)
+	var entry models.WaitlistEntry
+	app.db.First(&entry)
+	assert.Equal(t, "2030-06-01T09:00:00Z", utc(entry.StartTime))
+
+	// Only the booking ends after 12:15 local time.
+	w := request("GET", fmt.Sprintf("/me/bookings?when=all&location_id=%d&from=2030-06-01T12:15", location.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Bookings []struct{ ID uint } `json:"bookings"`
 	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Bookings, 1)
+	assert.Equal(t, http.StatusBadRequest, request("GET", "/me/bookings?from=noon", "").Code)
+}
 
-	app.initializeRoutes()
+func TestWaitlistOfferAndClaim(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+	rabbit := app.rabbit.(*testPublisher)
 
-	return app, nil
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	booking := models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)}
+	app.db.Create(&booking)
+
+	owner, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	waiter, err := app.jwtUtil.GenerateToken("user456", "user", "waiter@mail.com")
+	assert.NoError(t, err)
+	late, err := app.jwtUtil.GenerateToken("user789", "user", "late@mail.com")
+	assert.NoError(t, err)
+	stranger, err := app.jwtUtil.GenerateToken("user000", "user", "stranger@mail.com")
+	assert.NoError(t, err)
+
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := request("POST", "/waitlist", waiter, `{"start_time": "2030-06-01T13:00:00Z", "end_time": "2030-06-01T14:00:00Z"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = request("POST", "/waitlist", waiter, `{"computer_id": 1, "start_time": "2030-06-01T11:00:00Z", "end_time": "2030-06-01T12:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var entry models.WaitlistEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	claimURL := "/waitlist/" + strconv.Itoa(int(entry.ID)) + "/claim"
+
+	w = request("POST", "/waitlist", late, `{"computer_id": 1, "start_time": "2030-06-01T11:00:00Z", "end_time": "2030-06-01T12:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var lateEntry models.WaitlistEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &lateEntry))
+
+	w = request("POST", claimURL, waiter, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = request("DELETE", "/cancel/"+strconv.Itoa(int(booking.ID)), owner, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	app.db.First(&entry, entry.ID)
+	assert.Equal(t, models.WaitlistOffered, entry.Status)
+	assert.NotNil(t, entry.OfferExpiresAt)
+	assert.NotNil(t, entry.OfferedBookingID)
+
+	// The window is offered to one waiter only and held for them.
+	app.db.First(&lateEntry, lateEntry.ID)
+	assert.Equal(t, models.WaitlistWaiting, lateEntry.Status)
+	assert.Len(t, rabbit.sent("waitlist_offer"), 1)
+	w = request("POST", "/book", stranger, `{"computer_id": 1, "start_time": "2030-06-01T11:00:00Z", "end_time": "2030-06-01T12:00:00Z"}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	w = request("POST", claimURL, owner, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = request("POST", claimURL, waiter, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	app.db.First(&entry, entry.ID)
+	assert.Equal(t, models.WaitlistClaimed, entry.Status)
+
+	var count int64
+	app.db.Model(&models.Booking{}).Where("user_id = ?", "user456").Count(&count)
+	assert.Equal(t, int64(1), count)
+	var claimed models.Booking
+	app.db.First(&claimed, *entry.OfferedBookingID)
+	assert.Equal(t, models.BookingConfirmed, claimed.Status)
+	assert.Nil(t, claimed.HoldExpiresAt)
+
+	// When the waiter gives the window up it goes to the next in line, whose
+	// unclaimed offer lapses with its hold.
+	w = request("DELETE", "/cancel/"+strconv.Itoa(int(claimed.ID)), waiter, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	app.db.First(&lateEntry, lateEntry.ID)
+	assert.Equal(t, models.WaitlistOffered, lateEntry.Status)
+	assert.Len(t, rabbit.sent("waitlist_offer"), 2)
+
+	assert.NoError(t, app.expireWaitlistOffers(time.Now().Add(time.Hour)))
+	app.db.First(&lateEntry, lateEntry.ID)
+	assert.Equal(t, models.WaitlistExpired, lateEntry.Status)
+	var lapsed models.Booking
+	app.db.First(&lapsed, *lateEntry.OfferedBookingID)
+	assert.Equal(t, models.BookingCancelled, lapsed.Status)
 }
 
-func TestBookComputer(t *testing.T) {
+func TestWaitlistOfferChargedOnClaim(t *testing.T) {
 	app, err := setupTestApp()
 	assert.NoError(t, err)
+	allowBookingAhead(app)
+	app.db.Create(&models.Tariff{Name: "Standard", Currency: "EUR", HourlyRate: 400})
 
 	computer := models.Computer{Number: 1, Status: "available"}
 	app.db.Create(&computer)
 
-	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
 	assert.NoError(t, err)
+	booking := models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)}
+	app.db.Create(&booking)
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("POST", "/book", strings.NewReader(`{"computer_id": 1, "start_time": "2024-06-01T10:00:00Z", "end_time": "2024-06-01T12:00:00Z"}`))
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Content-Type", "application/json")
+	adminToken, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+	owner, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	waiter, err := app.jwtUtil.GenerateToken("user456", "user", "waiter@mail.com")
+	assert.NoError(t, err)
+	request := func(method, url, token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
 
-	app.router.ServeHTTP(w, req)
+	w := request("POST", "/waitlist", waiter, `{"computer_id": 1, "start_time": "2030-06-01T11:00:00Z", "end_time": "2030-06-01T12:00:00Z"}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var entry models.WaitlistEntry
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &entry))
+	claimURL := "/waitlist/" + strconv.Itoa(int(entry.ID)) + "/claim"
+
+	// The waiter is offered the window though their wallet is empty.
+	assert.Equal(t, http.StatusOK, request("DELETE", "/cancel/"+strconv.Itoa(int(booking.ID)), owner, "").Code)
+	app.db.First(&entry, entry.ID)
+	assert.Equal(t, models.WaitlistOffered, entry.Status)
 
+	// Claiming without the money leaves the offer open.
+	w = request("POST", claimURL, waiter, "")
+	assert.Equal(t, http.StatusPaymentRequired, w.Code)
+	app.db.First(&entry, entry.ID)
+	assert.Equal(t, models.WaitlistOffered, entry.Status)
+	var hold models.Booking
+	app.db.First(&hold, *entry.OfferedBookingID)
+	assert.Equal(t, models.BookingPending, hold.Status)
+
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/wallets/user456/entries", adminToken, `{"kind": "top_up", "currency": "EUR", "amount": 1000}`).Code)
+	w = request("POST", claimURL, waiter, "")
 	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, w.Body.String(), "Computer booked successfully")
+
+	var wallet models.Wallet
+	assert.NoError(t, app.db.Where("user_id = ? AND currency = ?", "user456", "EUR").First(&wallet).Error)
+	assert.Equal(t, int64(600), wallet.Balance)
+	app.db.First(&hold, hold.ID)
+	assert.Equal(t, models.BookingConfirmed, hold.Status)
 }
 
-func TestGetAvailableComputers(t *testing.T) {
+func TestCheckInAndCheckOut(t *testing.T) {
 	app, err := setupTestApp()
 	assert.NoError(t, err)
 
-	db2.SeedComputers(app.db)
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/available", nil)
+	now := time.Now()
+	current := models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: now.Add(-5 * time.Minute), EndTime: now.Add(time.Hour)}
+	app.db.Create(&current)
+	later := models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: now.Add(2 * time.Hour), EndTime: now.Add(3 * time.Hour)}
+	app.db.Create(&later)
 
-	var computers []models.Computer
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
 
-	err = json.Unmarshal(w.Body.Bytes(), &computers)
-	if err != nil {
-		return
+	post := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		app.router.ServeHTTP(w, req)
+		return w
 	}
-	app.router.ServeHTTP(w, req)
-	assert.Equal(t, http.StatusOK, w.Code)
-	assert.Contains(t, len(computers), 6)
+
+	assert.Equal(t, http.StatusConflict, post("/bookings/"+strconv.Itoa(int(later.ID))+"/check-in").Code)
+	assert.Equal(t, http.StatusConflict, post("/bookings/"+strconv.Itoa(int(current.ID))+"/check-out").Code)
+	assert.Equal(t, http.StatusOK, post("/bookings/"+strconv.Itoa(int(current.ID))+"/check-in").Code)
+	assert.Equal(t, http.StatusOK, post("/bookings/"+strconv.Itoa(int(current.ID))+"/check-out").Code)
+
+	app.db.First(&current, current.ID)
+	assert.Equal(t, models.BookingCompleted, current.Status)
+
+	app.db.First(&computer, computer.ID)
+	assert.Equal(t, "available", computer.Status)
+}
+
+func TestMarkNoShows(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	computer := models.Computer{Number: 1, Status: "booked"}
+	app.db.Create(&computer)
+
+	now := time.Now()
+	missed := models.Booking{UserID: "user123", Email: "email@mail.com", ComputerID: computer.ID, StartTime: now.Add(-30 * time.Minute), EndTime: now.Add(time.Hour)}
+	app.db.Create(&missed)
+	other := models.Booking{UserID: "user456", ComputerID: computer.ID, StartTime: now.Add(-70 * time.Minute), EndTime: now.Add(-40 * time.Minute)}
+	app.db.Create(&other)
+	app.db.Model(&other).Update("status", models.BookingCheckedIn)
+	recent := models.Booking{UserID: "user789", ComputerID: computer.ID, StartTime: now.Add(2 * time.Hour), EndTime: now.Add(3 * time.Hour)}
+	app.db.Create(&recent)
+
+	marked, err := app.markNoShows(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, marked)
+
+	app.db.First(&missed, missed.ID)
+	assert.Equal(t, models.BookingNoShow, missed.Status)
+	app.db.First(&recent, recent.ID)
+	assert.Equal(t, models.BookingConfirmed, recent.Status)
+
+	app.db.First(&computer, computer.ID)
+	assert.Equal(t, "available", computer.Status)
+}
+
+func TestFinalizeBookings(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	computer := models.Computer{Number: 1, Status: "booked"}
+	app.db.Create(&computer)
+	idle := models.Computer{Number: 2, Status: "available"}
+	app.db.Create(&idle)
+
+	now := time.Now()
+	ended := models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: now.Add(-2 * time.Hour), EndTime: now.Add(-time.Minute)}
+	app.db.Create(&ended)
+	app.db.Model(&ended).Update("status", models.BookingCheckedIn)
+	started := models.Booking{UserID: "user456", ComputerID: idle.ID, StartTime: now.Add(-time.Minute), EndTime: now.Add(time.Hour)}
+	app.db.Create(&started)
+
+	finalized, err := app.finalizeBookings(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, finalized)
+	assert.NoError(t, app.refreshComputerStatuses())
+
+	app.db.First(&ended, ended.ID)
+	assert.Equal(t, models.BookingCompleted, ended.Status)
+
+	app.db.First(&computer, computer.ID)
+	assert.Equal(t, "available", computer.Status)
+	app.db.First(&idle, idle.ID)
+	assert.Equal(t, "booked", idle.Status)
+}
+
+func TestSendDueReminders(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	rabbit := app.rabbit.(*testPublisher)
+
+	computer := models.Computer{Number: 7, Status: "available"}
+	app.db.Create(&computer)
+
+	now := time.Now()
+	booking := models.Booking{UserID: "user123", Email: "email@mail.com", ComputerID: computer.ID, StartTime: now.Add(20 * time.Hour), EndTime: now.Add(22 * time.Hour)}
+	app.db.Create(&booking)
+	app.db.Model(&booking).Update("created_at", now.Add(-48*time.Hour))
+	cancelled := models.Booking{UserID: "user456", Email: "other@mail.com", ComputerID: computer.ID, StartTime: now.Add(10 * time.Minute), EndTime: now.Add(time.Hour)}
+	app.db.Create(&cancelled)
+	app.db.Model(&cancelled).Updates(map[string]interface{}{"created_at": now.Add(-48 * time.Hour), "status": models.BookingCancelled})
+
+	sent, err := app.sendDueReminders(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	// A restart re-running the job does not send the reminder again.
+	sent, err = app.sendDueReminders(now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+
+	reminders := rabbit.sent("booking_reminder")
+	assert.Len(t, reminders, 1)
+	assert.Equal(t, "email@mail.com", reminders[0].Recipient)
+	assert.Contains(t, reminders[0].Message, "computer #7")
+
+	// Moving the booking re-arms its reminders.
+	app.db.Model(&booking).Updates(map[string]interface{}{"start_time": now.Add(10 * time.Minute), "end_time": now.Add(time.Hour)})
+	sent, err = app.sendDueReminders(now)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sent)
+
+	sent, err = app.sendDueReminders(now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, sent)
+}
+
+func TestRescheduleBooking(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+	rabbit := app.rabbit.(*testPublisher)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	booking := models.Booking{UserID: "user123", Email: "email@mail.com", ComputerID: computer.ID, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)}
+	app.db.Create(&booking)
+	other := models.Booking{UserID: "user456", ComputerID: computer.ID, StartTime: stTime.Add(3 * time.Hour), EndTime: stTime.Add(4 * time.Hour)}
+	app.db.Create(&other)
+
+	owner, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	stranger, err := app.jwtUtil.GenerateToken("user456", "user", "other@mail.com")
+	assert.NoError(t, err)
+
+	url := "/bookings/" + strconv.Itoa(int(booking.ID))
+	patch := func(token, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("PATCH", url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, patch(stranger, `{"end_time": "2030-06-01T12:30:00Z"}`).Code)
+	assert.Equal(t, http.StatusConflict, patch(owner, `{"end_time": "2030-06-01T13:30:00Z"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, patch(owner, `{"end_time": "2030-06-01T09:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusOK, patch(owner, `{"end_time": "2030-06-01T13:00:00Z"}`).Code)
+	assert.Equal(t, http.StatusOK, patch(owner, `{"start_time": "2030-06-01T14:00:00Z", "end_time": "2030-06-01T15:00:00Z"}`).Code)
+
+	app.db.First(&booking, booking.ID)
+	assert.Equal(t, "2030-06-01T14:00:00Z", booking.StartTime.UTC().Format(time.RFC3339))
+	assert.Equal(t, "2030-06-01T15:00:00Z", booking.EndTime.UTC().Format(time.RFC3339))
+	assert.Len(t, rabbit.sent("booking_changed"), 2)
+
+	app.db.Model(&booking).Update("status", models.BookingCancelled)
+	assert.Equal(t, http.StatusConflict, patch(owner, `{"end_time": "2030-06-01T16:00:00Z"}`).Code)
+}
+
+func TestGetMyBookings(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	computer := models.Computer{Number: 9, Status: "available"}
+	app.db.Create(&computer)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for i := 1; i <= 5; i++ {
+		app.db.Create(&models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: now.Add(time.Duration(i) * 24 * time.Hour), EndTime: now.Add(time.Duration(i)*24*time.Hour + time.Hour)})
+	}
+	past := models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: now.Add(-48 * time.Hour), EndTime: now.Add(-47 * time.Hour)}
+	app.db.Create(&past)
+	app.db.Model(&past).Update("status", models.BookingCompleted)
+	app.db.Create(&models.Booking{UserID: "user456", ComputerID: computer.ID, StartTime: now.Add(-24 * time.Hour), EndTime: now.Add(-23 * time.Hour)})
+
+	token, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+
+	type page struct {
+		Bookings []struct {
+			ID             uint
+			Status         string
+			ComputerNumber int
+		} `json:"bookings"`
+		NextCursor string `json:"next_cursor"`
+	}
+	get := func(query string) (int, page) {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/me/bookings?"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		app.router.ServeHTTP(w, req)
+
+		var result page
+		_ = json.Unmarshal(w.Body.Bytes(), &result)
+		return w.Code, result
+	}
+
+	code, first := get("when=upcoming&limit=2")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, first.Bookings, 2)
+	assert.Equal(t, 9, first.Bookings[0].ComputerNumber)
+	assert.NotEmpty(t, first.NextCursor)
+
+	seen := map[uint]bool{}
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		_, result := get("when=upcoming&limit=2&cursor=" + cursor)
+		for _, booking := range result.Bookings {
+			assert.False(t, seen[booking.ID])
+			seen[booking.ID] = true
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		cursor = result.NextCursor
+	}
+	assert.Len(t, seen, 5)
+
+	_, history := get("when=past")
+	assert.Len(t, history.Bookings, 1)
+	assert.Equal(t, past.ID, history.Bookings[0].ID)
+
+	_, completed := get("status=completed,cancelled")
+	assert.Len(t, completed.Bookings, 1)
+
+	_, ranged := get("from=" + now.Add(36*time.Hour).Format(time.RFC3339) + "&to=" + now.Add(60*time.Hour).Format(time.RFC3339))
+	assert.Len(t, ranged.Bookings, 1)
+
+	code, _ = get("when=someday")
+	assert.Equal(t, http.StatusBadRequest, code)
 }
 
 func TestCancelBooking(t *testing.T) {
@@ -122,6 +2286,133 @@ func TestCancelBooking(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 	assert.Contains(t, w.Body.String(), "Booking cancelled")
+
+	app.db.First(&booking, booking.ID)
+	assert.Equal(t, models.BookingCancelled, booking.Status)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/cancel/"+strconv.Itoa(int(booking.ID)), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	app.router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestAdminBookingTransitions(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+
+	computer := models.Computer{Number: 1, Status: "available"}
+	app.db.Create(&computer)
+
+	stTime, err := time.Parse(time.RFC3339, "2030-06-01T10:00:00Z")
+	assert.NoError(t, err)
+
+	booking := models.Booking{UserID: "user123", ComputerID: computer.ID, StartTime: stTime, EndTime: stTime.Add(2 * time.Hour)}
+	app.db.Create(&booking)
+
+	token, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+
+	url := "/admin/bookings/" + strconv.Itoa(int(booking.ID)) + "/transitions"
+	transition := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusConflict, transition(`{"status": "completed"}`).Code)
+	assert.Equal(t, http.StatusOK, transition(`{"status": "checked_in", "reason": "at the desk"}`).Code)
+	assert.Equal(t, http.StatusConflict, transition(`{"status": "cancelled"}`).Code)
+	assert.Equal(t, http.StatusOK, transition(`{"status": "completed"}`).Code)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", url, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var history []models.BookingTransition
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 2)
+	assert.Equal(t, models.BookingConfirmed, history[0].FromStatus)
+	assert.Equal(t, models.BookingCheckedIn, history[0].ToStatus)
+	assert.Equal(t, "admin1", history[0].ActorID)
+	assert.Equal(t, "at the desk", history[0].Reason)
+	assert.Equal(t, models.BookingCompleted, history[1].ToStatus)
+
+	// A completed booking no longer blocks its window.
+	conflict, err := findConflict(app.db, computer.ID, booking.StartTime, booking.EndTime, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, conflict)
+}
+
+func TestAdminCreateAndUpdateBooking(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	allowBookingAhead(app)
+	app.db.Create(&models.Computer{Number: 1, Status: "available"})
+	app.db.Create(&models.Computer{Number: 2, Status: "retired"})
+	app.db.Create(&models.Tariff{Name: "Standard", Currency: "EUR", HourlyRate: 400})
+
+	start, err := time.Parse(time.RFC3339, "2030-06-03T09:00:00Z")
+	assert.NoError(t, err)
+	end := start.Add(time.Hour)
+	serviced := start.Add(5 * time.Hour)
+	app.db.Create(&models.MaintenanceWindow{ComputerID: 1, Reason: "New disk", ReportedBy: "admin1", StartTime: start.Add(4 * time.Hour), ExpectedEnd: &serviced})
+
+	token, err := app.jwtUtil.GenerateToken("admin1", "admin", "admin@mail.com")
+	assert.NoError(t, err)
+	request := func(method, url, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		app.router.ServeHTTP(w, req)
+		return w
+	}
+	balance := func() int64 {
+		var wallet models.Wallet
+		app.db.Where("user_id = ? AND currency = ?", "user123", "EUR").First(&wallet)
+		return wallet.Balance
+	}
+	assert.Equal(t, http.StatusCreated, request("POST", "/admin/wallets/user123/entries", `{"kind": "top_up", "currency": "EUR", "amount": 1000}`).Code)
+
+	newBooking := func(computerID int, from, to time.Time) string {
+		return fmt.Sprintf(`{"user_id": "user123", "computer_id": %d, "start_time": %q, "end_time": %q}`, computerID, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	booking := func(computerID int, from, to time.Time) string {
+		return fmt.Sprintf(`{"UserID": "user123", "ComputerID": %d, "StartTime": %q, "EndTime": %q}`, computerID, from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+	assert.Equal(t, http.StatusNotFound, request("POST", "/admin/bookings", newBooking(9, start, end)).Code)
+	assert.Equal(t, http.StatusConflict, request("POST", "/admin/bookings", newBooking(2, start, end)).Code)
+	w := request("POST", "/admin/bookings", newBooking(1, start.Add(4*time.Hour), end.Add(4*time.Hour)))
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), "New disk")
+
+	// Fields other than the booking's owner, computer, window and status are
+	// ignored.
+	w = request("POST", "/admin/bookings", fmt.Sprintf(`{"id": 99, "user_id": "user123", "computer_id": 1, "start_time": %q, "end_time": %q, "Price": 0, "SeriesID": 7}`,
+		start.Format(time.RFC3339), end.Format(time.RFC3339)))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int64(600), balance())
+	var created models.Booking
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEqual(t, uint(99), created.ID)
+	assert.Nil(t, created.SeriesID)
+
+	// Moving the booking prices it afresh.
+	url := "/admin/bookings/" + strconv.Itoa(int(created.ID))
+	assert.Equal(t, http.StatusOK, request("PUT", url, booking(1, start, end.Add(time.Hour))).Code)
+	assert.Equal(t, int64(200), balance())
+	assert.Equal(t, http.StatusNotFound, request("PUT", url, booking(9, start, end)).Code)
+	assert.Equal(t, http.StatusConflict, request("PUT", url, booking(1, start, end.Add(4*time.Hour))).Code)
+	assert.Equal(t, http.StatusOK, request("PUT", url, booking(1, start, start.Add(30*time.Minute))).Code)
+	assert.Equal(t, int64(800), balance())
 }
 
 func TestAdminCreateComputer(t *testing.T) {
@@ -159,3 +2450,44 @@ func TestAdminMiddleware(t *testing.T) {
 	assert.Equal(t, http.StatusForbidden, w.Code)
 	assert.Contains(t, w.Body.String(), "Forbidden")
 }
+
+func TestNewPaymentProvider(t *testing.T) {
+	defer gin.SetMode(gin.Mode())
+	gin.SetMode(gin.DebugMode)
+
+	provider, err := newPaymentProvider(&config.Config{})
+	assert.NoError(t, err)
+	assert.Nil(t, provider, "payments are disabled without a provider")
+	_, err = newPaymentProvider(&config.Config{PaymentProvider: "fake"})
+	assert.Error(t, err, "webhook secret is required")
+	_, err = newPaymentProvider(&config.Config{PaymentProvider: "stripe", PaymentWebhookSecret: "secret"})
+	assert.Error(t, err)
+
+	provider, err = newPaymentProvider(&config.Config{PaymentProvider: "fake", PaymentWebhookSecret: "secret"})
+	assert.NoError(t, err)
+	assert.Equal(t, "fake", provider.Name())
+
+	gin.SetMode(gin.ReleaseMode)
+	_, err = newPaymentProvider(&config.Config{PaymentProvider: "fake", PaymentWebhookSecret: "secret"})
+	assert.Error(t, err, "fake provider is refused in release mode")
+}
+
+func TestPaymentsDisabled(t *testing.T) {
+	app, err := setupTestApp()
+	assert.NoError(t, err)
+	app.payments = nil
+
+	userToken, err := app.jwtUtil.GenerateToken("user123", "user", "email@mail.com")
+	assert.NoError(t, err)
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/me/wallet/top-ups", strings.NewReader(`{"amount": 1000, "currency": "EUR"}`))
+	req.Header.Set("Authorization", "Bearer "+userToken)
+	req.Header.Set("Content-Type", "application/json")
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("POST", "/payments/webhook", strings.NewReader(`{}`))
+	app.router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
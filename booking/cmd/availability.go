@@ -0,0 +1,268 @@
+package main
+
+import (
+	db2 "booking/internal/db"
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"sort"
+	"time"
+)
+
+var errInvalidWindow = errors.New("end_time must be after start_time")
+
+// overlapping narrows a booking query to rows whose [start_time, end_time)
+// interval intersects [from, to). A zero-length window matches bookings that
+// are in progress at that instant.
+func overlapping(query *gorm.DB, from, to time.Time) *gorm.DB {
+	if !to.After(from) {
+		return query.Where("start_time <= ? AND end_time > ?", from, from)
+	}
+	return query.Where("start_time < ? AND end_time > ?", to, from)
+}
+
+// activeBookings starts a query over the bookings that still occupy their
+// computer.
+func activeBookings(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Booking{}).Where("status IN ?", models.ActiveBookingStatuses)
+}
+
+// findConflict returns the earliest active booking on computerID that overlaps
+// [start, end), ignoring the booking with id excludeID. It returns nil when the
+// window is free.
+func findConflict(db *gorm.DB, computerID uint, start, end time.Time, excludeID uint) (*models.Booking, error) {
+	query := overlapping(activeBookings(db), start, end).Where("computer_id = ?", computerID)
+	if excludeID != 0 {
+		query = query.Where("id <> ?", excludeID)
+	}
+
+	var conflict models.Booking
+	err := query.Order("start_time").First(&conflict).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &conflict, nil
+}
+
+// bookableStatuses are the computer statuses that may take new bookings.
+// Occupancy is derived from bookings, so both available and booked computers
+// qualify. So do computers under maintenance: the maintenance windows decide
+// which times are blocked.
+var bookableStatuses = []string{models.ComputerAvailable, models.ComputerBooked, models.ComputerMaintenance}
+
+// isBookable reports whether the computer is in service.
+func isBookable(computer *models.Computer) bool {
+	for _, status := range bookableStatuses {
+		if computer.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// availableComputers returns the in-service computers with no active booking
+// or maintenance overlapping [from, to) whose location is open throughout. A
+// non-nil scope is a subquery of computer ids to choose from.
+func availableComputers(db *gorm.DB, scope *gorm.DB, from, to time.Time) ([]models.Computer, error) {
+	busy := overlapping(activeBookings(db), from, to).Select("computer_id")
+
+	query := db.Where("status IN ?", bookableStatuses).
+		Where("id NOT IN (?)", busy).
+		Where("id NOT IN (?)", underMaintenance(db, from, to).Select("computer_id"))
+	if scope != nil {
+		query = query.Where("id IN (?)", scope)
+	}
+
+	var computers []models.Computer
+	if err := query.Order("number").Find(&computers).Error; err != nil {
+		return nil, err
+	}
+
+	window := schedule.Interval{Start: from, End: to}
+	if window.Empty() {
+		window.End = window.Start.Add(time.Nanosecond)
+	}
+	closed, err := closedPeriods(db, computers, window)
+	if err != nil {
+		return nil, err
+	}
+	open := computers[:0]
+	for _, computer := range computers {
+		if len(closed[computer.ID]) == 0 {
+			open = append(open, computer)
+		}
+	}
+	return open, nil
+}
+
+// isBlocked reports whether maintenance, or the computer's location being
+// closed, keeps the computer from being booked for some part of window.
+func isBlocked(db *gorm.DB, computerID uint, window schedule.Interval) (bool, error) {
+	var maintenance int64
+	if err := underMaintenance(db, window.Start, window.End).
+		Where("computer_id = ?", computerID).
+		Count(&maintenance).Error; err != nil {
+		return false, err
+	}
+	if maintenance > 0 {
+		return true, nil
+	}
+
+	var computer models.Computer
+	if err := db.First(&computer, computerID).Error; err != nil {
+		return false, err
+	}
+	closed, err := closedPeriods(db, []models.Computer{computer}, window)
+	if err != nil {
+		return false, err
+	}
+	return len(closed[computerID]) > 0, nil
+}
+
+// parseWindow reads the optional from/to query parameters as RFC 3339
+// timestamps, or as local timestamps in zone. from defaults to now and to
+// defaults to from.
+func parseWindow(c *gin.Context, zone *time.Location) (time.Time, time.Time, error) {
+	from := time.Now()
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := parseTime(raw, zone)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		from = parsed
+	}
+
+	to := from
+	if raw := c.Query("to"); raw != "" {
+		parsed, err := parseTime(raw, zone)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to = parsed
+	}
+
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, errInvalidWindow
+	}
+	return from, to, nil
+}
+
+// conflictResponse writes a 409 naming the booking that holds the window. The
+// booking is nil when the database guard caught an overlap the application
+// check did not see.
+func conflictResponse(c *gin.Context, conflict *models.Booking) {
+	response := gin.H{"error": "Computer is already booked for the requested time"}
+	if conflict != nil {
+		response["conflict"] = gin.H{
+			"booking_id": conflict.ID,
+			"start_time": conflict.StartTime,
+			"end_time":   conflict.EndTime,
+		}
+	}
+	c.JSON(http.StatusConflict, response)
+}
+
+var errBookingChanged = errors.New("booking was changed by another request")
+
+type conflictError struct {
+	booking *models.Booking
+}
+
+func (e *conflictError) Error() string {
+	return "computer is already booked for the requested time"
+}
+
+// bookingTx runs fn in a transaction that first locks the rows of the given
+// computers, so that concurrent writers to the same computer's bookings are
+// serialised. Overlaps rejected by the database guard are reported as a
+// *conflictError like the ones fn returns itself.
+func (app *application) bookingTx(computerIDs []uint, fn func(tx *gorm.DB) error) error {
+	ids := append([]uint(nil), computerIDs...)
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		// Locking in id order keeps two multi-computer transactions from
+		// deadlocking each other.
+		var computers []models.Computer
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id IN ?", ids).
+			Order("id").
+			Find(&computers).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+	if db2.IsOverlapError(err) {
+		return &conflictError{}
+	}
+	return err
+}
+
+// reserve prices the booking and inserts it if its window is free, charging
+// the price to the owner's wallet. It must run inside bookingTx.
+func reserve(tx *gorm.DB, booking *models.Booking) error {
+	conflict, err := findConflict(tx, booking.ComputerID, booking.StartTime, booking.EndTime, booking.ID)
+	if err != nil {
+		return err
+	}
+	if conflict != nil {
+		return &conflictError{booking: conflict}
+	}
+	if err := priceBooking(tx, booking); err != nil {
+		return err
+	}
+	if err := tx.Create(booking).Error; err != nil {
+		return err
+	}
+	return chargeBooking(tx, booking)
+}
+
+// bookingErrorResponse writes the response for an error returned by
+// bookingTx, using message for unexpected failures.
+func (app *application) bookingErrorResponse(c *gin.Context, err error, message string) {
+	var conflict *conflictError
+	var funds *fundsError
+	switch {
+	case errors.As(err, &conflict):
+		conflictResponse(c, conflict.booking)
+	case errors.As(err, &funds):
+		fundsResponse(c, http.StatusPaymentRequired, funds)
+	case errors.Is(err, errBookingChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking was changed by another request, please retry"})
+	default:
+		app.logger.Error(message + ": " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
+
+// refreshComputerStatus sets the computer's occupancy status from the bookings
+// in progress right now. Statuses other than available/booked are set by admins
+// or maintenance windows and left untouched.
+func refreshComputerStatus(db *gorm.DB, computer *models.Computer) error {
+	if computer.Status != models.ComputerAvailable && computer.Status != models.ComputerBooked {
+		return nil
+	}
+
+	now := time.Now()
+	conflict, err := findConflict(db, computer.ID, now, now, 0)
+	if err != nil {
+		return err
+	}
+
+	status := models.ComputerAvailable
+	if conflict != nil {
+		status = models.ComputerBooked
+	}
+	if status == computer.Status {
+		return nil
+	}
+	computer.Status = status
+	return db.Model(computer).Update("status", status).Error
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"booking/internal/models"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// findOwnBooking loads the booking from the :id parameter and checks that it
+// belongs to the caller. It writes the error response itself.
+func (app *application) findOwnBooking(c *gin.Context) (*models.Booking, bool) {
+	var booking models.Booking
+	if err := app.db.First(&booking, c.Param("id")).Error; err != nil {
+		app.logger.Error("Booking not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return nil, false
+	}
+
+	if booking.UserID != c.GetString("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own bookings"})
+		return nil, false
+	}
+	return &booking, true
+}
+
+// checkIn marks the caller as present. Check-in opens CheckInEarly before the
+// booking starts and closes once the no-show grace period has passed.
+func (app *application) checkIn(c *gin.Context) {
+	booking, ok := app.findOwnBooking(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	opens := booking.StartTime.Add(-app.config.CheckInEarly)
+	closes := booking.StartTime.Add(app.config.NoShowGracePeriod)
+	if closes.After(booking.EndTime) {
+		closes = booking.EndTime
+	}
+	if now.Before(opens) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Check-in opens at " + opens.Format(time.RFC3339)})
+		return
+	}
+	if now.After(closes) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Check-in closed at " + closes.Format(time.RFC3339)})
+		return
+	}
+
+	if err := app.transitionBooking(app.db, booking, models.BookingCheckedIn, booking.UserID, "checked in by user"); err != nil {
+		app.transitionResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, booking)
+}
+
+// checkOut ends the session; leaving early frees the computer for the rest of
+// the window.
+func (app *application) checkOut(c *gin.Context) {
+	booking, ok := app.findOwnBooking(c)
+	if !ok {
+		return
+	}
+
+	if err := app.transitionBooking(app.db, booking, models.BookingCompleted, booking.UserID, "checked out by user"); err != nil {
+		app.transitionResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, booking)
+}
+
+// markNoShows moves confirmed bookings whose grace period has passed without a
+// check-in to no_show, which frees their computers, and notifies the owners.
+func (app *application) markNoShows(now time.Time) (int, error) {
+	var bookings []models.Booking
+	if err := app.db.Where("status = ? AND start_time < ?", models.BookingConfirmed, now.Add(-app.config.NoShowGracePeriod)).
+		Find(&bookings).Error; err != nil {
+		return 0, err
+	}
+
+	reason := fmt.Sprintf("not checked in within %s of the start time", app.config.NoShowGracePeriod)
+	marked := 0
+	for i := range bookings {
+		booking := &bookings[i]
+		if err := app.transitionBooking(app.db, booking, models.BookingNoShow, systemActor, reason); err != nil {
+			app.logger.Error("Failed to mark booking " + strconv.Itoa(int(booking.ID)) + " as no-show: " + err.Error())
+			continue
+		}
+		marked++
+
+		if booking.Email == "" {
+			continue
+		}
+		err := app.notify(booking.Email, "booking_no_show", "Booking released",
+			fmt.Sprintf("You did not check in to your booking starting %s, so it was marked as a no-show.", app.localTime(booking.ComputerID, booking.StartTime)),
+			"The computer has been released for other users.",
+		)
+		if err != nil {
+			app.logger.Error("Failed to send no-show notification: " + err.Error())
+		}
+	}
+	return marked, nil
+}
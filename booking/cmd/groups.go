@@ -0,0 +1,317 @@
+package main
+
+import (
+	"booking/internal/floorplan"
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxGroupSize = 50
+
+// bookGroup books several computers for the same window in one transaction.
+// The computers are either listed explicitly or picked as the first run of
+// adjacent free seats, optionally within one room or location. Times without
+// an offset are read with groupZone.
+func (app *application) bookGroup(c *gin.Context) {
+	var request struct {
+		Size        int    `json:"size"`
+		ComputerIDs []uint `json:"computer_ids"`
+		RoomID      uint   `json:"room_id"`
+		LocationID  uint   `json:"location_id"`
+		StartTime   string `json:"start_time"`
+		EndTime     string `json:"end_time"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	window, ok := parseRequestWindow(c, request.StartTime, request.EndTime, app.groupZone(request.ComputerIDs, request.RoomID, request.LocationID))
+	if !ok {
+		return
+	}
+
+	computerIDs := request.ComputerIDs
+	if len(computerIDs) > 0 {
+		if request.Size != 0 && request.Size != len(computerIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size does not match the number of computers"})
+			return
+		}
+		if !app.checkGroupComputers(c, computerIDs) {
+			return
+		}
+	} else {
+		if request.Size < 1 || request.Size > maxGroupSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be between 1 and " + strconv.Itoa(maxGroupSize)})
+			return
+		}
+
+		found, err := app.findAdjacentComputers(request.RoomID, request.LocationID, request.Size, window.Start, window.End)
+		if err != nil {
+			app.logger.Error("Failed to check availability: " + err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check availability"})
+			return
+		}
+		if found == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "No " + strconv.Itoa(request.Size) + " adjacent computers are free for the requested time"})
+			return
+		}
+		computerIDs = found
+	}
+
+	// Every computer is booked for the same window, but an explicit list may
+	// span locations. The group counts as a single booking towards the
+	// caller's quotas, checked against the rules of each location involved.
+	windows := []schedule.Interval{window}
+	locations := make(map[uint]bool)
+	for _, computerID := range computerIDs {
+		if !app.checkMaintenance(c, computerID, windows) || !app.checkOpeningHours(c, computerID, windows) {
+			return
+		}
+		var locationID uint
+		if location := app.computerLocation(computerID); location != nil {
+			locationID = location.ID
+		}
+		if locations[locationID] {
+			continue
+		}
+		locations[locationID] = true
+		if !app.checkPolicy(c, computerID, windows, nil) {
+			return
+		}
+	}
+
+	group := models.BookingGroup{
+		UserID:    c.GetString("userID"),
+		StartTime: window.Start,
+		EndTime:   window.End,
+	}
+	bookings := make([]models.Booking, 0, len(computerIDs))
+	err := app.bookingTx(computerIDs, func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		for _, computerID := range computerIDs {
+			booking := models.Booking{
+				UserID:     group.UserID,
+				Email:      c.GetString("email"),
+				ComputerID: computerID,
+				StartTime:  window.Start,
+				EndTime:    window.End,
+				Status:     models.BookingConfirmed,
+				GroupID:    &group.ID,
+			}
+			if err := reserve(tx, &booking); err != nil {
+				return err
+			}
+			bookings = append(bookings, booking)
+		}
+		return nil
+	})
+	if err != nil {
+		app.bookingErrorResponse(c, err, "Failed to create group booking")
+		return
+	}
+
+	var computers []models.Computer
+	if err := app.db.Where("id IN ?", computerIDs).Order("number").Find(&computers).Error; err != nil {
+		app.logger.Error("Failed to retrieve computers: " + err.Error())
+	}
+	numbers := make([]string, 0, len(computers))
+	for i := range computers {
+		if err := refreshComputerStatus(app.db, &computers[i]); err != nil {
+			app.logger.Error("Failed to update computer status: " + err.Error())
+		}
+		numbers = append(numbers, strconv.Itoa(computers[i].Number))
+	}
+
+	err = app.sendMail(c.GetString("email"), app.localTime(computerIDs[0], group.StartTime), strings.Join(numbers, ", "))
+	if err != nil {
+		app.logger.Error("Failed to send email: " + err.Error())
+	}
+
+	ids := make([]uint, 0, len(bookings))
+	for _, booking := range bookings {
+		ids = append(ids, booking.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":      "Computers booked successfully",
+		"group_id":     group.ID,
+		"booking_ids":  ids,
+		"computer_ids": computerIDs,
+	})
+}
+
+// checkGroupComputers checks that an explicit list names distinct, existing,
+// in-service computers. It writes the error response itself.
+func (app *application) checkGroupComputers(c *gin.Context, computerIDs []uint) bool {
+	if len(computerIDs) > maxGroupSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A group may book at most " + strconv.Itoa(maxGroupSize) + " computers"})
+		return false
+	}
+
+	seen := make(map[uint]bool, len(computerIDs))
+	for _, id := range computerIDs {
+		if seen[id] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "computer_ids must not repeat"})
+			return false
+		}
+		seen[id] = true
+	}
+
+	var computers []models.Computer
+	if err := app.db.Where("id IN ?", computerIDs).Find(&computers).Error; err != nil {
+		app.logger.Error("Failed to retrieve computers: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve computers"})
+		return false
+	}
+	if len(computers) != len(computerIDs) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Computer not found"})
+		return false
+	}
+	for i := range computers {
+		if !isBookable(&computers[i]) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Computer " + strconv.Itoa(computers[i].Number) + " is out of service"})
+			return false
+		}
+	}
+	return true
+}
+
+// groupZone returns the time zone a group request's times are read in: that
+// of the first listed computer, else of the room or location searched, else
+// UTC.
+func (app *application) groupZone(computerIDs []uint, roomID, locationID uint) *time.Location {
+	if len(computerIDs) > 0 {
+		return app.computerZone(computerIDs[0])
+	}
+	if roomID != 0 {
+		var room models.Room
+		if err := app.db.First(&room, roomID).Error; err != nil {
+			return time.UTC
+		}
+		locationID = room.LocationID
+	}
+	if locationID == 0 {
+		return time.UTC
+	}
+
+	var location models.Location
+	if err := app.db.First(&location, locationID).Error; err != nil {
+		return time.UTC
+	}
+	return location.Zone()
+}
+
+// findAdjacentComputers looks for size adjacent computers that are free for
+// the window, room by room. roomID and locationID narrow the search when set.
+func (app *application) findAdjacentComputers(roomID, locationID uint, size int, start, end time.Time) ([]uint, error) {
+	query := app.db.Model(&models.FloorPlan{}).Order("room_id")
+	if roomID != 0 {
+		query = query.Where("room_id = ?", roomID)
+	}
+	if locationID != 0 {
+		query = query.Where("room_id IN (?)", app.db.Model(&models.Room{}).Select("id").Where("location_id = ?", locationID))
+	}
+
+	var plans []models.FloorPlan
+	if err := query.Find(&plans).Error; err != nil {
+		return nil, err
+	}
+
+	for _, plan := range plans {
+		seats, _, err := app.roomSeats(plan.RoomID)
+		if err != nil {
+			return nil, err
+		}
+
+		scope := app.db.Model(&models.Computer{}).Select("id").Where("room_id = ?", plan.RoomID)
+		available, err := availableComputers(app.db, scope, start, end)
+		if err != nil {
+			return nil, err
+		}
+		free := make(map[uint]bool, len(available))
+		for _, computer := range available {
+			free[computer.ID] = true
+		}
+
+		if run := floorplan.FindAdjacent(seats, free, size); run != nil {
+			return run, nil
+		}
+	}
+	return nil, nil
+}
+
+// findOwnGroup loads the group from the :id parameter and checks that it
+// belongs to the caller. It writes the error response itself.
+func (app *application) findOwnGroup(c *gin.Context) (*models.BookingGroup, bool) {
+	var group models.BookingGroup
+	if err := app.db.Preload("Bookings", func(db *gorm.DB) *gorm.DB {
+		return db.Order("computer_id")
+	}).First(&group, c.Param("id")).Error; err != nil {
+		app.logger.Error("Booking group not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking group not found"})
+		return nil, false
+	}
+
+	if group.UserID != c.GetString("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own bookings"})
+		return nil, false
+	}
+	return &group, true
+}
+
+func (app *application) getGroup(c *gin.Context) {
+	group, ok := app.findOwnGroup(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// cancelGroup cancels every booking of the group that can still be
+// cancelled, all or nothing.
+func (app *application) cancelGroup(c *gin.Context) {
+	group, ok := app.findOwnGroup(c)
+	if !ok {
+		return
+	}
+
+	actor := c.GetString("userID")
+	var cancelled []*models.Booking
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		for i := range group.Bookings {
+			booking := &group.Bookings[i]
+			if !booking.CanTransition(models.BookingCancelled) {
+				continue
+			}
+			if err := app.moveBooking(tx, booking, models.BookingCancelled, actor, "group cancelled by user"); err != nil {
+				return err
+			}
+			cancelled = append(cancelled, booking)
+		}
+		return nil
+	})
+	if err != nil {
+		app.logger.Error("Failed to cancel booking group: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel booking group"})
+		return
+	}
+	for _, booking := range cancelled {
+		if err := app.bookingReleased(booking); err != nil {
+			app.logger.Error("Failed to release booking " + strconv.Itoa(int(booking.ID)) + ": " + err.Error())
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Booking group cancelled successfully", "cancelled": len(cancelled)})
+}
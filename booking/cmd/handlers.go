@@ -3,8 +3,11 @@ package main
 import (
 	"booking/internal/models"
 	"booking/internal/publisher"
+	"booking/internal/schedule"
+	"booking/internal/specs"
 	"bytes"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"html/template"
 	"log"
 	"strconv"
@@ -13,9 +16,11 @@ import (
 
 func (app *application) bookComputer(c *gin.Context) {
 	var bookingRequest struct {
-		ComputerID uint      `json:"computer_id"`
-		StartTime  time.Time `json:"start_time"`
-		EndTime    time.Time `json:"end_time"`
+		ComputerID uint     `json:"computer_id"`
+		StartTime  string   `json:"start_time"`
+		EndTime    string   `json:"end_time"`
+		RRule      string   `json:"rrule"`
+		ExDates    []string `json:"exdates"`
 	}
 
 	if err := c.BindJSON(&bookingRequest); err != nil {
@@ -33,40 +38,66 @@ func (app *application) bookComputer(c *gin.Context) {
 		return
 	}
 
-	if computer.Status == "booked" {
-		c.JSON(400, gin.H{"error": "Computer is already booked"})
+	if !isBookable(&computer) {
+		c.JSON(409, gin.H{"error": "Computer is out of service"})
+		return
+	}
+
+	// Times without an offset are local to the computer's location.
+	zone := app.computerZone(computer.ID)
+	window, ok := parseRequestWindow(c, bookingRequest.StartTime, bookingRequest.EndTime, zone)
+	if !ok {
 		return
 	}
 
 	booking := models.Booking{
 		UserID:     userID,
+		Email:      c.GetString("email"),
 		ComputerID: bookingRequest.ComputerID,
-		StartTime:  bookingRequest.StartTime,
-		EndTime:    bookingRequest.EndTime,
+		StartTime:  window.Start,
+		EndTime:    window.End,
+		Status:     models.BookingConfirmed,
+	}
+
+	if bookingRequest.RRule != "" {
+		exdates := make([]time.Time, 0, len(bookingRequest.ExDates))
+		for _, raw := range bookingRequest.ExDates {
+			exdate, err := parseTime(raw, zone)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Invalid exdates"})
+				return
+			}
+			exdates = append(exdates, exdate)
+		}
+		app.bookSeries(c, &computer, booking, bookingRequest.RRule, exdates)
+		return
 	}
 
-	if err := app.db.Create(&booking).Error; err != nil {
-		app.logger.Error("Failed to create booking: " + err.Error())
-		c.JSON(500, gin.H{"error": "Failed to create booking"})
+	if !app.checkWindows(c, computer.ID, []schedule.Interval{window}, nil) {
 		return
 	}
 
-	computer.Status = "booked"
-	if err := app.db.Save(&computer).Error; err != nil {
+	err := app.bookingTx([]uint{computer.ID}, func(tx *gorm.DB) error {
+		return reserve(tx, &booking)
+	})
+	if err != nil {
+		app.bookingErrorResponse(c, err, "Failed to create booking")
+		return
+	}
+
+	if err := refreshComputerStatus(app.db, &computer); err != nil {
 		app.logger.Error("Failed to update computer status: " + err.Error())
 		c.JSON(500, gin.H{"error": "Failed to update computer status"})
 		return
 	}
 
-	email := c.GetString("email")
-
-	err := app.sendMail(email, bookingRequest.StartTime.String(), strconv.Itoa(int(bookingRequest.ComputerID)))
+	err = app.sendMail(booking.Email, app.localTime(booking.ComputerID, booking.StartTime), strconv.Itoa(int(bookingRequest.ComputerID)))
 
 	if err != nil {
 		app.logger.Error("Failed to send email: " + err.Error())
 	}
 
-	c.JSON(200, gin.H{"message": "Computer booked successfully"})
+	c.JSON(200, gin.H{"message": "Computer booked successfully", "booking_id": booking.ID})
 }
 
 type EmailData struct {
@@ -104,14 +135,34 @@ func (app *application) sendMail(recipient string, date string, compnum string)
 }
 
 func (app *application) getAvailableComputers(c *gin.Context) {
-	var computers []models.Computer
-	if err := app.db.Where("status = ?", "available").Find(&computers).Error; err != nil {
+	zone, err := app.requestZone(c)
+	if err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(404, gin.H{"error": "Location not found"})
+		return
+	}
+
+	from, to, err := parseWindow(c, zone)
+	if err != nil {
+		app.logger.Error("Invalid time window: " + err.Error())
+		c.JSON(400, gin.H{"error": "Invalid time window"})
+		return
+	}
+
+	predicates, err := specs.ParseAll(c.QueryArray("spec"))
+	if err != nil {
+		c.JSON(400, gin.H{"error": err.Error()})
+		return
+	}
+
+	computers, err := availableComputers(app.db, scopedComputerIDs(c, app.db), from, to)
+	if err != nil {
 		app.logger.Error("Failed to retrieve computers: " + err.Error())
 		c.JSON(500, gin.H{"error": "Failed to retrieve computers"})
 		return
 	}
 
-	c.JSON(200, computers)
+	c.JSON(200, specs.Filter(computers, predicates))
 }
 
 func (app *application) cancelBooking(c *gin.Context) {
@@ -130,23 +181,8 @@ func (app *application) cancelBooking(c *gin.Context) {
 		return
 	}
 
-	var computer models.Computer
-	if err := app.db.First(&computer, booking.ComputerID).Error; err != nil {
-		app.logger.Error("Computer not found: " + err.Error())
-		c.JSON(404, gin.H{"error": "Computer not found"})
-		return
-	}
-
-	computer.Status = "available"
-	if err := app.db.Save(&computer).Error; err != nil {
-		app.logger.Error("Failed to update computer status: " + err.Error())
-		c.JSON(500, gin.H{"error": "Failed to update computer status"})
-		return
-	}
-
-	if err := app.db.Delete(&booking).Error; err != nil {
-		app.logger.Error("Failed to delete booking: " + err.Error())
-		c.JSON(500, gin.H{"error": "Failed to delete booking"})
+	if err := app.transitionBooking(app.db, &booking, models.BookingCancelled, userID, "cancelled by user"); err != nil {
+		app.transitionResponse(c, err)
 		return
 	}
 
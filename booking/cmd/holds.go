@@ -0,0 +1,158 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// createHold reserves a window as a pending booking that expires after
+// HoldTTL unless it is confirmed. Holds block overlapping bookings like any
+// other active booking. Times without an offset are local to the computer.
+func (app *application) createHold(c *gin.Context) {
+	var request struct {
+		ComputerID uint   `json:"computer_id"`
+		StartTime  string `json:"start_time"`
+		EndTime    string `json:"end_time"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	var computer models.Computer
+	if err := app.db.First(&computer, request.ComputerID).Error; err != nil {
+		app.logger.Error("Computer not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Computer not found"})
+		return
+	}
+
+	if !isBookable(&computer) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Computer is out of service"})
+		return
+	}
+
+	window, ok := parseRequestWindow(c, request.StartTime, request.EndTime, app.computerZone(computer.ID))
+	if !ok {
+		return
+	}
+
+	if !app.checkWindows(c, computer.ID, []schedule.Interval{window}, nil) {
+		return
+	}
+
+	expiresAt := time.Now().Add(app.config.HoldTTL)
+	hold := models.Booking{
+		UserID:        c.GetString("userID"),
+		Email:         c.GetString("email"),
+		ComputerID:    computer.ID,
+		StartTime:     window.Start,
+		EndTime:       window.End,
+		Status:        models.BookingPending,
+		HoldExpiresAt: &expiresAt,
+	}
+
+	err := app.bookingTx([]uint{computer.ID}, func(tx *gorm.DB) error {
+		return reserve(tx, &hold)
+	})
+	if err != nil {
+		app.bookingErrorResponse(c, err, "Failed to create hold")
+		return
+	}
+
+	if err := refreshComputerStatus(app.db, &computer); err != nil {
+		app.logger.Error("Failed to update computer status: " + err.Error())
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+// findOwnHold loads a hold of the caller's and writes the error response
+// itself when there is none.
+func (app *application) findOwnHold(c *gin.Context) (*models.Booking, bool) {
+	hold, ok := app.findOwnBooking(c)
+	if !ok {
+		return nil, false
+	}
+
+	if hold.HoldExpiresAt == nil || hold.Status != models.BookingPending {
+		c.JSON(http.StatusConflict, gin.H{"error": "Booking is not an open hold"})
+		return nil, false
+	}
+	return hold, true
+}
+
+func (app *application) confirmHold(c *gin.Context) {
+	hold, ok := app.findOwnHold(c)
+	if !ok {
+		return
+	}
+
+	if time.Now().After(*hold.HoldExpiresAt) {
+		if err := app.transitionBooking(app.db, hold, models.BookingCancelled, systemActor, "hold expired"); err != nil {
+			app.logger.Error("Failed to release expired hold: " + err.Error())
+		}
+		c.JSON(http.StatusGone, gin.H{"error": "Hold has expired"})
+		return
+	}
+
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		if err := app.moveBooking(tx, hold, models.BookingConfirmed, hold.UserID, "hold confirmed"); err != nil {
+			return err
+		}
+		return tx.Model(hold).Update("hold_expires_at", nil).Error
+	})
+	if err != nil {
+		app.transitionResponse(c, err)
+		return
+	}
+
+	var computer models.Computer
+	if err := app.db.First(&computer, hold.ComputerID).Error; err == nil {
+		err = app.sendMail(hold.Email, app.localTime(hold.ComputerID, hold.StartTime), strconv.Itoa(computer.Number))
+		if err != nil {
+			app.logger.Error("Failed to send email: " + err.Error())
+		}
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+func (app *application) releaseHold(c *gin.Context) {
+	hold, ok := app.findOwnHold(c)
+	if !ok {
+		return
+	}
+
+	if err := app.transitionBooking(app.db, hold, models.BookingCancelled, hold.UserID, "hold released by user"); err != nil {
+		app.transitionResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Hold released successfully"})
+}
+
+// releaseExpiredHolds cancels holds that were not confirmed in time.
+func (app *application) releaseExpiredHolds(now time.Time) (int, error) {
+	var holds []models.Booking
+	if err := app.db.Where("status = ? AND hold_expires_at < ?", models.BookingPending, now).
+		Find(&holds).Error; err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for i := range holds {
+		if err := app.transitionBooking(app.db, &holds[i], models.BookingCancelled, systemActor, "hold expired"); err != nil {
+			app.logger.Error("Failed to release hold " + strconv.Itoa(int(holds[i].ID)) + ": " + err.Error())
+			continue
+		}
+		released++
+	}
+	return released, nil
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"booking/internal/hours"
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// loadCalendar returns the opening hours of the location together with its
+// closures that overlap window.
+func loadCalendar(db *gorm.DB, location *models.Location, window schedule.Interval) (hours.Calendar, error) {
+	calendar := hours.Calendar{Zone: location.Zone()}
+
+	var periods []models.OpeningHours
+	if err := db.Where("location_id = ?", location.ID).Find(&periods).Error; err != nil {
+		return calendar, err
+	}
+	for _, period := range periods {
+		opens, err := hours.ParseClock(period.Opens)
+		if err != nil {
+			return calendar, err
+		}
+		closes, err := hours.ParseClock(period.Closes)
+		if err != nil {
+			return calendar, err
+		}
+		calendar.Weekly = append(calendar.Weekly, hours.Period{Weekday: time.Weekday(period.Weekday), Opens: opens, Closes: closes})
+	}
+
+	var closures []models.Closure
+	if err := db.Where("location_id = ? AND start_time < ? AND end_time > ?", location.ID, window.End, window.Start).
+		Find(&closures).Error; err != nil {
+		return calendar, err
+	}
+	for _, closure := range closures {
+		calendar.Closures = append(calendar.Closures, schedule.Interval{Start: closure.StartTime, End: closure.EndTime})
+	}
+	return calendar, nil
+}
+
+// closedPeriods returns, for each of the computers, the merged intervals
+// within window during which its location is closed. Computers that are not
+// in a room are never closed and have no entry.
+func closedPeriods(db *gorm.DB, computers []models.Computer, window schedule.Interval) (map[uint][]schedule.Interval, error) {
+	roomIDs := make([]uint, 0, len(computers))
+	for _, computer := range computers {
+		if computer.RoomID != nil {
+			roomIDs = append(roomIDs, *computer.RoomID)
+		}
+	}
+	closed := make(map[uint][]schedule.Interval)
+	if len(roomIDs) == 0 {
+		return closed, nil
+	}
+
+	var rooms []models.Room
+	if err := db.Where("id IN ?", roomIDs).Find(&rooms).Error; err != nil {
+		return nil, err
+	}
+	byLocation := make(map[uint][]schedule.Interval)
+	roomLocation := make(map[uint]uint, len(rooms))
+	for _, room := range rooms {
+		roomLocation[room.ID] = room.LocationID
+		if _, ok := byLocation[room.LocationID]; ok {
+			continue
+		}
+
+		var location models.Location
+		if err := db.First(&location, room.LocationID).Error; err != nil {
+			return nil, err
+		}
+		calendar, err := loadCalendar(db, &location, window)
+		if err != nil {
+			return nil, err
+		}
+		byLocation[room.LocationID] = calendar.Closed(window)
+	}
+
+	for _, computer := range computers {
+		if computer.RoomID == nil {
+			continue
+		}
+		if locationID, ok := roomLocation[*computer.RoomID]; ok && len(byLocation[locationID]) > 0 {
+			closed[computer.ID] = byLocation[locationID]
+		}
+	}
+	return closed, nil
+}
+
+// checkOpeningHours checks that the computer's location is open throughout
+// each of windows. It writes a 422 listing the closed periods and returns
+// false when it is not.
+func (app *application) checkOpeningHours(c *gin.Context, computerID uint, windows []schedule.Interval) bool {
+	location := app.computerLocation(computerID)
+	if location == nil {
+		return true
+	}
+
+	for _, window := range windows {
+		calendar, err := loadCalendar(app.db, location, window)
+		if err != nil {
+			app.logger.Error("Failed to check opening hours: " + err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check opening hours"})
+			return false
+		}
+
+		closed := calendar.Closed(window)
+		if len(closed) == 0 {
+			continue
+		}
+		zone := location.Zone()
+		for i := range closed {
+			closed[i] = closed[i].In(zone)
+		}
+		c.JSON(http.StatusUnprocessableEntity, gin.H{
+			"error":     "Location is closed during the requested time",
+			"window":    window.In(zone),
+			"time_zone": zone.String(),
+			"closed":    closed,
+		})
+		return false
+	}
+	return true
+}
+
+// getOpeningHours returns the location's weekly opening hours and the
+// closures that have not ended yet.
+func (app *application) getOpeningHours(c *gin.Context) {
+	var location models.Location
+	if err := app.db.First(&location, c.Param("id")).Error; err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	var periods []models.OpeningHours
+	if err := app.db.Where("location_id = ?", location.ID).Order("weekday, opens").Find(&periods).Error; err != nil {
+		app.logger.Error("Failed to retrieve opening hours: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve opening hours"})
+		return
+	}
+
+	var closures []models.Closure
+	if err := app.db.Where("location_id = ? AND end_time > ?", location.ID, time.Now()).
+		Order("start_time").
+		Find(&closures).Error; err != nil {
+		app.logger.Error("Failed to retrieve closures: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve closures"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"location_id": location.ID,
+		"time_zone":   location.TimeZone,
+		"hours":       periods,
+		"closures":    closures,
+	})
+}
+
+// updateOpeningHours replaces the location's weekly opening hours. An empty
+// list makes the location open around the clock. Existing bookings are left
+// alone.
+func (app *application) updateOpeningHours(c *gin.Context) {
+	var location models.Location
+	if err := app.db.First(&location, c.Param("id")).Error; err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	var request struct {
+		Hours []struct {
+			Weekday int    `json:"weekday"`
+			Opens   string `json:"opens"`
+			Closes  string `json:"closes"`
+		} `json:"hours"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	periods := make([]hours.Period, 0, len(request.Hours))
+	week := make([]models.OpeningHours, 0, len(request.Hours))
+	for _, period := range request.Hours {
+		opens, err := hours.ParseClock(period.Opens)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		closes, err := hours.ParseClock(period.Closes)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		periods = append(periods, hours.Period{Weekday: time.Weekday(period.Weekday), Opens: opens, Closes: closes})
+		week = append(week, models.OpeningHours{
+			LocationID: location.ID,
+			Weekday:    period.Weekday,
+			Opens:      hours.FormatClock(opens),
+			Closes:     hours.FormatClock(closes),
+		})
+	}
+	if err := hours.Validate(periods); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("location_id = ?", location.ID).Delete(&models.OpeningHours{}).Error; err != nil {
+			return err
+		}
+		if len(week) == 0 {
+			return nil
+		}
+		return tx.Create(&week).Error
+	})
+	if err != nil {
+		app.logger.Error("Failed to update opening hours: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update opening hours"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"location_id": location.ID,
+		"time_zone":   location.TimeZone,
+		"hours":       week,
+	})
+}
+
+func (app *application) getClosures(c *gin.Context) {
+	var closures []models.Closure
+	if err := app.db.Where("location_id = ?", c.Param("id")).Order("start_time").Find(&closures).Error; err != nil {
+		app.logger.Error("Failed to retrieve closures: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve closures"})
+		return
+	}
+
+	c.JSON(http.StatusOK, closures)
+}
+
+// createClosure adds a holiday, which closes the location for the whole local
+// date, or an ad-hoc closure between start_time and end_time. Bookings at the
+// location that the closure overlaps are cancelled and their owners notified.
+func (app *application) createClosure(c *gin.Context) {
+	var location models.Location
+	if err := app.db.First(&location, c.Param("id")).Error; err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	var request struct {
+		Kind      string `json:"kind"`
+		Reason    string `json:"reason"`
+		Date      string `json:"date"`
+		StartTime string `json:"start_time"`
+		EndTime   string `json:"end_time"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	zone := location.Zone()
+	closure := models.Closure{LocationID: location.ID, Kind: request.Kind, Reason: request.Reason}
+	switch request.Kind {
+	case models.ClosureHoliday:
+		date, err := time.ParseInLocation("2006-01-02", request.Date, zone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date must be a date such as 2006-01-02"})
+			return
+		}
+		closure.StartTime, closure.EndTime = date.UTC(), date.AddDate(0, 0, 1).UTC()
+	case models.ClosureAdHoc:
+		start, err := parseTime(request.StartTime, zone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time"})
+			return
+		}
+		end, err := parseTime(request.EndTime, zone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time"})
+			return
+		}
+		if !end.After(start) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidWindow.Error()})
+			return
+		}
+		closure.StartTime, closure.EndTime = start, end
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be " + models.ClosureHoliday + " or " + models.ClosureAdHoc})
+		return
+	}
+
+	if err := app.db.Create(&closure).Error; err != nil {
+		app.logger.Error("Failed to create closure: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create closure"})
+		return
+	}
+
+	cancelled, err := app.cancelForClosure(&location, &closure, c.GetString("userID"))
+	if err != nil {
+		app.logger.Error("Failed to cancel bookings for closure: " + err.Error())
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"closure":            closure,
+		"cancelled_bookings": cancelled,
+	})
+}
+
+// cancelForClosure cancels the bookings at the location that overlap the
+// closure and notifies their owners. It returns the ids of the cancelled
+// bookings.
+func (app *application) cancelForClosure(location *models.Location, closure *models.Closure, actor string) ([]uint, error) {
+	computers := app.db.Model(&models.Computer{}).Select("computers.id").
+		Joins("JOIN rooms ON rooms.id = computers.room_id").
+		Where("rooms.location_id = ?", location.ID)
+	query := overlapping(app.db.Model(&models.Booking{}), closure.StartTime, closure.EndTime).
+		Where("computer_id IN (?)", computers)
+
+	reason := "location closed"
+	if closure.Reason != "" {
+		reason += ": " + closure.Reason
+	}
+	zone := location.Zone()
+	return app.cancelBookings(query, actor, reason, func(booking *models.Booking) []string {
+		lines := []string{
+			fmt.Sprintf("Your booking starting %s was cancelled because %s is closed from %s to %s.",
+				booking.StartTime.In(zone).Format(time.RFC1123), location.Name,
+				closure.StartTime.In(zone).Format(time.RFC1123), closure.EndTime.In(zone).Format(time.RFC1123)),
+		}
+		if closure.Reason != "" {
+			lines = append(lines, "Reason: "+closure.Reason)
+		}
+		return lines
+	})
+}
+
+func (app *application) deleteClosure(c *gin.Context) {
+	if err := app.db.Delete(&models.Closure{}, c.Param("id")).Error; err != nil {
+		app.logger.Error("Failed to delete closure: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete closure"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Closure deleted successfully"})
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"booking/internal/models"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	maxIdempotencyKey = 255
+)
+
+// capturingWriter keeps a copy of the response body so it can be stored.
+type capturingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *capturingWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *capturingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyMiddleware makes a create endpoint safe to retry. The first
+// request with a given Idempotency-Key runs normally and its response is
+// stored; retries with the same key and body get the stored response back,
+// and reusing the key for a different request is rejected. Server errors and
+// panics are not stored so the client can retry them. It must run after
+// authMiddleware.
+func (app *application) idempotencyMiddleware(c *gin.Context) {
+	key := c.GetHeader(idempotencyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKey {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+		c.Abort()
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		c.Abort()
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.Method + " " + c.FullPath() + "\n"))
+	hash.Write(body)
+
+	fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+	record := models.IdempotencyKey{
+		UserID:      c.GetString("userID"),
+		Key:         key,
+		Fingerprint: fingerprint,
+		ExpiresAt:   time.Now().Add(app.config.IdempotencyTTL),
+	}
+
+	claimed, err := app.claimIdempotencyKey(&record)
+	if err != nil {
+		app.logger.Error("Failed to store idempotency key: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+		c.Abort()
+		return
+	}
+
+	if !claimed {
+		switch {
+		case record.Fingerprint != fingerprint:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		case !record.Completed:
+			c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+		default:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(record.StatusCode, "application/json; charset=utf-8", record.ResponseBody)
+		}
+		c.Abort()
+		return
+	}
+
+	// Unless the response is stored, the claim is released so that the client
+	// can retry, also when the handler panics.
+	stored := false
+	defer func() {
+		if stored {
+			return
+		}
+		if err := app.db.Delete(&record).Error; err != nil {
+			app.logger.Error("Failed to release idempotency key: " + err.Error())
+		}
+	}()
+
+	writer := &capturingWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+
+	status := writer.Status()
+	if status >= http.StatusInternalServerError {
+		return
+	}
+
+	if err := app.db.Model(&record).Updates(map[string]interface{}{
+		"completed":     true,
+		"status_code":   status,
+		"response_body": writer.body.Bytes(),
+	}).Error; err != nil {
+		app.logger.Error("Failed to store idempotent response: " + err.Error())
+		return
+	}
+	stored = true
+}
+
+// claimIdempotencyKey inserts the record if its key is new or has expired. If
+// the key is taken, it loads the stored record into record and returns false.
+func (app *application) claimIdempotencyKey(record *models.IdempotencyKey) (bool, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		result := app.db.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if result.Error != nil {
+			return false, result.Error
+		}
+		if result.RowsAffected == 1 {
+			return true, nil
+		}
+
+		var existing models.IdempotencyKey
+		err := app.db.Where("user_id = ? AND idempotency_key = ?", record.UserID, record.Key).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+
+		if existing.ExpiresAt.Before(time.Now()) {
+			if err := app.db.Delete(&existing).Error; err != nil {
+				return false, err
+			}
+			record.ID = 0
+			continue
+		}
+
+		*record = existing
+		return false, nil
+	}
+	return false, errors.New("idempotency key is contended")
+}
+
+// purgeIdempotencyKeys deletes stored responses past their TTL.
+func (app *application) purgeIdempotencyKeys(now time.Time) error {
+	return app.db.Where("expires_at < ?", now).Delete(&models.IdempotencyKey{}).Error
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"booking/internal/models"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+var errIssueChanged = errors.New("issue was changed by another request")
+
+func validSeverity(severity string) bool {
+	switch severity {
+	case models.SeverityLow, models.SeverityMedium, models.SeverityHigh:
+		return true
+	}
+	return false
+}
+
+// reportIssue files a hardware issue against a computer, optionally tied to
+// one of the caller's bookings of it. A high severity report by someone
+// checked in at the computer takes it out of service until the issue is
+// resolved when HighSeverityMaintenance is enabled.
+func (app *application) reportIssue(c *gin.Context) {
+	var request struct {
+		ComputerID  uint   `json:"computer_id"`
+		BookingID   *uint  `json:"booking_id"`
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Severity    string `json:"severity"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if request.Title == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "title is required"})
+		return
+	}
+	if request.Severity == "" {
+		request.Severity = models.SeverityMedium
+	}
+	if !validSeverity(request.Severity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "severity must be low, medium or high"})
+		return
+	}
+
+	var computer models.Computer
+	if err := app.db.First(&computer, request.ComputerID).Error; err != nil {
+		app.logger.Error("Computer not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Computer not found"})
+		return
+	}
+
+	userID := c.GetString("userID")
+	if request.BookingID != nil {
+		var booking models.Booking
+		if err := app.db.First(&booking, *request.BookingID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+			return
+		}
+		if booking.UserID != userID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can only report issues with your own bookings"})
+			return
+		}
+		if booking.ComputerID != computer.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Booking is for a different computer"})
+			return
+		}
+	}
+
+	var checkedIn int64
+	if err := app.db.Model(&models.Booking{}).
+		Where("user_id = ? AND computer_id = ? AND status = ?", userID, computer.ID, models.BookingCheckedIn).
+		Count(&checkedIn).Error; err != nil {
+		app.logger.Error("Failed to look up check-in: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report issue"})
+		return
+	}
+
+	issue := models.Issue{
+		ComputerID:    computer.ID,
+		BookingID:     request.BookingID,
+		ReporterID:    userID,
+		ReporterEmail: c.GetString("email"),
+		Title:         request.Title,
+		Description:   request.Description,
+		Severity:      request.Severity,
+		Status:        models.IssueOpen,
+	}
+	if err := app.db.Create(&issue).Error; err != nil {
+		app.logger.Error("Failed to report issue: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to report issue"})
+		return
+	}
+
+	if checkedIn > 0 {
+		app.issueMaintenance(&issue)
+	}
+
+	c.JSON(http.StatusCreated, issue)
+}
+
+// issueMaintenance takes the computer of a high severity issue out of service
+// when HighSeverityMaintenance is enabled, unless the issue already did. The
+// maintenance has no end and blocks new bookings until the issue is resolved;
+// bookings already made are left for admins to sort out.
+func (app *application) issueMaintenance(issue *models.Issue) {
+	if issue.Severity != models.SeverityHigh || !app.config.HighSeverityMaintenance || issue.MaintenanceWindowID != nil {
+		return
+	}
+
+	maintenance := models.MaintenanceWindow{
+		ComputerID: issue.ComputerID,
+		Reason:     fmt.Sprintf("Issue #%d: %s", issue.ID, issue.Title),
+		ReportedBy: issue.ReporterID,
+		StartTime:  time.Now().UTC(),
+	}
+	if err := app.openMaintenance(&maintenance); err != nil {
+		app.logger.Error("Failed to start maintenance for issue: " + err.Error())
+		return
+	}
+	issue.MaintenanceWindowID = &maintenance.ID
+	if err := app.db.Model(issue).Update("maintenance_window_id", maintenance.ID).Error; err != nil {
+		app.logger.Error("Failed to link maintenance to issue: " + err.Error())
+	}
+}
+
+// findIssue loads the issue from the :id parameter with its comments and
+// checks that the caller reported it or is an admin. It writes the error
+// response itself.
+func (app *application) findIssue(c *gin.Context) (*models.Issue, bool) {
+	var issue models.Issue
+	if err := app.db.Preload("Comments", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at, id")
+	}).First(&issue, c.Param("id")).Error; err != nil {
+		app.logger.Error("Issue not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Issue not found"})
+		return nil, false
+	}
+
+	if issue.ReporterID != c.GetString("userID") && c.GetString("role") != "admin" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only view your own issues"})
+		return nil, false
+	}
+	return &issue, true
+}
+
+func (app *application) getIssue(c *gin.Context) {
+	issue, ok := app.findIssue(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, issue)
+}
+
+// getMyIssues lists the issues the caller reported, newest first.
+func (app *application) getMyIssues(c *gin.Context) {
+	var issues []models.Issue
+	if err := app.db.Where("reporter_id = ?", c.GetString("userID")).
+		Order("created_at DESC, id DESC").
+		Find(&issues).Error; err != nil {
+		app.logger.Error("Failed to retrieve issues: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve issues"})
+		return
+	}
+
+	c.JSON(http.StatusOK, issues)
+}
+
+// getIssues lists issues for admins, newest first, filtered by the optional
+// status, severity, computer_id and assignee_id query parameters.
+func (app *application) getIssues(c *gin.Context) {
+	query := app.db.Model(&models.Issue{})
+	for _, filter := range []string{"status", "severity", "computer_id", "assignee_id"} {
+		if value := c.Query(filter); value != "" {
+			query = query.Where(filter+" = ?", value)
+		}
+	}
+
+	var issues []models.Issue
+	if err := query.Order("created_at DESC, id DESC").Find(&issues).Error; err != nil {
+		app.logger.Error("Failed to retrieve issues: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve issues"})
+		return
+	}
+
+	c.JSON(http.StatusOK, issues)
+}
+
+// addIssueComment adds a comment by the reporter or an admin. Comments by
+// admins are forwarded to the reporter.
+func (app *application) addIssueComment(c *gin.Context) {
+	issue, ok := app.findIssue(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Body string `json:"body"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if request.Body == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "body is required"})
+		return
+	}
+
+	comment := models.IssueComment{IssueID: issue.ID, AuthorID: c.GetString("userID"), Body: request.Body}
+	if err := app.db.Create(&comment).Error; err != nil {
+		app.logger.Error("Failed to add comment: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+
+	if comment.AuthorID != issue.ReporterID {
+		app.notifyReporter(issue, "There is a new comment on your issue.", request.Body)
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// assignIssue hands the issue to an admin. An empty assignee_id unassigns it.
+func (app *application) assignIssue(c *gin.Context) {
+	issue, ok := app.findIssue(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		AssigneeID string `json:"assignee_id"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	body := "Assigned to " + request.AssigneeID
+	if request.AssigneeID == "" {
+		body = "Unassigned"
+	}
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(issue).Update("assignee_id", request.AssigneeID).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.IssueComment{IssueID: issue.ID, AuthorID: c.GetString("userID"), Body: body}).Error
+	})
+	if err != nil {
+		app.logger.Error("Failed to assign issue: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to assign issue"})
+		return
+	}
+	issue.AssigneeID = request.AssigneeID
+
+	c.JSON(http.StatusOK, issue)
+}
+
+// transitionIssue moves the issue along its lifecycle and records the change
+// as a comment. Acknowledging a high severity issue, or starting work on it,
+// takes the computer out of service; resolving the issue ends the maintenance
+// it started and reopens the computer.
+func (app *application) transitionIssue(c *gin.Context) {
+	issue, ok := app.findIssue(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Status  string `json:"status"`
+		Comment string `json:"comment"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if !issue.CanTransition(request.Status) {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("cannot move issue from %s to %s", issue.Status, request.Status)})
+		return
+	}
+
+	from := issue.Status
+	updates := map[string]interface{}{"status": request.Status, "resolved_at": nil}
+	var resolvedAt *time.Time
+	if request.Status == models.IssueResolved {
+		now := time.Now().UTC()
+		resolvedAt = &now
+		updates["resolved_at"] = now
+	}
+	body := fmt.Sprintf("Status changed from %s to %s", from, request.Status)
+	if request.Comment != "" {
+		body += ": " + request.Comment
+	}
+
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(issue).Where("status = ?", from).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errIssueChanged
+		}
+		return tx.Create(&models.IssueComment{IssueID: issue.ID, AuthorID: c.GetString("userID"), Body: body}).Error
+	})
+	if errors.Is(err, errIssueChanged) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Issue was changed by another request, please retry"})
+		return
+	}
+	if err != nil {
+		app.logger.Error("Failed to update issue status: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update issue status"})
+		return
+	}
+	issue.Status = request.Status
+	issue.ResolvedAt = resolvedAt
+
+	if issue.Status == models.IssueAcknowledged || issue.Status == models.IssueInProgress {
+		app.issueMaintenance(issue)
+	}
+	if issue.Status == models.IssueResolved && issue.MaintenanceWindowID != nil {
+		var maintenance models.MaintenanceWindow
+		if err := app.db.First(&maintenance, *issue.MaintenanceWindowID).Error; err == nil && maintenance.EndedAt == nil {
+			if err := app.finishMaintenance(&maintenance); err != nil {
+				app.logger.Error("Failed to end maintenance for issue: " + err.Error())
+			}
+		}
+	}
+
+	app.notifyReporter(issue, body+".")
+
+	c.JSON(http.StatusOK, issue)
+}
+
+// notifyReporter tells the reporter of the issue about a change to it.
+func (app *application) notifyReporter(issue *models.Issue, lines ...string) {
+	if issue.ReporterEmail == "" {
+		return
+	}
+
+	lines = append([]string{fmt.Sprintf("Your issue #%d \"%s\" was updated.", issue.ID, issue.Title)}, lines...)
+	if err := app.notify(issue.ReporterEmail, "issue_updated", "Issue updated", lines...); err != nil {
+		app.logger.Error("Failed to send issue notification: " + err.Error())
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/scheduler"
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// registerJobs adds the service's periodic jobs to the scheduler. It fails
+// when a job is misconfigured, such as with an interval that is not positive.
+func (app *application) registerJobs() error {
+	jobs := []scheduler.Job{
+		{
+			Name:     "finalize-bookings",
+			Interval: app.config.FinalizeInterval,
+			Jitter:   app.config.JobJitter,
+			Run: func(ctx context.Context, now time.Time) error {
+				if _, err := app.finalizeBookings(now); err != nil {
+					return err
+				}
+				return app.refreshComputerStatuses()
+			},
+		},
+		{
+			Name:     "mark-no-shows",
+			Interval: app.config.NoShowCheckInterval,
+			Jitter:   app.config.JobJitter,
+			Run: func(ctx context.Context, now time.Time) error {
+				marked, err := app.markNoShows(now)
+				if marked > 0 {
+					app.logger.Info(fmt.Sprintf("Marked %d bookings as no-show", marked))
+				}
+				return err
+			},
+		},
+		{
+			Name:     "release-expired-holds",
+			Interval: app.config.FinalizeInterval,
+			Jitter:   app.config.JobJitter,
+			Run: func(ctx context.Context, now time.Time) error {
+				_, err := app.releaseExpiredHolds(now)
+				return err
+			},
+		},
+		{
+			Name:     "apply-maintenance",
+			Interval: app.config.FinalizeInterval,
+			Jitter:   app.config.JobJitter,
+			Run: func(ctx context.Context, now time.Time) error {
+				return app.applyMaintenance(now)
+			},
+		},
+		{
+			Name:     "send-reminders",
+			Interval: app.config.ReminderInterval,
+			Jitter:   app.config.JobJitter,
+			Run: func(ctx context.Context, now time.Time) error {
+				_, err := app.sendDueReminders(now)
+				return err
+			},
+		},
+		{
+			Name:     "purge-idempotency-keys",
+			Interval: time.Hour,
+			Jitter:   app.config.JobJitter,
+			Run: func(ctx context.Context, now time.Time) error {
+				return app.purgeIdempotencyKeys(now)
+			},
+		},
+		{
+			Name:     "expire-waitlist-offers",
+			Interval: app.config.FinalizeInterval,
+			Jitter:   app.config.JobJitter,
+			Run: func(ctx context.Context, now time.Time) error {
+				return app.expireWaitlistOffers(now)
+			},
+		},
+	}
+	if app.payments != nil {
+		jobs = append(jobs, scheduler.Job{
+			Name:     "reconcile-payments",
+			Interval: app.config.PaymentReconcileInterval,
+			Jitter:   app.config.JobJitter,
+			Run: func(ctx context.Context, now time.Time) error {
+				settled, err := app.reconcilePayments(ctx, now)
+				if settled > 0 {
+					app.logger.Info(fmt.Sprintf("Reconciled %d payments", settled))
+				}
+				return err
+			},
+		})
+	}
+	for _, job := range jobs {
+		if err := app.scheduler.Add(job); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finalizeBookings completes checked-in bookings whose end time has passed.
+func (app *application) finalizeBookings(now time.Time) (int, error) {
+	var bookings []models.Booking
+	if err := app.db.Where("status = ? AND end_time <= ?", models.BookingCheckedIn, now).
+		Find(&bookings).Error; err != nil {
+		return 0, err
+	}
+
+	finalized := 0
+	for i := range bookings {
+		if err := app.transitionBooking(app.db, &bookings[i], models.BookingCompleted, systemActor, "booking ended"); err != nil {
+			app.logger.Error("Failed to finalize booking " + strconv.Itoa(int(bookings[i].ID)) + ": " + err.Error())
+			continue
+		}
+		finalized++
+	}
+	return finalized, nil
+}
+
+// refreshComputerStatuses brings every computer's occupancy status in line
+// with the bookings in progress, so computers become booked when a booking
+// starts and available again when it ends.
+func (app *application) refreshComputerStatuses() error {
+	var computers []models.Computer
+	if err := app.db.Find(&computers).Error; err != nil {
+		return err
+	}
+
+	for i := range computers {
+		if err := refreshComputerStatus(app.db, &computers[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (app *application) getJobs(c *gin.Context) {
+	c.JSON(http.StatusOK, app.scheduler.Status())
+}
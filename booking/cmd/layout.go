@@ -0,0 +1,280 @@
+package main
+
+import (
+	"booking/internal/floorplan"
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+const (
+	seatAvailable    = "available"
+	seatBusy         = "busy"
+	seatOutOfService = "out_of_service"
+	seatClosed       = "closed"
+)
+
+// layoutSeat is a seat of a room layout as rendered for clients.
+type layoutSeat struct {
+	ComputerID     uint   `json:"computer_id"`
+	ComputerNumber int    `json:"computer_number"`
+	Row            int    `json:"row"`
+	Column         int    `json:"column"`
+	Orientation    string `json:"orientation"`
+	Label          string `json:"label"`
+	Neighbours     []uint `json:"neighbours"`
+	Status         string `json:"status,omitempty"`
+}
+
+// roomZone returns the time zone of the room's location.
+func (app *application) roomZone(room *models.Room) *time.Location {
+	var location models.Location
+	if err := app.db.First(&location, room.LocationID).Error; err != nil {
+		return time.UTC
+	}
+	return location.Zone()
+}
+
+// roomSeats returns the seats of the room whose computers are still in it,
+// in row order, along with those computers by id.
+func (app *application) roomSeats(roomID uint) ([]models.Seat, map[uint]models.Computer, error) {
+	var seats []models.Seat
+	if err := app.db.Where("room_id = ?", roomID).Find(&seats).Error; err != nil {
+		return nil, nil, err
+	}
+
+	var computers []models.Computer
+	if err := app.db.Where("room_id = ?", roomID).Find(&computers).Error; err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[uint]models.Computer, len(computers))
+	for _, computer := range computers {
+		byID[computer.ID] = computer
+	}
+
+	placed := seats[:0]
+	for _, seat := range seats {
+		if _, ok := byID[seat.ComputerID]; ok {
+			placed = append(placed, seat)
+		}
+	}
+	floorplan.Sort(placed)
+	return placed, byID, nil
+}
+
+// renderSeats converts seats, sorted in row order, for clients.
+func renderSeats(seats []models.Seat, computers map[uint]models.Computer) []layoutSeat {
+	neighbours := floorplan.Neighbours(seats)
+	rendered := make([]layoutSeat, 0, len(seats))
+	for _, seat := range seats {
+		rendered = append(rendered, layoutSeat{
+			ComputerID:     seat.ComputerID,
+			ComputerNumber: computers[seat.ComputerID].Number,
+			Row:            seat.Row,
+			Column:         seat.Column,
+			Orientation:    seat.Orientation,
+			Label:          seat.Label,
+			Neighbours:     neighbours[seat.ComputerID],
+		})
+	}
+	return rendered
+}
+
+// getRoomLayout returns the room's floor plan with each seat marked
+// available, busy, closed or out of service for the requested window, which
+// defaults to now. Times without an offset are read in the room's time zone.
+func (app *application) getRoomLayout(c *gin.Context) {
+	var room models.Room
+	if err := app.db.First(&room, c.Param("id")).Error; err != nil {
+		app.logger.Error("Room not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	var plan models.FloorPlan
+	if err := app.db.Where("room_id = ?", room.ID).First(&plan).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room has no floor plan"})
+		return
+	}
+
+	zone := app.roomZone(&room)
+	from, to, err := parseWindow(c, zone)
+	if err != nil {
+		app.logger.Error("Invalid time window: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time window"})
+		return
+	}
+
+	seats, computers, err := app.roomSeats(room.ID)
+	if err != nil {
+		app.logger.Error("Failed to retrieve layout: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve layout"})
+		return
+	}
+
+	scope := app.db.Model(&models.Computer{}).Select("id").Where("room_id = ?", room.ID)
+	available, err := availableComputers(app.db, scope, from, to)
+	if err != nil {
+		app.logger.Error("Failed to retrieve computers: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve computers"})
+		return
+	}
+	free := make(map[uint]bool, len(available))
+	for _, computer := range available {
+		free[computer.ID] = true
+	}
+
+	window := schedule.Interval{Start: from, End: to}
+	if window.Empty() {
+		window.End = window.Start.Add(time.Nanosecond)
+	}
+	inRoom := make([]models.Computer, 0, len(computers))
+	ids := make([]uint, 0, len(computers))
+	for _, computer := range computers {
+		inRoom = append(inRoom, computer)
+		ids = append(ids, computer.ID)
+	}
+	closed, err := closedPeriods(app.db, inRoom, window)
+	if err != nil {
+		app.logger.Error("Failed to retrieve opening hours: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve opening hours"})
+		return
+	}
+	blocked, err := maintenanceIntervals(app.db, ids, window)
+	if err != nil {
+		app.logger.Error("Failed to retrieve maintenance windows: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve maintenance windows"})
+		return
+	}
+
+	rendered := renderSeats(seats, computers)
+	for i := range rendered {
+		computer := computers[rendered[i].ComputerID]
+		switch {
+		case !isBookable(&computer), len(blocked[computer.ID]) > 0:
+			rendered[i].Status = seatOutOfService
+		case len(closed[computer.ID]) > 0:
+			rendered[i].Status = seatClosed
+		case free[computer.ID]:
+			rendered[i].Status = seatAvailable
+		default:
+			rendered[i].Status = seatBusy
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_id":   room.ID,
+		"rows":      plan.Rows,
+		"columns":   plan.Columns,
+		"time_zone": zone.String(),
+		"from":      from.In(zone),
+		"to":        to.In(zone),
+		"seats":     rendered,
+	})
+}
+
+var errSeatNotInRoom = errors.New("seat computer is not in the room")
+
+// updateRoomLayout replaces the room's floor plan and seats.
+func (app *application) updateRoomLayout(c *gin.Context) {
+	var room models.Room
+	if err := app.db.First(&room, c.Param("id")).Error; err != nil {
+		app.logger.Error("Room not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	var request struct {
+		Rows    int `json:"rows"`
+		Columns int `json:"columns"`
+		Seats   []struct {
+			ComputerID  uint   `json:"computer_id"`
+			Row         int    `json:"row"`
+			Column      int    `json:"column"`
+			Orientation string `json:"orientation"`
+			Label       string `json:"label"`
+		} `json:"seats"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	placed := make([]models.Seat, 0, len(request.Seats))
+	for _, seat := range request.Seats {
+		placed = append(placed, models.Seat{
+			RoomID:      room.ID,
+			ComputerID:  seat.ComputerID,
+			Row:         seat.Row,
+			Column:      seat.Column,
+			Orientation: seat.Orientation,
+			Label:       seat.Label,
+		})
+	}
+	if err := floorplan.Validate(request.Rows, request.Columns, placed); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		for _, seat := range placed {
+			var computer models.Computer
+			if err := tx.First(&computer, seat.ComputerID).Error; err != nil || computer.RoomID == nil || *computer.RoomID != room.ID {
+				return fmt.Errorf("%w: computer %d", errSeatNotInRoom, seat.ComputerID)
+			}
+		}
+
+		var plan models.FloorPlan
+		if err := tx.Where("room_id = ?", room.ID).FirstOrInit(&plan).Error; err != nil {
+			return err
+		}
+		plan.RoomID = room.ID
+		plan.Rows = request.Rows
+		plan.Columns = request.Columns
+		if err := tx.Save(&plan).Error; err != nil {
+			return err
+		}
+
+		// Seats of other rooms may be claimed by computers that moved here.
+		computerIDs := make([]uint, 0, len(placed))
+		for _, seat := range placed {
+			computerIDs = append(computerIDs, seat.ComputerID)
+		}
+		if err := tx.Where("room_id = ? OR computer_id IN ?", room.ID, computerIDs).Delete(&models.Seat{}).Error; err != nil {
+			return err
+		}
+		if len(placed) == 0 {
+			return nil
+		}
+		return tx.Create(&placed).Error
+	})
+	if errors.Is(err, errSeatNotInRoom) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		app.logger.Error("Failed to update layout: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update layout"})
+		return
+	}
+
+	seats, computers, err := app.roomSeats(room.ID)
+	if err != nil {
+		app.logger.Error("Failed to retrieve layout: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve layout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_id": room.ID,
+		"rows":    request.Rows,
+		"columns": request.Columns,
+		"seats":   renderSeats(seats, computers),
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+)
+
+// systemActor is recorded as the actor of transitions made by the service
+// itself rather than by a user.
+const systemActor = "system"
+
+type transitionError struct {
+	from, to string
+}
+
+func (e *transitionError) Error() string {
+	return fmt.Sprintf("cannot move booking from %s to %s", e.from, e.to)
+}
+
+// transitionBooking moves the booking to the given status if the transition
+// table allows it and records the change in the booking's history, refunding
+// the owner of a cancelled booking. When the booking stops occupying its
+// computer, the computer status is recomputed and the freed window is offered
+// to the waitlist once the change is committed.
+func (app *application) transitionBooking(db *gorm.DB, booking *models.Booking, to, actor, reason string) error {
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		return app.moveBooking(tx, booking, to, actor, reason)
+	}); err != nil {
+		return err
+	}
+	return app.bookingReleased(booking)
+}
+
+// moveBooking is the part of transitionBooking that runs in a transaction.
+// Callers moving several bookings in one transaction call bookingReleased for
+// each of them after committing.
+func (app *application) moveBooking(tx *gorm.DB, booking *models.Booking, to, actor, reason string) error {
+	if !booking.CanTransition(to) {
+		return &transitionError{from: booking.Status, to: to}
+	}
+
+	from := booking.Status
+	result := tx.Model(booking).Where("status = ?", from).Update("status", to)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Another request moved the booking first.
+		return &transitionError{from: from, to: to}
+	}
+
+	if err := tx.Create(&models.BookingTransition{
+		BookingID:  booking.ID,
+		FromStatus: from,
+		ToStatus:   to,
+		ActorID:    actor,
+		Reason:     reason,
+	}).Error; err != nil {
+		return err
+	}
+	if err := app.refundBooking(tx, booking, from, to, actor); err != nil {
+		return err
+	}
+	booking.Status = to
+	return nil
+}
+
+// bookingReleased recomputes the status of the booking's computer and offers
+// its window to the waitlist when the booking no longer occupies it.
+func (app *application) bookingReleased(booking *models.Booking) error {
+	if booking.IsActive() {
+		return nil
+	}
+
+	var computer models.Computer
+	if err := app.db.First(&computer, booking.ComputerID).Error; err != nil {
+		return err
+	}
+	if err := refreshComputerStatus(app.db, &computer); err != nil {
+		return err
+	}
+
+	app.offerWaitlist(booking.ComputerID, schedule.Interval{Start: booking.StartTime, End: booking.EndTime})
+	return nil
+}
+
+// cancelBookings cancels the bookings matched by query that have not been
+// checked in yet, recording reason, and notifies each owner with the lines
+// explain returns for their booking. Checked-in sessions are left to finish.
+// It returns the ids of the cancelled bookings.
+func (app *application) cancelBookings(query *gorm.DB, actor, reason string, explain func(*models.Booking) []string) ([]uint, error) {
+	var bookings []models.Booking
+	if err := query.Where("status IN ?", []string{models.BookingPending, models.BookingConfirmed}).
+		Order("start_time").
+		Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+
+	cancelled := make([]uint, 0, len(bookings))
+	for i := range bookings {
+		booking := &bookings[i]
+		if err := app.transitionBooking(app.db, booking, models.BookingCancelled, actor, reason); err != nil {
+			app.logger.Error("Failed to cancel booking " + strconv.Itoa(int(booking.ID)) + ": " + err.Error())
+			continue
+		}
+		cancelled = append(cancelled, booking.ID)
+
+		if booking.Email == "" {
+			continue
+		}
+		if err := app.notify(booking.Email, "booking_cancelled", "Booking cancelled", explain(booking)...); err != nil {
+			app.logger.Error("Failed to send cancellation notification: " + err.Error())
+		}
+	}
+	return cancelled, nil
+}
+
+// transitionResponse writes the error response for a failed transition.
+func (app *application) transitionResponse(c *gin.Context, err error) {
+	var invalid *transitionError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusConflict, gin.H{"error": invalid.Error()})
+		return
+	}
+	app.logger.Error("Failed to update booking status: " + err.Error())
+	c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update booking status"})
+}
+
+func (app *application) transitionBookingStatus(c *gin.Context) {
+	var request struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	var booking models.Booking
+	if err := app.db.First(&booking, c.Param("id")).Error; err != nil {
+		app.logger.Error("Booking not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+
+	if err := app.transitionBooking(app.db, &booking, request.Status, c.GetString("userID"), request.Reason); err != nil {
+		app.transitionResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, booking)
+}
+
+func (app *application) getBookingTransitions(c *gin.Context) {
+	var booking models.Booking
+	if err := app.db.First(&booking, c.Param("id")).Error; err != nil {
+		app.logger.Error("Booking not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking not found"})
+		return
+	}
+
+	var transitions []models.BookingTransition
+	if err := app.db.Where("booking_id = ?", booking.ID).Order("created_at, id").Find(&transitions).Error; err != nil {
+		app.logger.Error("Failed to retrieve booking history: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking history"})
+		return
+	}
+
+	c.JSON(http.StatusOK, transitions)
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// localLayouts are the timestamp formats accepted without a UTC offset. They
+// are read in the time zone of the location the request is about.
+var localLayouts = []string{"2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// parseTime reads an RFC 3339 timestamp, or a local timestamp in zone. The
+// result is in UTC, the zone times are stored and compared in.
+func parseTime(raw string, zone *time.Location) (time.Time, error) {
+	parsed, err := time.Parse(time.RFC3339, raw)
+	if err == nil {
+		return parsed.UTC(), nil
+	}
+	for _, layout := range localLayouts {
+		if local, localErr := time.ParseInLocation(layout, raw, zone); localErr == nil {
+			return local.UTC(), nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// parseRequestWindow reads the start_time and end_time of a request body with
+// parseTime. It writes a 400 and returns false when either is invalid or the
+// window is empty.
+func parseRequestWindow(c *gin.Context, rawStart, rawEnd string, zone *time.Location) (schedule.Interval, bool) {
+	start, err := parseTime(rawStart, zone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time"})
+		return schedule.Interval{}, false
+	}
+	end, err := parseTime(rawEnd, zone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time"})
+		return schedule.Interval{}, false
+	}
+	window := schedule.Interval{Start: start, End: end}
+	if window.Empty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidWindow.Error()})
+		return schedule.Interval{}, false
+	}
+	return window, true
+}
+
+// requestZone returns the time zone of the location named by the location_id
+// query parameter, or UTC when there is none.
+func (app *application) requestZone(c *gin.Context) (*time.Location, error) {
+	id := c.Query("location_id")
+	if id == "" {
+		return time.UTC, nil
+	}
+
+	var location models.Location
+	if err := app.db.First(&location, id).Error; err != nil {
+		return nil, err
+	}
+	return location.Zone(), nil
+}
+
+// computerLocation returns the location the computer is in, or nil for
+// computers that are not assigned to a room.
+func (app *application) computerLocation(computerID uint) *models.Location {
+	return locationOf(app.db, computerID)
+}
+
+// locationOf is computerLocation for use inside a transaction.
+func locationOf(db *gorm.DB, computerID uint) *models.Location {
+	var location models.Location
+	err := db.Joins("JOIN rooms ON rooms.location_id = locations.id AND rooms.deleted_at IS NULL").
+		Joins("JOIN computers ON computers.room_id = rooms.id").
+		Where("computers.id = ?", computerID).
+		First(&location).Error
+	if err != nil {
+		return nil
+	}
+	return &location
+}
+
+// computerZone returns the time zone of the location the computer is in, or
+// UTC for computers that are not assigned to a room.
+func (app *application) computerZone(computerID uint) *time.Location {
+	return app.computerLocation(computerID).Zone()
+}
+
+// localTime renders t for humans in the time zone of the computer's location.
+func (app *application) localTime(computerID uint, t time.Time) string {
+	return t.In(app.computerZone(computerID)).Format(time.RFC1123)
+}
+
+// scopeComputers narrows a query over computers by the optional room_id and
+// location_id query parameters.
+func scopeComputers(c *gin.Context, db *gorm.DB, query *gorm.DB) *gorm.DB {
+	if roomID := c.Query("room_id"); roomID != "" {
+		query = query.Where("computers.room_id = ?", roomID)
+	}
+	if locationID := c.Query("location_id"); locationID != "" {
+		rooms := db.Model(&models.Room{}).Select("id").Where("location_id = ?", locationID)
+		query = query.Where("computers.room_id IN (?)", rooms)
+	}
+	return query
+}
+
+// scopedComputerIDs returns a subquery of the ids of the computers selected by
+// the room_id and location_id query parameters, or nil when neither is set.
+func scopedComputerIDs(c *gin.Context, db *gorm.DB) *gorm.DB {
+	if c.Query("room_id") == "" && c.Query("location_id") == "" {
+		return nil
+	}
+	return scopeComputers(c, db, db.Model(&models.Computer{}).Select("computers.id"))
+}
+
+// validateRoom checks that the computer's room, if any, exists.
+func (app *application) validateRoom(c *gin.Context, computer *models.Computer) bool {
+	if computer.RoomID == nil {
+		return true
+	}
+
+	var room models.Room
+	if err := app.db.First(&room, *computer.RoomID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Room not found"})
+		return false
+	}
+	return true
+}
+
+func validTimeZone(name string) bool {
+	if name == "" {
+		return false
+	}
+	_, err := time.LoadLocation(name)
+	return err == nil
+}
+
+func (app *application) createLocation(c *gin.Context) {
+	var location models.Location
+	if err := c.BindJSON(&location); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if location.TimeZone == "" {
+		location.TimeZone = "UTC"
+	}
+	if !validTimeZone(location.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+		return
+	}
+
+	if !app.checkLocationName(c, &location) {
+		return
+	}
+
+	if err := app.db.Create(&location).Error; err != nil {
+		app.logger.Error("Failed to create location: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create location"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, location)
+}
+
+// checkLocationName writes a 409 and returns false when another location has
+// the location's name.
+func (app *application) checkLocationName(c *gin.Context, location *models.Location) bool {
+	var named int64
+	if err := app.db.Model(&models.Location{}).Where("id <> ? AND name = ?", location.ID, location.Name).Count(&named).Error; err != nil {
+		app.logger.Error("Failed to check location name: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check location name"})
+		return false
+	}
+	if named > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another location has that name"})
+		return false
+	}
+	return true
+}
+
+func (app *application) getLocations(c *gin.Context) {
+	var locations []models.Location
+	if err := app.db.Order("name").Find(&locations).Error; err != nil {
+		app.logger.Error("Failed to retrieve locations: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve locations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, locations)
+}
+
+func (app *application) getLocationByID(c *gin.Context) {
+	var location models.Location
+	if err := app.db.First(&location, c.Param("id")).Error; err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, location)
+}
+
+func (app *application) updateLocation(c *gin.Context) {
+	var location models.Location
+	if err := app.db.First(&location, c.Param("id")).Error; err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	if err := c.BindJSON(&location); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if !validTimeZone(location.TimeZone) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown time zone"})
+		return
+	}
+
+	if !app.checkLocationName(c, &location) {
+		return
+	}
+
+	if err := app.db.Save(&location).Error; err != nil {
+		app.logger.Error("Failed to update location: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update location"})
+		return
+	}
+
+	c.JSON(http.StatusOK, location)
+}
+
+func (app *application) deleteLocation(c *gin.Context) {
+	var rooms int64
+	if err := app.db.Model(&models.Room{}).Where("location_id = ?", c.Param("id")).Count(&rooms).Error; err != nil {
+		app.logger.Error("Failed to delete location: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+	if rooms > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Location still has rooms"})
+		return
+	}
+
+	// Locations are deleted for good so that their names can be reused.
+	if err := app.db.Unscoped().Delete(&models.Location{}, c.Param("id")).Error; err != nil {
+		app.logger.Error("Failed to delete location: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete location"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Location deleted successfully"})
+}
+
+func (app *application) createRoom(c *gin.Context) {
+	var location models.Location
+	if err := app.db.First(&location, c.Param("id")).Error; err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	var room models.Room
+	if err := c.BindJSON(&room); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	room.LocationID = location.ID
+
+	if !app.checkRoomName(c, &room) {
+		return
+	}
+
+	if err := app.db.Create(&room).Error; err != nil {
+		app.logger.Error("Failed to create room: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, room)
+}
+
+// checkRoomName writes a 409 and returns false when another room at the
+// room's location has its name.
+func (app *application) checkRoomName(c *gin.Context, room *models.Room) bool {
+	var named int64
+	if err := app.db.Model(&models.Room{}).
+		Where("id <> ? AND location_id = ? AND name = ?", room.ID, room.LocationID, room.Name).
+		Count(&named).Error; err != nil {
+		app.logger.Error("Failed to check room name: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check room name"})
+		return false
+	}
+	if named > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another room at the location has that name"})
+		return false
+	}
+	return true
+}
+
+func (app *application) getRooms(c *gin.Context) {
+	var rooms []models.Room
+	if err := app.db.Where("location_id = ?", c.Param("id")).Order("name").Find(&rooms).Error; err != nil {
+		app.logger.Error("Failed to retrieve rooms: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rooms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rooms)
+}
+
+func (app *application) updateRoom(c *gin.Context) {
+	var room models.Room
+	if err := app.db.First(&room, c.Param("id")).Error; err != nil {
+		app.logger.Error("Room not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	if err := c.BindJSON(&room); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	var location models.Location
+	if err := app.db.First(&location, room.LocationID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Location not found"})
+		return
+	}
+
+	if !app.checkRoomName(c, &room) {
+		return
+	}
+
+	if err := app.db.Save(&room).Error; err != nil {
+		app.logger.Error("Failed to update room: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room"})
+		return
+	}
+
+	c.JSON(http.StatusOK, room)
+}
+
+var errRoomHasComputers = errors.New("room still has computers")
+
+// deleteRoom deletes an empty room together with its floor plan and seats.
+func (app *application) deleteRoom(c *gin.Context) {
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		var computers int64
+		if err := tx.Model(&models.Computer{}).Where("room_id = ?", c.Param("id")).Count(&computers).Error; err != nil {
+			return err
+		}
+		if computers > 0 {
+			return errRoomHasComputers
+		}
+
+		if err := tx.Where("room_id = ?", c.Param("id")).Delete(&models.Seat{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("room_id = ?", c.Param("id")).Delete(&models.FloorPlan{}).Error; err != nil {
+			return err
+		}
+		// Rooms are deleted for good so that their names can be reused.
+		return tx.Unscoped().Delete(&models.Room{}, c.Param("id")).Error
+	})
+	if errors.Is(err, errRoomHasComputers) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Room still has computers"})
+		return
+	}
+	if err != nil {
+		app.logger.Error("Failed to delete room: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete room"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Room deleted successfully"})
+}
@@ -6,11 +6,20 @@ import (
 	"booking/internal/jwt"
 	"booking/internal/logger"
 	"booking/internal/models"
+	"booking/internal/payments"
 	"booking/internal/publisher"
+	"booking/internal/scheduler"
+	"context"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 )
 
 type application struct {
@@ -19,29 +28,108 @@ type application struct {
 	db      *gorm.DB
 	config  *config.Config
 	jwtUtil *jwt.JWTUtil
-	rabbit  *publisher.RabbitPublisher
+	rabbit  publisher.Publisher
+
+	payments payments.Provider
+
+	scheduler *scheduler.Scheduler
 }
 
 func (app *application) initializeRoutes() {
 	app.router.Use(app.LoggingMiddleware)
-	app.router.POST("/book", app.authMiddleware, app.bookComputer)
+	app.router.POST("/book", app.authMiddleware, app.idempotencyMiddleware, app.bookComputer)
 	app.router.GET("/available", app.getAvailableComputers)
+	app.router.GET("/computers/:id/schedule", app.getComputerSchedule)
+	app.router.GET("/locations", app.getLocations)
+	app.router.GET("/locations/:id/rooms", app.getRooms)
+	app.router.GET("/locations/:id/hours", app.getOpeningHours)
+	app.router.GET("/rooms/:id/layout", app.getRoomLayout)
+	app.router.GET("/quote", app.getQuote)
 	app.router.DELETE("/cancel/:id", app.authMiddleware, app.cancelBooking)
+	app.router.POST("/holds", app.authMiddleware, app.idempotencyMiddleware, app.createHold)
+	app.router.POST("/holds/:id/confirm", app.authMiddleware, app.confirmHold)
+	app.router.DELETE("/holds/:id", app.authMiddleware, app.releaseHold)
+	app.router.GET("/me/bookings", app.authMiddleware, app.getMyBookings)
+	app.router.GET("/me/wallet", app.authMiddleware, app.getMyWallet)
+	app.router.GET("/me/wallet/statement", app.authMiddleware, app.getMyStatement)
+	app.router.POST("/me/wallet/top-ups", app.authMiddleware, app.paymentsMiddleware, app.idempotencyMiddleware, app.createTopUp)
+	app.router.GET("/me/payments", app.authMiddleware, app.getMyPayments)
+	app.router.POST("/payments/webhook", app.paymentsMiddleware, app.paymentWebhook)
+	app.router.GET("/slots", app.authMiddleware, app.findSlots)
+	app.router.PATCH("/bookings/:id", app.authMiddleware, app.rescheduleBooking)
+	app.router.POST("/bookings/:id/check-in", app.authMiddleware, app.checkIn)
+	app.router.POST("/bookings/:id/check-out", app.authMiddleware, app.checkOut)
+	app.router.POST("/waitlist", app.authMiddleware, app.joinWaitlist)
+	app.router.GET("/waitlist", app.authMiddleware, app.getWaitlist)
+	app.router.DELETE("/waitlist/:id", app.authMiddleware, app.leaveWaitlist)
+	app.router.POST("/waitlist/:id/claim", app.authMiddleware, app.claimWaitlistOffer)
+	app.router.POST("/groups", app.authMiddleware, app.idempotencyMiddleware, app.bookGroup)
+	app.router.GET("/groups/:id", app.authMiddleware, app.getGroup)
+	app.router.DELETE("/groups/:id", app.authMiddleware, app.cancelGroup)
+	app.router.POST("/issues", app.authMiddleware, app.reportIssue)
+	app.router.GET("/issues", app.authMiddleware, app.getMyIssues)
+	app.router.GET("/issues/:id", app.authMiddleware, app.getIssue)
+	app.router.POST("/issues/:id/comments", app.authMiddleware, app.addIssueComment)
+	app.router.GET("/series/:id", app.authMiddleware, app.getSeries)
+	app.router.DELETE("/series/:id", app.authMiddleware, app.cancelSeries)
+	app.router.DELETE("/series/:id/occurrences/:booking_id", app.authMiddleware, app.cancelSeriesOccurrence)
 
 	admin := app.router.Group("/admin")
 	admin.Use(app.authMiddleware, app.adminMiddleware)
 	{
-		admin.POST("/computers", app.createComputer)
+		admin.POST("/computers", app.idempotencyMiddleware, app.createComputer)
 		admin.GET("/computers", app.getComputers)
 		admin.GET("/computers/:id", app.getComputerByID)
 		admin.PUT("/computers/:id", app.updateComputer)
 		admin.DELETE("/computers/:id", app.deleteComputer)
+		admin.POST("/computers/:id/maintenance", app.createMaintenance)
+		admin.GET("/computers/:id/maintenance", app.getMaintenance)
+		admin.GET("/maintenance", app.getMaintenance)
+		admin.PUT("/maintenance/:id", app.updateMaintenance)
+		admin.POST("/maintenance/:id/end", app.endMaintenance)
+
+		admin.POST("/locations", app.createLocation)
+		admin.GET("/locations", app.getLocations)
+		admin.GET("/locations/:id", app.getLocationByID)
+		admin.PUT("/locations/:id", app.updateLocation)
+		admin.DELETE("/locations/:id", app.deleteLocation)
+		admin.PUT("/locations/:id/hours", app.updateOpeningHours)
+		admin.GET("/locations/:id/closures", app.getClosures)
+		admin.POST("/locations/:id/closures", app.createClosure)
+		admin.DELETE("/closures/:id", app.deleteClosure)
+		admin.POST("/locations/:id/rooms", app.createRoom)
+		admin.GET("/locations/:id/rooms", app.getRooms)
+		admin.PUT("/rooms/:id", app.updateRoom)
+		admin.DELETE("/rooms/:id", app.deleteRoom)
+		admin.PUT("/rooms/:id/layout", app.updateRoomLayout)
+
+		admin.POST("/tariffs", app.createTariff)
+		admin.GET("/tariffs", app.getTariffs)
+		admin.GET("/tariffs/:id", app.getTariffByID)
+		admin.PUT("/tariffs/:id", app.updateTariff)
+		admin.DELETE("/tariffs/:id", app.deleteTariff)
+
+		admin.GET("/wallets/:user_id", app.getWallet)
+		admin.GET("/wallets/:user_id/statement", app.getStatement)
+		admin.POST("/wallets/:user_id/entries", app.createWalletEntry)
+		admin.GET("/payments", app.getPayments)
+		admin.POST("/payments/:id/refund", app.paymentsMiddleware, app.refundPayment)
+
+		admin.GET("/issues", app.getIssues)
+		admin.GET("/issues/:id", app.getIssue)
+		admin.PUT("/issues/:id/assignee", app.assignIssue)
+		admin.POST("/issues/:id/transitions", app.transitionIssue)
+		admin.POST("/issues/:id/comments", app.addIssueComment)
 
-		admin.POST("/bookings", app.createBooking)
+		admin.GET("/jobs", app.getJobs)
+
+		admin.POST("/bookings", app.idempotencyMiddleware, app.createBooking)
 		admin.GET("/bookings", app.getBookings)
 		admin.GET("/bookings/:id", app.getBookingByID)
 		admin.PUT("/bookings/:id", app.updateBooking)
 		admin.DELETE("/bookings/:id", app.deleteBooking)
+		admin.POST("/bookings/:id/transitions", app.transitionBookingStatus)
+		admin.GET("/bookings/:id/transitions", app.getBookingTransitions)
 	}
 }
 
@@ -59,10 +147,38 @@ func newApplication() (*application, error) {
 		return nil, err
 	}
 
-	if err := dbconn.AutoMigrate(&models.Computer{}, &models.Booking{}); err != nil {
+	if err := dbconn.AutoMigrate(
+		&models.Location{},
+		&models.Room{},
+		&models.OpeningHours{},
+		&models.Closure{},
+		&models.FloorPlan{},
+		&models.Seat{},
+		&models.Computer{},
+		&models.MaintenanceWindow{},
+		&models.Booking{},
+		&models.BookingSeries{},
+		&models.BookingGroup{},
+		&models.WaitlistEntry{},
+		&models.Issue{},
+		&models.IssueComment{},
+		&models.BookingTransition{},
+		&models.BookingReminder{},
+		&models.Tariff{},
+		&models.TariffPeak{},
+		&models.TariffClass{},
+		&models.Wallet{},
+		&models.LedgerEntry{},
+		&models.Payment{},
+		&models.IdempotencyKey{},
+	); err != nil {
 		return nil, fmt.Errorf("failed to migrate database: %w", err)
 	}
 
+	if err := db2.EnsureBookingConstraints(dbconn); err != nil {
+		return nil, fmt.Errorf("failed to create booking constraints: %w", err)
+	}
+
 	if cfg.Seeder == "True" {
 		db2.SeedComputers(dbconn)
 	}
@@ -77,18 +193,35 @@ func newApplication() (*application, error) {
 
 	r := publisher.NewRabbitPublisher(cfg.RabbitUrl)
 
+	provider, err := newPaymentProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if provider == nil {
+		myLogger.Info("PAYMENT_PROVIDER is not set, payments are disabled")
+	}
+
 	app := &application{
-		logger:  myLogger,
-		router:  router,
-		db:      dbconn,
-		jwtUtil: jwt.NewJWTUtil(cfg.Secret),
-		config:  cfg,
-		rabbit:  r,
+		logger:    myLogger,
+		router:    router,
+		db:        dbconn,
+		jwtUtil:   jwt.NewJWTUtil(cfg.Secret),
+		config:    cfg,
+		rabbit:    r,
+		payments:  provider,
+		scheduler: scheduler.New(myLogger),
 	}
 
 	app.initializeRoutes()
 
 	myLogger.Info("routes initialized")
+
+	if err := app.registerJobs(); err != nil {
+		return nil, fmt.Errorf("failed to register jobs: %w", err)
+	}
+	app.scheduler.Start(context.Background())
+
+	myLogger.Info("scheduler started")
 	return app, nil
 }
 
@@ -105,8 +238,29 @@ func main() {
 		app.logger.Error(err.Error())
 	}
 
-	app.logger.Info("Starting booking service")
-	if err := app.router.Run(":8080"); err != nil {
-		app.logger.Error(fmt.Sprintf("Could not start server: %s", err))
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: app.router,
 	}
+
+	go func() {
+		app.logger.Info("Starting booking service")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			app.logger.Error(fmt.Sprintf("Could not start server: %s", err))
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	app.logger.Info("Shutting down booking service")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		app.logger.Error(fmt.Sprintf("Could not shut down server: %s", err))
+	}
+
+	app.scheduler.Stop()
 }
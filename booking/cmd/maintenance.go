@@ -0,0 +1,373 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// underMaintenance starts a query over the maintenance windows that block
+// their computer at some point within [from, to). A zero-length window
+// matches the windows in effect at that instant.
+func underMaintenance(db *gorm.DB, from, to time.Time) *gorm.DB {
+	query := db.Model(&models.MaintenanceWindow{})
+	if to.After(from) {
+		query = query.Where("start_time < ?", to)
+	} else {
+		query = query.Where("start_time <= ?", from)
+	}
+	return query.Where("((ended_at IS NOT NULL AND ended_at > ?) OR (ended_at IS NULL AND (expected_end IS NULL OR expected_end > ?)))", from, from)
+}
+
+// maintenanceIntervals returns, for each of the computers, the merged
+// intervals within window during which it is under maintenance.
+func maintenanceIntervals(db *gorm.DB, computerIDs []uint, window schedule.Interval) (map[uint][]schedule.Interval, error) {
+	var windows []models.MaintenanceWindow
+	if err := underMaintenance(db, window.Start, window.End).
+		Where("computer_id IN ?", computerIDs).
+		Find(&windows).Error; err != nil {
+		return nil, err
+	}
+
+	blocked := make(map[uint][]schedule.Interval)
+	for _, maintenance := range windows {
+		interval := schedule.Interval{Start: maintenance.StartTime, End: window.End}
+		if end := maintenance.End(); end != nil {
+			interval.End = *end
+		}
+		blocked[maintenance.ComputerID] = append(blocked[maintenance.ComputerID], interval.Clip(window))
+	}
+	for computerID, intervals := range blocked {
+		blocked[computerID] = schedule.Merge(intervals)
+	}
+	return blocked, nil
+}
+
+// checkMaintenance checks that no maintenance window blocks the computer
+// during any of windows. It writes a 409 naming the maintenance and returns
+// false when one does.
+func (app *application) checkMaintenance(c *gin.Context, computerID uint, windows []schedule.Interval) bool {
+	for _, window := range windows {
+		var maintenance models.MaintenanceWindow
+		err := underMaintenance(app.db, window.Start, window.End).
+			Where("computer_id = ?", computerID).
+			Order("start_time").
+			Limit(1).
+			Find(&maintenance).Error
+		if err != nil {
+			app.logger.Error("Failed to check maintenance: " + err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check maintenance"})
+			return false
+		}
+		if maintenance.ID == 0 {
+			continue
+		}
+
+		c.JSON(http.StatusConflict, gin.H{
+			"error": "Computer is under maintenance during the requested time",
+			"maintenance": gin.H{
+				"id":           maintenance.ID,
+				"reason":       maintenance.Reason,
+				"start_time":   maintenance.StartTime,
+				"expected_end": maintenance.End(),
+			},
+		})
+		return false
+	}
+	return true
+}
+
+// cancelForMaintenance cancels the bookings of the computer that overlap the
+// maintenance window and notifies their owners. It returns the ids of the
+// cancelled bookings.
+func (app *application) cancelForMaintenance(maintenance *models.MaintenanceWindow, actor string) ([]uint, error) {
+	query := app.db.Model(&models.Booking{}).Where("computer_id = ?", maintenance.ComputerID)
+	if end := maintenance.End(); end != nil {
+		query = overlapping(query, maintenance.StartTime, *end)
+	} else {
+		query = query.Where("end_time > ?", maintenance.StartTime)
+	}
+
+	var computer models.Computer
+	if err := app.db.First(&computer, maintenance.ComputerID).Error; err != nil {
+		return nil, err
+	}
+
+	zone := app.computerZone(computer.ID)
+	until := "until further notice"
+	if end := maintenance.End(); end != nil {
+		until = "until " + end.In(zone).Format(time.RFC1123)
+	}
+	return app.cancelBookings(query, actor, "computer under maintenance: "+maintenance.Reason, func(booking *models.Booking) []string {
+		return []string{
+			fmt.Sprintf("Your booking of computer #%d starting %s was cancelled because the computer is under maintenance from %s %s.",
+				computer.Number, booking.StartTime.In(zone).Format(time.RFC1123),
+				maintenance.StartTime.In(zone).Format(time.RFC1123), until),
+			"Reason: " + maintenance.Reason,
+		}
+	})
+}
+
+// applyMaintenance ends maintenance windows whose expected end has passed and
+// brings computer statuses in line with the windows in effect at now:
+// computers under maintenance are taken out of service and the others that
+// were are reopened.
+func (app *application) applyMaintenance(now time.Time) error {
+	if err := app.db.Model(&models.MaintenanceWindow{}).
+		Where("ended_at IS NULL AND expected_end <= ?", now).
+		Update("ended_at", gorm.Expr("expected_end")).Error; err != nil {
+		return err
+	}
+
+	active := underMaintenance(app.db, now, now).Select("computer_id")
+	if err := app.db.Model(&models.Computer{}).
+		Where("status IN ?", []string{models.ComputerAvailable, models.ComputerBooked}).
+		Where("id IN (?)", active).
+		Update("status", models.ComputerMaintenance).Error; err != nil {
+		return err
+	}
+
+	var reopened []models.Computer
+	if err := app.db.Where("status = ? AND id NOT IN (?)", models.ComputerMaintenance, active).
+		Find(&reopened).Error; err != nil {
+		return err
+	}
+	for i := range reopened {
+		computer := &reopened[i]
+		if err := app.db.Model(computer).Update("status", models.ComputerAvailable).Error; err != nil {
+			return err
+		}
+		if err := refreshComputerStatus(app.db, computer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startMaintenance saves a new maintenance window, cancels the bookings it
+// overlaps and takes the computer out of service if the window has begun. It
+// returns the ids of the cancelled bookings.
+func (app *application) startMaintenance(maintenance *models.MaintenanceWindow, actor string) ([]uint, error) {
+	if err := app.openMaintenance(maintenance); err != nil {
+		return nil, err
+	}
+
+	cancelled, err := app.cancelForMaintenance(maintenance, actor)
+	if err != nil {
+		app.logger.Error("Failed to cancel bookings for maintenance: " + err.Error())
+	}
+	return cancelled, nil
+}
+
+// openMaintenance saves a new maintenance window and takes the computer out
+// of service if the window has begun. Bookings it overlaps are kept; the
+// window only stops new ones.
+func (app *application) openMaintenance(maintenance *models.MaintenanceWindow) error {
+	if err := app.db.Create(maintenance).Error; err != nil {
+		return err
+	}
+
+	if err := app.applyMaintenance(time.Now()); err != nil {
+		app.logger.Error("Failed to apply maintenance: " + err.Error())
+	}
+	return nil
+}
+
+// finishMaintenance ends the window now, or before it begins if it has not
+// started, and reopens its computer.
+func (app *application) finishMaintenance(maintenance *models.MaintenanceWindow) error {
+	now := time.Now().UTC()
+	ended := now
+	if ended.Before(maintenance.StartTime) {
+		ended = maintenance.StartTime
+	}
+	if err := app.db.Model(maintenance).Update("ended_at", ended).Error; err != nil {
+		return err
+	}
+	maintenance.EndedAt = &ended
+
+	if err := app.applyMaintenance(now); err != nil {
+		app.logger.Error("Failed to apply maintenance: " + err.Error())
+	}
+	return nil
+}
+
+func (app *application) createMaintenance(c *gin.Context) {
+	var computer models.Computer
+	if err := app.db.First(&computer, c.Param("id")).Error; err != nil {
+		app.logger.Error("Computer not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Computer not found"})
+		return
+	}
+
+	var request struct {
+		Reason      string     `json:"reason"`
+		ReportedBy  string     `json:"reported_by"`
+		StartTime   *time.Time `json:"start_time"`
+		ExpectedEnd *time.Time `json:"expected_end"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if request.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason is required"})
+		return
+	}
+
+	now := time.Now()
+	maintenance := models.MaintenanceWindow{
+		ComputerID:  computer.ID,
+		Reason:      request.Reason,
+		ReportedBy:  request.ReportedBy,
+		StartTime:   now.UTC(),
+		ExpectedEnd: request.ExpectedEnd,
+	}
+	if maintenance.ReportedBy == "" {
+		maintenance.ReportedBy = c.GetString("userID")
+	}
+	if request.StartTime != nil {
+		maintenance.StartTime = request.StartTime.UTC()
+	}
+	if maintenance.ExpectedEnd != nil {
+		end := maintenance.ExpectedEnd.UTC()
+		if !end.After(maintenance.StartTime) || !end.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expected_end must be after start_time and in the future"})
+			return
+		}
+		maintenance.ExpectedEnd = &end
+	}
+
+	cancelled, err := app.startMaintenance(&maintenance, c.GetString("userID"))
+	if err != nil {
+		app.logger.Error("Failed to create maintenance window: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create maintenance window"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"maintenance":        maintenance,
+		"cancelled_bookings": cancelled,
+	})
+}
+
+// getMaintenance lists maintenance windows, newest first, optionally for one
+// computer (computer_id) and overlapping a from/to window. With active=true
+// only the windows in effect now are listed.
+func (app *application) getMaintenance(c *gin.Context) {
+	query := app.db.Model(&models.MaintenanceWindow{})
+	if id := c.Param("id"); id != "" {
+		query = query.Where("computer_id = ?", id)
+	} else if id := c.Query("computer_id"); id != "" {
+		query = query.Where("computer_id = ?", id)
+	}
+
+	if c.Query("active") == "true" {
+		now := time.Now()
+		query = query.Where("id IN (?)", underMaintenance(app.db, now, now).Select("id"))
+	} else if c.Query("from") != "" || c.Query("to") != "" {
+		from, to, err := parseWindow(c, time.UTC)
+		if err != nil {
+			app.logger.Error("Invalid time window: " + err.Error())
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time window"})
+			return
+		}
+		query = query.Where("id IN (?)", underMaintenance(app.db, from, to).Select("id"))
+	}
+
+	var windows []models.MaintenanceWindow
+	if err := query.Order("start_time DESC, id DESC").Find(&windows).Error; err != nil {
+		app.logger.Error("Failed to retrieve maintenance windows: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve maintenance windows"})
+		return
+	}
+
+	c.JSON(http.StatusOK, windows)
+}
+
+// updateMaintenance changes the reason or expected end of a window that has
+// not ended. Bookings the longer window now overlaps are cancelled.
+func (app *application) updateMaintenance(c *gin.Context) {
+	var maintenance models.MaintenanceWindow
+	if err := app.db.First(&maintenance, c.Param("id")).Error; err != nil {
+		app.logger.Error("Maintenance window not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Maintenance window not found"})
+		return
+	}
+
+	if maintenance.EndedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Maintenance window has already ended"})
+		return
+	}
+
+	var request struct {
+		Reason      string     `json:"reason"`
+		ExpectedEnd *time.Time `json:"expected_end"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	now := time.Now()
+	if request.Reason != "" {
+		maintenance.Reason = request.Reason
+	}
+	if request.ExpectedEnd != nil {
+		end := request.ExpectedEnd.UTC()
+		if !end.After(maintenance.StartTime) || !end.After(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "expected_end must be after start_time and in the future"})
+			return
+		}
+		maintenance.ExpectedEnd = &end
+	}
+
+	if err := app.db.Save(&maintenance).Error; err != nil {
+		app.logger.Error("Failed to update maintenance window: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update maintenance window"})
+		return
+	}
+
+	cancelled, err := app.cancelForMaintenance(&maintenance, c.GetString("userID"))
+	if err != nil {
+		app.logger.Error("Failed to cancel bookings for maintenance: " + err.Error())
+	}
+	if err := app.applyMaintenance(now); err != nil {
+		app.logger.Error("Failed to apply maintenance: " + err.Error())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"maintenance":        maintenance,
+		"cancelled_bookings": cancelled,
+	})
+}
+
+// endMaintenance ends a window now and reopens its computer.
+func (app *application) endMaintenance(c *gin.Context) {
+	var maintenance models.MaintenanceWindow
+	if err := app.db.First(&maintenance, c.Param("id")).Error; err != nil {
+		app.logger.Error("Maintenance window not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Maintenance window not found"})
+		return
+	}
+
+	if maintenance.EndedAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Maintenance window has already ended"})
+		return
+	}
+
+	if err := app.finishMaintenance(&maintenance); err != nil {
+		app.logger.Error("Failed to end maintenance window: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to end maintenance window"})
+		return
+	}
+
+	c.JSON(http.StatusOK, maintenance)
+}
@@ -43,6 +43,16 @@ func (app *application) adminMiddleware(c *gin.Context) {
 	c.Next()
 }
 
+// paymentsMiddleware answers 503 when no payment provider is configured.
+func (app *application) paymentsMiddleware(c *gin.Context) {
+	if app.payments == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Payments are not available"})
+		c.Abort()
+		return
+	}
+	c.Next()
+}
+
 func (app *application) LoggingMiddleware(c *gin.Context) {
 	startTime := time.Now()
 
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"booking/internal/models"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type userBooking struct {
+	models.Booking
+	ComputerNumber int
+	TimeZone       string
+}
+
+// bookingCursor marks the position after the last item of a page. Items are
+// ordered by start time with the id as tie-breaker.
+type bookingCursor struct {
+	StartTime time.Time
+	ID        uint
+}
+
+func (c bookingCursor) encode() string {
+	raw := c.StartTime.UTC().Format(time.RFC3339Nano) + "|" + strconv.FormatUint(uint64(c.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeBookingCursor(value string) (bookingCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return bookingCursor{}, err
+	}
+
+	start, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return bookingCursor{}, errors.New("malformed cursor")
+	}
+
+	startTime, err := time.Parse(time.RFC3339Nano, start)
+	if err != nil {
+		return bookingCursor{}, err
+	}
+	parsedID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return bookingCursor{}, err
+	}
+	return bookingCursor{StartTime: startTime, ID: uint(parsedID)}, nil
+}
+
+// getMyBookings lists the caller's bookings. Upcoming bookings (the default
+// when "when" is not "past") are returned soonest first, past bookings most
+// recent first.
+func (app *application) getMyBookings(c *gin.Context) {
+	query := app.db.Model(&models.Booking{}).
+		Select("bookings.*, computers.number AS computer_number, locations.time_zone AS time_zone").
+		Joins("LEFT JOIN computers ON computers.id = bookings.computer_id").
+		Joins("LEFT JOIN rooms ON rooms.id = computers.room_id").
+		Joins("LEFT JOIN locations ON locations.id = rooms.location_id").
+		Where("bookings.user_id = ?", c.GetString("userID"))
+	if scope := scopedComputerIDs(c, app.db); scope != nil {
+		query = query.Where("bookings.computer_id IN (?)", scope)
+	}
+
+	now := time.Now()
+	descending := false
+	switch c.Query("when") {
+	case "", "all":
+	case "upcoming":
+		query = query.Where("bookings.end_time > ?", now)
+	case "past":
+		query = query.Where("bookings.end_time <= ?", now)
+		descending = true
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "when must be upcoming, past or all"})
+		return
+	}
+
+	if status := c.Query("status"); status != "" {
+		query = query.Where("bookings.status IN ?", strings.Split(status, ","))
+	}
+
+	// from and to without an offset are read in the time zone of location_id,
+	// or UTC.
+	zone, err := app.requestZone(c)
+	if err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+	for _, bound := range []struct {
+		param, condition string
+	}{
+		{"from", "bookings.end_time > ?"},
+		{"to", "bookings.start_time < ?"},
+	} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		value, err := parseTime(raw, zone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param + " time"})
+			return
+		}
+		query = query.Where(bound.condition, value)
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultPageSize)))
+	if err != nil || limit < 1 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	if raw := c.Query("cursor"); raw != "" {
+		cursor, err := decodeBookingCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return
+		}
+		if descending {
+			query = query.Where("bookings.start_time < ? OR (bookings.start_time = ? AND bookings.id < ?)", cursor.StartTime, cursor.StartTime, cursor.ID)
+		} else {
+			query = query.Where("bookings.start_time > ? OR (bookings.start_time = ? AND bookings.id > ?)", cursor.StartTime, cursor.StartTime, cursor.ID)
+		}
+	}
+
+	if descending {
+		query = query.Order("bookings.start_time DESC, bookings.id DESC")
+	} else {
+		query = query.Order("bookings.start_time, bookings.id")
+	}
+
+	// One extra row tells whether there is a next page.
+	items := make([]userBooking, 0, limit+1)
+	if err := query.Limit(limit + 1).Scan(&items).Error; err != nil {
+		app.logger.Error("Failed to retrieve bookings: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
+	}
+
+	var nextCursor string
+	if len(items) > limit {
+		items = items[:limit]
+		last := items[len(items)-1]
+		nextCursor = bookingCursor{StartTime: last.StartTime, ID: last.ID}.encode()
+	}
+
+	// Render each booking in the time zone of its computer's location.
+	for i := range items {
+		location := models.Location{TimeZone: items[i].TimeZone}
+		zone := location.Zone()
+		items[i].TimeZone = zone.String()
+		items[i].StartTime = items[i].StartTime.In(zone)
+		items[i].EndTime = items[i].EndTime.In(zone)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"bookings":    items,
+		"next_cursor": nextCursor,
+	})
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/publisher"
+	"bytes"
+	"html/template"
+)
+
+type NotificationData struct {
+	RecipientEmail string
+	Title          string
+	Lines          []string
+}
+
+var notificationTemplate = template.Must(template.New("notification").Parse(models.NotificationTemplate))
+
+// notify publishes a generic notification of the given type to the email
+// queue. Each line is rendered as its own paragraph.
+func (app *application) notify(recipient, msgType, title string, lines ...string) error {
+	var body bytes.Buffer
+	if err := notificationTemplate.Execute(&body, NotificationData{
+		RecipientEmail: recipient,
+		Title:          title,
+		Lines:          lines,
+	}); err != nil {
+		return err
+	}
+
+	return app.rabbit.PublishMessage(publisher.Message{
+		Type:      msgType,
+		Message:   body.String(),
+		Recipient: recipient,
+	})
+}
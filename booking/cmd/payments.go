@@ -0,0 +1,375 @@
+package main
+
+import (
+	"booking/internal/config"
+	"booking/internal/models"
+	"booking/internal/payments"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errPaymentSettled = errors.New("payment was settled by another request")
+
+// newPaymentProvider returns the payment provider named in the config, or nil
+// when none is configured and payments are disabled. The fake provider hands
+// out money for nothing, so it is only allowed in debug mode; call this after
+// gin.SetMode.
+func newPaymentProvider(cfg *config.Config) (payments.Provider, error) {
+	if cfg.PaymentProvider == "" {
+		return nil, nil
+	}
+	if cfg.PaymentWebhookSecret == "" {
+		return nil, errors.New("PAYMENT_WEBHOOK_SECRET is not set")
+	}
+
+	switch cfg.PaymentProvider {
+	case "fake":
+		if gin.Mode() != gin.DebugMode {
+			return nil, errors.New("the fake payment provider is only allowed in debug mode")
+		}
+		return payments.NewFake(cfg.PaymentWebhookSecret, cfg.PaymentFakeDelay, cfg.PaymentWebhookURL), nil
+	}
+	return nil, fmt.Errorf("unknown payment provider %q", cfg.PaymentProvider)
+}
+
+// formatAmount renders an amount in minor units for humans.
+func formatAmount(amount int64, currency string) string {
+	return fmt.Sprintf("%.2f %s", float64(amount)/100, currency)
+}
+
+// settlePayment records the outcome of the payment's intent once it is final.
+// A successful payment credits the owner's wallet exactly once, however often
+// the outcome is reported. Intents that have not settled are ignored.
+func (app *application) settlePayment(payment *models.Payment, intent payments.Intent) error {
+	var status string
+	switch intent.Status {
+	case payments.IntentSucceeded:
+		status = models.PaymentSucceeded
+	case payments.IntentFailed:
+		status = models.PaymentFailed
+	default:
+		return nil
+	}
+	if intent.Amount != payment.Amount || !strings.EqualFold(intent.Currency, payment.Currency) {
+		return fmt.Errorf("intent %s is for %s, payment %d for %s", intent.ID,
+			formatAmount(intent.Amount, intent.Currency), payment.ID, formatAmount(payment.Amount, payment.Currency))
+	}
+
+	now := time.Now().UTC()
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(payment).
+			Where("status = ?", models.PaymentPending).
+			Updates(map[string]interface{}{"status": status, "failure_reason": intent.FailureReason, "settled_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPaymentSettled
+		}
+		if status != models.PaymentSucceeded {
+			return nil
+		}
+		return postEntry(tx, payment.UserID, payment.Currency, &models.LedgerEntry{
+			Kind:      models.LedgerTopUp,
+			Amount:    payment.Amount,
+			PaymentID: &payment.ID,
+			ActorID:   systemActor,
+			Note:      fmt.Sprintf("Payment #%d", payment.ID),
+		})
+	})
+	if errors.Is(err, errPaymentSettled) {
+		return app.db.First(payment, payment.ID).Error
+	}
+	if err != nil {
+		return err
+	}
+	payment.Status, payment.FailureReason, payment.SettledAt = status, intent.FailureReason, &now
+
+	if payment.Email != "" {
+		amount := formatAmount(payment.Amount, payment.Currency)
+		if status == models.PaymentSucceeded {
+			err = app.notify(payment.Email, "payment_succeeded", "Wallet topped up",
+				fmt.Sprintf("Your payment of %s was added to your wallet.", amount))
+		} else {
+			err = app.notify(payment.Email, "payment_failed", "Payment failed",
+				fmt.Sprintf("Your payment of %s did not go through: %s.", amount, intent.FailureReason))
+		}
+		if err != nil {
+			app.logger.Error("Failed to send payment notification: " + err.Error())
+		}
+	}
+	return nil
+}
+
+// failPayment gives up on a payment whose intent could not be created or
+// has gone missing at the provider.
+func (app *application) failPayment(payment *models.Payment, reason string) error {
+	now := time.Now().UTC()
+	result := app.db.Model(payment).
+		Where("status = ?", models.PaymentPending).
+		Updates(map[string]interface{}{"status": models.PaymentFailed, "failure_reason": reason, "settled_at": now})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		payment.Status, payment.FailureReason, payment.SettledAt = models.PaymentFailed, reason, &now
+	}
+	return nil
+}
+
+// createTopUp pays money into the caller's wallet. The payment is captured
+// straight away; the wallet is credited when the provider reports success,
+// which may only happen later through the webhook.
+func (app *application) createTopUp(c *gin.Context) {
+	var request struct {
+		Amount   int64  `json:"amount"`
+		Currency string `json:"currency"`
+		Method   string `json:"method"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	if request.Amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive"})
+		return
+	}
+	if len(request.Currency) != 3 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be a three letter code"})
+		return
+	}
+
+	payment := models.Payment{
+		UserID:   c.GetString("userID"),
+		Email:    c.GetString("email"),
+		Provider: app.payments.Name(),
+		Amount:   request.Amount,
+		Currency: strings.ToUpper(request.Currency),
+		Status:   models.PaymentPending,
+	}
+	if err := app.db.Create(&payment).Error; err != nil {
+		app.logger.Error("Failed to create payment: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		return
+	}
+
+	ctx := c.Request.Context()
+	intent, err := app.payments.CreateIntent(ctx, payments.IntentRequest{
+		Amount:    payment.Amount,
+		Currency:  payment.Currency,
+		Method:    request.Method,
+		Reference: fmt.Sprintf("payment-%d", payment.ID),
+	})
+	if err != nil {
+		app.logger.Error("Failed to create payment intent: " + err.Error())
+		if err := app.failPayment(&payment, "payment provider unavailable"); err != nil {
+			app.logger.Error("Failed to update payment: " + err.Error())
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Payment provider unavailable"})
+		return
+	}
+	if err := app.db.Model(&payment).Update("provider_ref", intent.ID).Error; err != nil {
+		app.logger.Error("Failed to update payment: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create payment"})
+		return
+	}
+
+	// A failed capture leaves the payment pending for reconciliation.
+	if intent, err = app.payments.Capture(ctx, intent.ID); err != nil {
+		app.logger.Error("Failed to capture payment: " + err.Error())
+	} else if err := app.settlePayment(&payment, intent); err != nil {
+		app.logger.Error("Failed to settle payment: " + err.Error())
+	}
+
+	switch payment.Status {
+	case models.PaymentSucceeded:
+		c.JSON(http.StatusCreated, payment)
+	case models.PaymentFailed:
+		c.JSON(http.StatusPaymentRequired, gin.H{"error": "Payment failed", "reason": payment.FailureReason, "payment": payment})
+	default:
+		c.JSON(http.StatusAccepted, payment)
+	}
+}
+
+// getMyPayments lists the caller's top-ups, newest first.
+func (app *application) getMyPayments(c *gin.Context) {
+	var list []models.Payment
+	if err := app.db.Where("user_id = ?", c.GetString("userID")).
+		Order("created_at DESC, id DESC").
+		Find(&list).Error; err != nil {
+		app.logger.Error("Failed to retrieve payments: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// getPayments lists top-ups for admins, newest first, filtered by the
+// optional status and user_id query parameters.
+func (app *application) getPayments(c *gin.Context) {
+	query := app.db.Model(&models.Payment{})
+	for _, filter := range []string{"status", "user_id"} {
+		if value := c.Query(filter); value != "" {
+			query = query.Where(filter+" = ?", value)
+		}
+	}
+
+	var list []models.Payment
+	if err := query.Order("created_at DESC, id DESC").Find(&list).Error; err != nil {
+		app.logger.Error("Failed to retrieve payments: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve payments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, list)
+}
+
+// paymentWebhook receives settlements from the payment provider. The body
+// must carry a valid signature. Deliveries may repeat; settling is
+// idempotent.
+func (app *application) paymentWebhook(c *gin.Context) {
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		app.logger.Error("Failed to read webhook: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	event, err := app.payments.VerifyWebhook(payload, c.GetHeader(payments.SignatureHeader))
+	if err != nil {
+		app.logger.Error("Rejected payment webhook: " + err.Error())
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var payment models.Payment
+	if err := app.db.Where("provider = ? AND provider_ref = ?", app.payments.Name(), event.Intent.ID).
+		First(&payment).Error; err != nil {
+		app.logger.Error("Payment not found for webhook: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+
+	if err := app.settlePayment(&payment, event.Intent); err != nil {
+		app.logger.Error("Failed to settle payment: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to settle payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": event.ID, "payment": payment})
+}
+
+// refundPayment returns a top-up to the payer. The amount leaves the wallet,
+// so it must not have been spent.
+func (app *application) refundPayment(c *gin.Context) {
+	var payment models.Payment
+	if err := app.db.First(&payment, c.Param("id")).Error; err != nil {
+		app.logger.Error("Payment not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Payment not found"})
+		return
+	}
+	if payment.Status != models.PaymentSucceeded {
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot refund a " + payment.Status + " payment"})
+		return
+	}
+
+	// The wallet is debited first, so a refund the provider rejects rolls
+	// back with it.
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&payment).
+			Where("status = ?", models.PaymentSucceeded).
+			Update("status", models.PaymentRefunded)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPaymentSettled
+		}
+		if err := postEntry(tx, payment.UserID, payment.Currency, &models.LedgerEntry{
+			Kind:      models.LedgerRefund,
+			Amount:    -payment.Amount,
+			PaymentID: &payment.ID,
+			ActorID:   c.GetString("userID"),
+			Note:      fmt.Sprintf("Payment #%d refunded to the payer", payment.ID),
+		}); err != nil {
+			return err
+		}
+		_, err := app.payments.Refund(c.Request.Context(), payment.ProviderRef, payment.Amount)
+		return err
+	})
+	var funds *fundsError
+	switch {
+	case errors.As(err, &funds):
+		fundsResponse(c, http.StatusConflict, funds)
+		return
+	case errors.Is(err, errPaymentSettled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Payment was changed by another request, please retry"})
+		return
+	case err != nil:
+		app.logger.Error("Failed to refund payment: " + err.Error())
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to refund payment"})
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// reconcilePayments asks the provider about payments that have been pending
+// longer than PaymentReconcileAfter, in case a webhook was lost or a capture
+// failed, and settles those that have an outcome. It returns how many
+// payments were settled.
+func (app *application) reconcilePayments(ctx context.Context, now time.Time) (int, error) {
+	var pending []models.Payment
+	if err := app.db.Where("status = ? AND provider = ? AND created_at < ?",
+		models.PaymentPending, app.payments.Name(), now.Add(-app.config.PaymentReconcileAfter)).
+		Order("id").
+		Find(&pending).Error; err != nil {
+		return 0, err
+	}
+
+	settled := 0
+	for i := range pending {
+		payment := &pending[i]
+		if payment.ProviderRef == "" {
+			if err := app.failPayment(payment, "payment intent was never created"); err != nil {
+				return settled, err
+			}
+			settled++
+			continue
+		}
+
+		intent, err := app.payments.Intent(ctx, payment.ProviderRef)
+		if errors.Is(err, payments.ErrNotFound) {
+			if err := app.failPayment(payment, "payment intent not found"); err != nil {
+				return settled, err
+			}
+			settled++
+			continue
+		}
+		if err == nil && intent.Status == payments.IntentRequiresCapture {
+			intent, err = app.payments.Capture(ctx, intent.ID)
+		}
+		if err != nil {
+			app.logger.Error(fmt.Sprintf("Failed to reconcile payment %d: %s", payment.ID, err))
+			continue
+		}
+
+		if err := app.settlePayment(payment, intent); err != nil {
+			app.logger.Error(fmt.Sprintf("Failed to settle payment %d: %s", payment.ID, err))
+			continue
+		}
+		if payment.Status != models.PaymentPending {
+			settled++
+		}
+	}
+	return settled, nil
+}
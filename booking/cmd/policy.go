@@ -0,0 +1,99 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/policy"
+	"booking/internal/schedule"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+// checkWindows runs the checks that booking windows on computerID has to pass
+// besides the computer being free: maintenance, opening hours and the booking
+// policy. It writes the error response itself.
+func (app *application) checkWindows(c *gin.Context, computerID uint, windows []schedule.Interval, changing *models.Booking) bool {
+	return app.checkMaintenance(c, computerID, windows) &&
+		app.checkOpeningHours(c, computerID, windows) &&
+		app.checkPolicy(c, computerID, windows, changing)
+}
+
+// checkPolicy checks the caller's booking of windows on computerID against
+// the booking policy for their role and the computer's location. Windows are
+// checked in order, each counting towards the quotas of the ones after it;
+// more than one window are the occurrences of a series. The seats of a group
+// booking count as one booking. changing is the booking being rescheduled, if
+// any; it is left out of the quotas. It writes a 422 listing the violations
+// and returns false when the policy is broken.
+func (app *application) checkPolicy(c *gin.Context, computerID uint, windows []schedule.Interval, changing *models.Booking) bool {
+	if len(windows) == 0 {
+		return true
+	}
+
+	var locationID uint
+	zone := time.UTC
+	if location := app.computerLocation(computerID); location != nil {
+		locationID = location.ID
+		zone = location.Zone()
+	}
+	rules := app.config.Policy.For(c.GetString("role"), locationID)
+
+	// Quotas look at most a week either side of the requested windows.
+	first, last := windows[0].Start, windows[0].End
+	for _, window := range windows {
+		if window.Start.Before(first) {
+			first = window.Start
+		}
+		if window.End.After(last) {
+			last = window.End
+		}
+	}
+	query := activeBookings(app.db).
+		Where("user_id = ?", c.GetString("userID")).
+		Where("end_time > ? AND start_time < ?", first.AddDate(0, 0, -7), last.AddDate(0, 0, 7))
+	started := false
+	if changing != nil {
+		query = query.Where("id <> ?", changing.ID)
+		started = changing.Status == models.BookingCheckedIn
+	}
+	var bookings []models.Booking
+	if err := query.Find(&bookings).Error; err != nil {
+		app.logger.Error("Failed to check booking policy: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check booking policy"})
+		return false
+	}
+
+	existing := make([]schedule.Interval, 0, len(bookings)+len(windows))
+	groups := make(map[uint]bool)
+	for _, booking := range bookings {
+		if booking.GroupID != nil {
+			if groups[*booking.GroupID] {
+				continue
+			}
+			groups[*booking.GroupID] = true
+		}
+		existing = append(existing, schedule.Interval{Start: booking.StartTime, End: booking.EndTime})
+	}
+
+	now := time.Now()
+	for i, window := range windows {
+		violations := rules.Check(policy.Request{
+			Window:    window,
+			Now:       now,
+			Zone:      zone,
+			Existing:  existing,
+			Started:   started,
+			Recurring: i > 0,
+		})
+		if len(violations) > 0 {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{
+				"error":      "Booking violates the booking policy",
+				"window":     window,
+				"violations": violations,
+			})
+			return false
+		}
+		existing = append(existing, window)
+	}
+	return true
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"booking/internal/hours"
+	"booking/internal/models"
+	"booking/internal/pricing"
+	"booking/internal/schedule"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	errTariffTaken     = errors.New("another tariff already applies there")
+	errTariffNameTaken = errors.New("another tariff has that name")
+)
+
+// toPricing converts the stored tariff into its pricing rules.
+func toPricing(tariff *models.Tariff) (pricing.Tariff, error) {
+	rules := pricing.Tariff{
+		Currency:          tariff.Currency,
+		HourlyRate:        tariff.HourlyRate,
+		WeekendMultiplier: tariff.WeekendMultiplier,
+		ClassMultipliers:  make(map[string]float64, len(tariff.Classes)),
+		MinimumCharge:     tariff.MinimumCharge,
+	}
+	for _, peak := range tariff.Peaks {
+		start, err := hours.ParseClock(peak.Starts)
+		if err != nil {
+			return rules, err
+		}
+		end, err := hours.ParseClock(peak.Ends)
+		if err != nil {
+			return rules, err
+		}
+		rules.Peaks = append(rules.Peaks, pricing.Peak{
+			Weekday:    time.Weekday(peak.Weekday),
+			Start:      start,
+			End:        end,
+			Multiplier: peak.Multiplier,
+		})
+	}
+	for _, class := range tariff.Classes {
+		if class.Class == "" {
+			return rules, errors.New("class multipliers need a class")
+		}
+		if _, ok := rules.ClassMultipliers[class.Class]; ok {
+			return rules, fmt.Errorf("class %q is listed twice", class.Class)
+		}
+		rules.ClassMultipliers[class.Class] = class.Multiplier
+	}
+	return rules, rules.Validate()
+}
+
+func preloadTariff(db *gorm.DB) *gorm.DB {
+	return db.Preload("Peaks", func(db *gorm.DB) *gorm.DB {
+		return db.Order("weekday, starts")
+	}).Preload("Classes", func(db *gorm.DB) *gorm.DB {
+		return db.Order("class")
+	})
+}
+
+// tariffAt returns the tariff of the location, falling back to the default
+// tariff, or nil when neither exists.
+func tariffAt(db *gorm.DB, location *models.Location) (*models.Tariff, error) {
+	var tariffs []models.Tariff
+	query := preloadTariff(db).Where("location_id IS NULL")
+	if location != nil {
+		query = preloadTariff(db).Where("location_id = ? OR location_id IS NULL", location.ID)
+	}
+	// The location's own tariff sorts before the default.
+	if err := query.Order("location_id IS NULL").Find(&tariffs).Error; err != nil {
+		return nil, err
+	}
+	if len(tariffs) == 0 {
+		return nil, nil
+	}
+	return &tariffs[0], nil
+}
+
+// quoteWindow prices window on the computer, or returns nil when no tariff
+// applies to it.
+func quoteWindow(db *gorm.DB, computer *models.Computer, window schedule.Interval) (*models.Tariff, *pricing.Quote, error) {
+	location := locationOf(db, computer.ID)
+	tariff, err := tariffAt(db, location)
+	if err != nil || tariff == nil {
+		return nil, nil, err
+	}
+	rules, err := toPricing(tariff)
+	if err != nil {
+		return nil, nil, fmt.Errorf("tariff %d: %w", tariff.ID, err)
+	}
+	quote := rules.Quote(window, location.Zone(), computer.Class)
+	return tariff, &quote, nil
+}
+
+// priceBooking sets the booking's price from the tariff that applies to its
+// computer. Bookings are free when there is no tariff.
+func priceBooking(tx *gorm.DB, booking *models.Booking) error {
+	var computer models.Computer
+	if err := tx.First(&computer, booking.ComputerID).Error; err != nil {
+		return err
+	}
+	_, quote, err := quoteWindow(tx, &computer, schedule.Interval{Start: booking.StartTime, End: booking.EndTime})
+	if err != nil {
+		return err
+	}
+	booking.Price, booking.Currency = 0, ""
+	if quote != nil {
+		booking.Price, booking.Currency = quote.Total, quote.Currency
+	}
+	return nil
+}
+
+// getQuote prices a prospective booking of computer_id from start_time to
+// end_time without reserving it. Times without an offset are read in the time
+// zone of the computer's location.
+func (app *application) getQuote(c *gin.Context) {
+	computerID, err := strconv.ParseUint(c.Query("computer_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "computer_id is required"})
+		return
+	}
+
+	var computer models.Computer
+	if err := app.db.First(&computer, computerID).Error; err != nil {
+		app.logger.Error("Computer not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Computer not found"})
+		return
+	}
+
+	zone := app.computerZone(computer.ID)
+	start, err := parseTime(c.Query("start_time"), zone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time"})
+		return
+	}
+	end, err := parseTime(c.Query("end_time"), zone)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time"})
+		return
+	}
+	window := schedule.Interval{Start: start, End: end}
+	if window.Empty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidWindow.Error()})
+		return
+	}
+
+	tariff, quote, err := quoteWindow(app.db, &computer, window)
+	if err != nil {
+		app.logger.Error("Failed to quote booking: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to quote booking"})
+		return
+	}
+
+	response := gin.H{"computer_id": computer.ID, "start_time": start, "end_time": end, "tariff": nil, "quote": nil}
+	if tariff != nil {
+		response["tariff"] = tariff.Name
+		response["quote"] = quote
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// validateTariff checks the tariff's rules and that its location exists. It
+// writes the error response itself.
+func (app *application) validateTariff(c *gin.Context, tariff *models.Tariff) bool {
+	if tariff.Name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required"})
+		return false
+	}
+	tariff.Currency = strings.ToUpper(tariff.Currency)
+	if _, err := toPricing(tariff); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if tariff.LocationID != nil {
+		if err := app.db.First(&models.Location{}, *tariff.LocationID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Location not found"})
+			return false
+		}
+	}
+	return true
+}
+
+// claimTariffScope fails with errTariffTaken when a tariff other than this
+// one already covers its location, or is already the default, and with
+// errTariffNameTaken when another tariff has its name.
+func claimTariffScope(tx *gorm.DB, tariff *models.Tariff) error {
+	var named int64
+	if err := tx.Model(&models.Tariff{}).Where("id <> ? AND name = ?", tariff.ID, tariff.Name).Count(&named).Error; err != nil {
+		return err
+	}
+	if named > 0 {
+		return errTariffNameTaken
+	}
+
+	query := tx.Model(&models.Tariff{}).Where("id <> ?", tariff.ID)
+	if tariff.LocationID == nil {
+		query = query.Where("location_id IS NULL")
+	} else {
+		query = query.Where("location_id = ?", *tariff.LocationID)
+	}
+	var taken int64
+	if err := query.Count(&taken).Error; err != nil {
+		return err
+	}
+	if taken > 0 {
+		return errTariffTaken
+	}
+	return nil
+}
+
+func (app *application) createTariff(c *gin.Context) {
+	var tariff models.Tariff
+	if err := c.BindJSON(&tariff); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	tariff.ID = 0
+	if !app.validateTariff(c, &tariff) {
+		return
+	}
+
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		if err := claimTariffScope(tx, &tariff); err != nil {
+			return err
+		}
+		return tx.Create(&tariff).Error
+	})
+	if errors.Is(err, errTariffTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another tariff already applies there"})
+		return
+	}
+	if errors.Is(err, errTariffNameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another tariff has that name"})
+		return
+	}
+	if err != nil {
+		app.logger.Error("Failed to create tariff: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create tariff"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, tariff)
+}
+
+func (app *application) getTariffs(c *gin.Context) {
+	var tariffs []models.Tariff
+	if err := preloadTariff(app.db).Order("name").Find(&tariffs).Error; err != nil {
+		app.logger.Error("Failed to retrieve tariffs: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tariffs"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tariffs)
+}
+
+func (app *application) getTariffByID(c *gin.Context) {
+	var tariff models.Tariff
+	if err := preloadTariff(app.db).First(&tariff, c.Param("id")).Error; err != nil {
+		app.logger.Error("Tariff not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tariff not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tariff)
+}
+
+// updateTariff replaces the tariff, including all of its peaks and class
+// multipliers. Bookings already made keep the price they were quoted.
+func (app *application) updateTariff(c *gin.Context) {
+	var tariff models.Tariff
+	if err := app.db.First(&tariff, c.Param("id")).Error; err != nil {
+		app.logger.Error("Tariff not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tariff not found"})
+		return
+	}
+
+	id := tariff.ID
+	if err := c.BindJSON(&tariff); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+	tariff.ID = id
+	if !app.validateTariff(c, &tariff) {
+		return
+	}
+
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		if err := claimTariffScope(tx, &tariff); err != nil {
+			return err
+		}
+		if err := tx.Omit(clause.Associations).Save(&tariff).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tariff_id = ?", tariff.ID).Delete(&models.TariffPeak{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tariff_id = ?", tariff.ID).Delete(&models.TariffClass{}).Error; err != nil {
+			return err
+		}
+		for i := range tariff.Peaks {
+			tariff.Peaks[i].ID, tariff.Peaks[i].TariffID = 0, tariff.ID
+		}
+		for i := range tariff.Classes {
+			tariff.Classes[i].ID, tariff.Classes[i].TariffID = 0, tariff.ID
+		}
+		if len(tariff.Peaks) > 0 {
+			if err := tx.Create(&tariff.Peaks).Error; err != nil {
+				return err
+			}
+		}
+		if len(tariff.Classes) > 0 {
+			return tx.Create(&tariff.Classes).Error
+		}
+		return nil
+	})
+	if errors.Is(err, errTariffTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another tariff already applies there"})
+		return
+	}
+	if errors.Is(err, errTariffNameTaken) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Another tariff has that name"})
+		return
+	}
+	if err != nil {
+		app.logger.Error("Failed to update tariff: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update tariff"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tariff)
+}
+
+// deleteTariff removes the tariff for good, so that its name can be reused.
+// Bookings keep the price they were quoted.
+func (app *application) deleteTariff(c *gin.Context) {
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("tariff_id = ?", c.Param("id")).Delete(&models.TariffPeak{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("tariff_id = ?", c.Param("id")).Delete(&models.TariffClass{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Delete(&models.Tariff{}, c.Param("id")).Error
+	})
+	if err != nil {
+		app.logger.Error("Failed to delete tariff: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete tariff"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Tariff deleted successfully"})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"booking/internal/models"
+	"fmt"
+	"gorm.io/gorm/clause"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// sendDueReminders publishes a booking_reminder for every confirmed booking
+// that has reached one of the configured reminder offsets before its start.
+// Cancelled bookings are no longer confirmed and moved bookings have a new
+// start time, so their pending reminders are withdrawn implicitly.
+func (app *application) sendDueReminders(now time.Time) (int, error) {
+	offsets := append([]time.Duration(nil), app.config.ReminderOffsets...)
+	if len(offsets) == 0 {
+		return 0, nil
+	}
+	sort.Slice(offsets, func(a, b int) bool { return offsets[a] < offsets[b] })
+
+	var bookings []models.Booking
+	if err := app.db.Where("status = ? AND start_time > ? AND start_time <= ?", models.BookingConfirmed, now, now.Add(offsets[len(offsets)-1])).
+		Find(&bookings).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range bookings {
+		booking := &bookings[i]
+		if booking.Email == "" {
+			continue
+		}
+
+		// Only the closest due offset is sent; the ones before it are recorded
+		// as sent so a late start-up does not deliver a stale "24h" reminder
+		// after the "15m" one.
+		var due []time.Duration
+		for _, offset := range offsets {
+			dueAt := booking.StartTime.Add(-offset)
+			if !now.Before(dueAt) && !booking.CreatedAt.After(dueAt) {
+				due = append(due, offset)
+			}
+		}
+		if len(due) == 0 {
+			continue
+		}
+
+		var claimed *models.BookingReminder
+		for _, offset := range due {
+			reminder := models.BookingReminder{
+				BookingID: booking.ID,
+				Offset:    offset,
+				StartTime: booking.StartTime,
+			}
+			result := app.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&reminder)
+			if result.Error != nil {
+				return sent, result.Error
+			}
+			if offset == due[0] && result.RowsAffected == 1 {
+				claimed = &reminder
+			}
+		}
+		if claimed == nil {
+			continue
+		}
+
+		if err := app.sendReminder(booking); err != nil {
+			app.logger.Error("Failed to send reminder for booking " + strconv.Itoa(int(booking.ID)) + ": " + err.Error())
+			// Release the claim so the next run retries.
+			app.db.Delete(claimed)
+			continue
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+func (app *application) sendReminder(booking *models.Booking) error {
+	var computer models.Computer
+	if err := app.db.Unscoped().First(&computer, booking.ComputerID).Error; err != nil {
+		return err
+	}
+
+	zone := app.computerZone(computer.ID)
+	return app.notify(booking.Email, "booking_reminder", "Upcoming booking",
+		fmt.Sprintf("Your booking of computer #%d starts at %s.", computer.Number, booking.StartTime.In(zone).Format(time.RFC1123)),
+		fmt.Sprintf("It ends at %s. Remember to check in when you arrive.", booking.EndTime.In(zone).Format(time.RFC1123)),
+	)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+// rescheduleBooking lets the owner move a booking that has not started or
+// extend one that is in progress. The new window is checked against other
+// bookings and written in the same transaction. Times without an offset are
+// local to the computer.
+func (app *application) rescheduleBooking(c *gin.Context) {
+	var request struct {
+		StartTime *string `json:"start_time"`
+		EndTime   *string `json:"end_time"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if request.StartTime == nil && request.EndTime == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "start_time or end_time is required"})
+		return
+	}
+
+	booking, ok := app.findOwnBooking(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	zone := app.computerZone(booking.ComputerID)
+	previous := schedule.Interval{Start: booking.StartTime, End: booking.EndTime}
+	next := previous
+	if request.StartTime != nil {
+		start, err := parseTime(*request.StartTime, zone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid start_time"})
+			return
+		}
+		next.Start = start
+	}
+	if request.EndTime != nil {
+		end, err := parseTime(*request.EndTime, zone)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid end_time"})
+			return
+		}
+		next.End = end
+	}
+
+	switch booking.Status {
+	case models.BookingPending, models.BookingConfirmed:
+		if !next.Start.Equal(previous.Start) && next.Start.Before(now) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "start_time must be in the future"})
+			return
+		}
+	case models.BookingCheckedIn:
+		if !next.Start.Equal(previous.Start) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A booking in progress can only be extended"})
+			return
+		}
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": "Cannot change a " + booking.Status + " booking"})
+		return
+	}
+
+	if next.Empty() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidWindow.Error()})
+		return
+	}
+	if !next.End.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "end_time must be in the future"})
+		return
+	}
+
+	if !app.checkWindows(c, booking.ComputerID, []schedule.Interval{next}, booking) {
+		return
+	}
+
+	// The new window is priced afresh and the owner charged or refunded the
+	// difference.
+	priced := *booking
+	priced.StartTime, priced.EndTime = next.Start, next.End
+	err := app.bookingTx([]uint{booking.ComputerID}, func(tx *gorm.DB) error {
+		conflict, err := findConflict(tx, booking.ComputerID, next.Start, next.End, booking.ID)
+		if err != nil {
+			return err
+		}
+		if conflict != nil {
+			return &conflictError{booking: conflict}
+		}
+
+		if err := priceBooking(tx, &priced); err != nil {
+			return err
+		}
+
+		result := tx.Model(booking).
+			Where("status = ?", booking.Status).
+			Updates(map[string]interface{}{
+				"start_time": next.Start,
+				"end_time":   next.End,
+				"price":      priced.Price,
+				"currency":   priced.Currency,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errBookingChanged
+		}
+		return chargeBooking(tx, &priced)
+	})
+	if err != nil {
+		app.bookingErrorResponse(c, err, "Failed to update booking")
+		return
+	}
+	booking.StartTime, booking.EndTime = next.Start, next.End
+	booking.Price, booking.Currency = priced.Price, priced.Currency
+
+	var computer models.Computer
+	if err := app.db.First(&computer, booking.ComputerID).Error; err == nil {
+		if err := refreshComputerStatus(app.db, &computer); err != nil {
+			app.logger.Error("Failed to update computer status: " + err.Error())
+		}
+	}
+
+	// Whatever part of the old window is no longer used may suit someone on
+	// the waitlist.
+	for _, freed := range schedule.Free(previous, []schedule.Interval{next}) {
+		app.offerWaitlist(booking.ComputerID, freed)
+	}
+
+	if booking.Email != "" {
+		zone := app.computerZone(booking.ComputerID)
+		previous, next := previous.In(zone), next.In(zone)
+		err = app.notify(booking.Email, "booking_changed", "Booking changed",
+			fmt.Sprintf("Your booking of computer #%d was changed.", computer.Number),
+			fmt.Sprintf("It was %s to %s.", previous.Start.Format(time.RFC1123), previous.End.Format(time.RFC1123)),
+			fmt.Sprintf("It is now %s to %s.", next.Start.Format(time.RFC1123), next.End.Format(time.RFC1123)),
+		)
+		if err != nil {
+			app.logger.Error("Failed to send change notification: " + err.Error())
+		}
+	}
+
+	c.JSON(http.StatusOK, booking)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultScheduleWindow = 24 * time.Hour
+	maxScheduleWindow     = 31 * 24 * time.Hour
+)
+
+func (app *application) getComputerSchedule(c *gin.Context) {
+	var computer models.Computer
+	if err := app.db.First(&computer, c.Param("id")).Error; err != nil {
+		app.logger.Error("Computer not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Computer not found"})
+		return
+	}
+
+	zone := app.computerZone(computer.ID)
+	from, to, err := parseWindow(c, zone)
+	if err != nil {
+		app.logger.Error("Invalid time window: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time window"})
+		return
+	}
+	if c.Query("to") == "" {
+		to = from.Add(defaultScheduleWindow)
+	}
+	if to.Sub(from) > maxScheduleWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Time window is too large"})
+		return
+	}
+
+	var slot time.Duration
+	if raw := c.Query("slot"); raw != "" {
+		slot, err = time.ParseDuration(raw)
+		if err != nil || slot < time.Minute {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "slot must be a duration of at least 1m"})
+			return
+		}
+	}
+
+	window := schedule.Interval{Start: from, End: to}
+	busy, err := app.busyIntervals(computer.ID, window)
+	if err != nil {
+		app.logger.Error("Failed to retrieve bookings: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
+	}
+
+	closed, err := closedPeriods(app.db, []models.Computer{computer}, window)
+	if err != nil {
+		app.logger.Error("Failed to retrieve opening hours: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve opening hours"})
+		return
+	}
+
+	blocked, err := maintenanceIntervals(app.db, []uint{computer.ID}, window)
+	if err != nil {
+		app.logger.Error("Failed to retrieve maintenance windows: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve maintenance windows"})
+		return
+	}
+
+	// Slots follow the wall clock of the computer's location. Closed and
+	// maintenance periods are never free, so they count as busy too; they are
+	// also reported on their own.
+	shut := append([]schedule.Interval{}, closed[computer.ID]...)
+	maintenance := append([]schedule.Interval{}, blocked[computer.ID]...)
+	busy, free := schedule.Build(window.In(zone), append(append(busy, shut...), maintenance...), slot)
+	for i := range shut {
+		shut[i] = shut[i].In(zone)
+	}
+	for i := range maintenance {
+		maintenance[i] = maintenance[i].In(zone)
+	}
+	for i := range busy {
+		busy[i] = busy[i].In(zone)
+	}
+	for i := range free {
+		free[i] = free[i].In(zone)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"computer_id": computer.ID,
+		"time_zone":   zone.String(),
+		"from":        from.In(zone),
+		"to":          to.In(zone),
+		"slot":        slot.String(),
+		"busy":        busy,
+		"free":        free,
+		"closed":      shut,
+		"maintenance": maintenance,
+	})
+}
+
+// busyIntervals returns the intervals during which the computer is occupied
+// within window.
+func (app *application) busyIntervals(computerID uint, window schedule.Interval) ([]schedule.Interval, error) {
+	var bookings []models.Booking
+	if err := overlapping(activeBookings(app.db), window.Start, window.End).
+		Where("computer_id = ?", computerID).
+		Find(&bookings).Error; err != nil {
+		return nil, err
+	}
+
+	busy := make([]schedule.Interval, 0, len(bookings))
+	for _, booking := range bookings {
+		busy = append(busy, schedule.Interval{Start: booking.StartTime, End: booking.EndTime})
+	}
+	return busy, nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/recurrence"
+	"booking/internal/schedule"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// bookSeries expands rrule from the template booking and books every
+// occurrence, or none of them if any occurrence conflicts.
+func (app *application) bookSeries(c *gin.Context, computer *models.Computer, template models.Booking, rrule string, exdates []time.Time) {
+	if !template.EndTime.After(template.StartTime) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidWindow.Error()})
+		return
+	}
+
+	rule, err := recurrence.Parse(rrule)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rrule: " + err.Error()})
+		return
+	}
+
+	// Occurrences keep their wall-clock time in the computer's time zone, so a
+	// weekly 14:00 stays at 14:00 when the clocks change.
+	starts, err := rule.Expand(template.StartTime.In(app.computerZone(computer.ID)), exdates)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rrule: " + err.Error()})
+		return
+	}
+	if len(starts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Recurrence rule produces no occurrences"})
+		return
+	}
+
+	duration := template.EndTime.Sub(template.StartTime)
+	bookings := make([]models.Booking, 0, len(starts))
+	for i, start := range starts {
+		if i > 0 && start.Before(starts[i-1].Add(duration)) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Occurrences overlap each other"})
+			return
+		}
+		booking := template
+		booking.StartTime = start.UTC()
+		booking.EndTime = start.Add(duration).UTC()
+		bookings = append(bookings, booking)
+	}
+
+	windows := make([]schedule.Interval, 0, len(bookings))
+	for _, booking := range bookings {
+		windows = append(windows, schedule.Interval{Start: booking.StartTime, End: booking.EndTime})
+	}
+	if !app.checkWindows(c, computer.ID, windows, nil) {
+		return
+	}
+
+	var conflicts []gin.H
+	for _, booking := range bookings {
+		conflict, err := findConflict(app.db, booking.ComputerID, booking.StartTime, booking.EndTime, 0)
+		if err != nil {
+			app.logger.Error("Failed to check availability: " + err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check availability"})
+			return
+		}
+		if conflict != nil {
+			conflicts = append(conflicts, gin.H{
+				"occurrence": booking.StartTime,
+				"booking_id": conflict.ID,
+				"start_time": conflict.StartTime,
+				"end_time":   conflict.EndTime,
+			})
+		}
+	}
+	if len(conflicts) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "Some occurrences conflict with existing bookings",
+			"conflicts": conflicts,
+		})
+		return
+	}
+
+	series := models.BookingSeries{
+		UserID:     template.UserID,
+		ComputerID: template.ComputerID,
+		RRule:      rule.String(),
+		StartTime:  bookings[0].StartTime,
+		EndTime:    bookings[0].EndTime,
+	}
+
+	err = app.bookingTx([]uint{computer.ID}, func(tx *gorm.DB) error {
+		if err := tx.Create(&series).Error; err != nil {
+			return err
+		}
+		for i := range bookings {
+			bookings[i].SeriesID = &series.ID
+			if err := reserve(tx, &bookings[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		app.bookingErrorResponse(c, err, "Failed to create booking series")
+		return
+	}
+	series.Bookings = bookings
+
+	if err := refreshComputerStatus(app.db, computer); err != nil {
+		app.logger.Error("Failed to update computer status: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update computer status"})
+		return
+	}
+
+	err = app.sendMail(c.GetString("email"), app.localTime(computer.ID, series.StartTime)+" ("+series.RRule+")", strconv.Itoa(computer.Number))
+	if err != nil {
+		app.logger.Error("Failed to send email: " + err.Error())
+	}
+
+	ids := make([]uint, 0, len(series.Bookings))
+	for _, booking := range series.Bookings {
+		ids = append(ids, booking.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Computer booked successfully",
+		"series_id":   series.ID,
+		"booking_ids": ids,
+	})
+}
+
+// findOwnSeries loads the series from the :id parameter and checks that it
+// belongs to the caller. It writes the error response itself.
+func (app *application) findOwnSeries(c *gin.Context) (*models.BookingSeries, bool) {
+	var series models.BookingSeries
+	if err := app.db.Preload("Bookings", func(db *gorm.DB) *gorm.DB {
+		return db.Order("start_time")
+	}).First(&series, c.Param("id")).Error; err != nil {
+		app.logger.Error("Booking series not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Booking series not found"})
+		return nil, false
+	}
+
+	if series.UserID != c.GetString("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own bookings"})
+		return nil, false
+	}
+	return &series, true
+}
+
+func (app *application) getSeries(c *gin.Context) {
+	series, ok := app.findOwnSeries(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, series)
+}
+
+// cancelSeries cancels every occurrence of the series that has not ended yet
+// and can still be cancelled. Past occurrences are kept as history.
+func (app *application) cancelSeries(c *gin.Context) {
+	series, ok := app.findOwnSeries(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	actor := c.GetString("userID")
+	var cancelled []*models.Booking
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		for i := range series.Bookings {
+			booking := &series.Bookings[i]
+			if !booking.EndTime.After(now) || !booking.CanTransition(models.BookingCancelled) {
+				continue
+			}
+			if err := app.moveBooking(tx, booking, models.BookingCancelled, actor, "series cancelled by user"); err != nil {
+				return err
+			}
+			cancelled = append(cancelled, booking)
+		}
+		return nil
+	})
+	if err != nil {
+		app.logger.Error("Failed to cancel booking series: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel booking series"})
+		return
+	}
+	for _, booking := range cancelled {
+		if err := app.bookingReleased(booking); err != nil {
+			app.logger.Error("Failed to release booking " + strconv.Itoa(int(booking.ID)) + ": " + err.Error())
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Booking series cancelled successfully", "cancelled": len(cancelled)})
+}
+
+func (app *application) cancelSeriesOccurrence(c *gin.Context) {
+	series, ok := app.findOwnSeries(c)
+	if !ok {
+		return
+	}
+
+	bookingID, err := strconv.ParseUint(c.Param("booking_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid booking id"})
+		return
+	}
+
+	var occurrence *models.Booking
+	for i := range series.Bookings {
+		if series.Bookings[i].ID == uint(bookingID) {
+			occurrence = &series.Bookings[i]
+		}
+	}
+	if occurrence == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Occurrence not found in series"})
+		return
+	}
+
+	if err := app.transitionBooking(app.db, occurrence, models.BookingCancelled, c.GetString("userID"), "occurrence cancelled by user"); err != nil {
+		app.transitionResponse(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Occurrence cancelled successfully"})
+}
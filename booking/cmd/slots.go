@@ -0,0 +1,192 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"booking/internal/specs"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultSlotCandidates = 10
+	maxSlotCandidates     = 50
+	slotStep              = 5 * time.Minute
+)
+
+// slotCandidate is a computer and the earliest time it is free for the
+// requested duration.
+type slotCandidate struct {
+	ComputerID     uint      `json:"computer_id"`
+	ComputerNumber int       `json:"computer_number"`
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+	PreviousUses   int       `json:"previous_uses"`
+}
+
+// findSlots answers "any computer, this long, as early as possible". It
+// returns at most one candidate per computer, earliest first. With
+// prefer=history, ties are broken in favour of computers the caller has booked
+// before; otherwise by computer number.
+func (app *application) findSlots(c *gin.Context) {
+	duration, err := time.ParseDuration(c.Query("duration"))
+	if err != nil || duration < time.Minute {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a duration of at least 1m"})
+		return
+	}
+
+	zone, err := app.requestZone(c)
+	if err != nil {
+		app.logger.Error("Location not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Location not found"})
+		return
+	}
+
+	from, to, err := parseWindow(c, zone)
+	if err != nil {
+		app.logger.Error("Invalid time window: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid time window"})
+		return
+	}
+	if c.Query("to") == "" {
+		to = from.Add(defaultScheduleWindow)
+	}
+	if to.Sub(from) > maxScheduleWindow {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Time window is too large"})
+		return
+	}
+
+	predicates, err := specs.ParseAll(c.QueryArray("spec"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(defaultSlotCandidates)))
+	if err != nil || limit < 1 {
+		limit = defaultSlotCandidates
+	}
+	if limit > maxSlotCandidates {
+		limit = maxSlotCandidates
+	}
+
+	query := app.db.Where("status IN ?", bookableStatuses)
+	if scope := scopedComputerIDs(c, app.db); scope != nil {
+		query = query.Where("id IN (?)", scope)
+	}
+	var computers []models.Computer
+	if err := query.Order("number").Find(&computers).Error; err != nil {
+		app.logger.Error("Failed to retrieve computers: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve computers"})
+		return
+	}
+	computers = specs.Filter(computers, predicates)
+
+	ids := make([]uint, 0, len(computers))
+	for _, computer := range computers {
+		ids = append(ids, computer.ID)
+	}
+
+	window := schedule.Interval{Start: from, End: to}
+	var bookings []models.Booking
+	if err := overlapping(activeBookings(app.db), from, to).
+		Where("computer_id IN ?", ids).
+		Find(&bookings).Error; err != nil {
+		app.logger.Error("Failed to retrieve bookings: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve bookings"})
+		return
+	}
+	busy := make(map[uint][]schedule.Interval, len(computers))
+	for _, booking := range bookings {
+		busy[booking.ComputerID] = append(busy[booking.ComputerID], schedule.Interval{Start: booking.StartTime, End: booking.EndTime})
+	}
+
+	closed, err := closedPeriods(app.db, computers, window)
+	if err != nil {
+		app.logger.Error("Failed to retrieve opening hours: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve opening hours"})
+		return
+	}
+	for computerID, intervals := range closed {
+		busy[computerID] = append(busy[computerID], intervals...)
+	}
+	blocked, err := maintenanceIntervals(app.db, ids, window)
+	if err != nil {
+		app.logger.Error("Failed to retrieve maintenance windows: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve maintenance windows"})
+		return
+	}
+	for computerID, intervals := range blocked {
+		busy[computerID] = append(busy[computerID], intervals...)
+	}
+
+	uses, err := app.previousUses(c.GetString("userID"))
+	if err != nil {
+		app.logger.Error("Failed to retrieve booking history: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve booking history"})
+		return
+	}
+
+	candidates := make([]slotCandidate, 0, len(computers))
+	for _, computer := range computers {
+		fit, ok := schedule.EarliestFit(window.In(zone), busy[computer.ID], duration, slotStep)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, slotCandidate{
+			ComputerID:     computer.ID,
+			ComputerNumber: computer.Number,
+			StartTime:      fit.Start.In(zone),
+			EndTime:        fit.End.In(zone),
+			PreviousUses:   uses[computer.ID],
+		})
+	}
+
+	preferHistory := c.Query("prefer") == "history"
+	sort.SliceStable(candidates, func(a, b int) bool {
+		if !candidates[a].StartTime.Equal(candidates[b].StartTime) {
+			return candidates[a].StartTime.Before(candidates[b].StartTime)
+		}
+		if preferHistory && candidates[a].PreviousUses != candidates[b].PreviousUses {
+			return candidates[a].PreviousUses > candidates[b].PreviousUses
+		}
+		return candidates[a].ComputerNumber < candidates[b].ComputerNumber
+	})
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"duration":   duration.String(),
+		"time_zone":  zone.String(),
+		"from":       from.In(zone),
+		"to":         to.In(zone),
+		"candidates": candidates,
+	})
+}
+
+// previousUses counts the user's past bookings per computer, leaving out
+// bookings that were cancelled.
+func (app *application) previousUses(userID string) (map[uint]int, error) {
+	var rows []struct {
+		ComputerID uint
+		Uses       int
+	}
+	err := app.db.Model(&models.Booking{}).
+		Select("computer_id, COUNT(*) AS uses").
+		Where("user_id = ? AND status <> ?", userID, models.BookingCancelled).
+		Group("computer_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	uses := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		uses[row.ComputerID] = row.Uses
+	}
+	return uses, nil
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"booking/internal/models"
+	"booking/internal/schedule"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"net/http"
+	"time"
+)
+
+func (app *application) joinWaitlist(c *gin.Context) {
+	var request struct {
+		ComputerID *uint  `json:"computer_id"`
+		StartTime  string `json:"start_time"`
+		EndTime    string `json:"end_time"`
+	}
+
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	var computerID uint
+	if request.ComputerID != nil {
+		computerID = *request.ComputerID
+	}
+	window, ok := parseRequestWindow(c, request.StartTime, request.EndTime, app.computerZone(computerID))
+	if !ok {
+		return
+	}
+	if !app.checkWindows(c, computerID, []schedule.Interval{window}, nil) {
+		return
+	}
+
+	var free bool
+	if request.ComputerID != nil {
+		var computer models.Computer
+		if err := app.db.First(&computer, *request.ComputerID).Error; err != nil {
+			app.logger.Error("Computer not found: " + err.Error())
+			c.JSON(http.StatusNotFound, gin.H{"error": "Computer not found"})
+			return
+		}
+
+		conflict, err := findConflict(app.db, computer.ID, window.Start, window.End, 0)
+		if err != nil {
+			app.logger.Error("Failed to check availability: " + err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check availability"})
+			return
+		}
+		free = conflict == nil && isBookable(&computer)
+	} else {
+		computers, err := availableComputers(app.db, nil, window.Start, window.End)
+		if err != nil {
+			app.logger.Error("Failed to check availability: " + err.Error())
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check availability"})
+			return
+		}
+		free = len(computers) > 0
+	}
+	if free {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The requested time is available, book it directly"})
+		return
+	}
+
+	entry := models.WaitlistEntry{
+		UserID:     c.GetString("userID"),
+		Email:      c.GetString("email"),
+		ComputerID: request.ComputerID,
+		StartTime:  window.Start,
+		EndTime:    window.End,
+		Status:     models.WaitlistWaiting,
+	}
+
+	if err := app.db.Create(&entry).Error; err != nil {
+		app.logger.Error("Failed to join waitlist: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to join waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+func (app *application) getWaitlist(c *gin.Context) {
+	var entries []models.WaitlistEntry
+	if err := app.db.Where("user_id = ?", c.GetString("userID")).Order("created_at").Find(&entries).Error; err != nil {
+		app.logger.Error("Failed to retrieve waitlist: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve waitlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+// findOwnWaitlistEntry loads the entry from the :id parameter and checks that
+// it belongs to the caller. It writes the error response itself.
+func (app *application) findOwnWaitlistEntry(c *gin.Context) (*models.WaitlistEntry, bool) {
+	var entry models.WaitlistEntry
+	if err := app.db.First(&entry, c.Param("id")).Error; err != nil {
+		app.logger.Error("Waitlist entry not found: " + err.Error())
+		c.JSON(http.StatusNotFound, gin.H{"error": "Waitlist entry not found"})
+		return nil, false
+	}
+
+	if entry.UserID != c.GetString("userID") {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only manage your own waitlist entries"})
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (app *application) leaveWaitlist(c *gin.Context) {
+	entry, ok := app.findOwnWaitlistEntry(c)
+	if !ok {
+		return
+	}
+
+	if entry.Status != models.WaitlistWaiting && entry.Status != models.WaitlistOffered {
+		c.JSON(http.StatusConflict, gin.H{"error": "Waitlist entry is already " + entry.Status})
+		return
+	}
+
+	offered := entry.Status == models.WaitlistOffered
+	if err := app.db.Model(entry).Update("status", models.WaitlistCancelled).Error; err != nil {
+		app.logger.Error("Failed to leave waitlist: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to leave waitlist"})
+		return
+	}
+
+	if offered {
+		app.passOfferOn(entry)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Left waitlist successfully"})
+}
+
+func (app *application) claimWaitlistOffer(c *gin.Context) {
+	entry, ok := app.findOwnWaitlistEntry(c)
+	if !ok {
+		return
+	}
+
+	if entry.Status != models.WaitlistOffered || entry.OfferedBookingID == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Waitlist entry has no open offer"})
+		return
+	}
+
+	if entry.OfferExpiresAt != nil && time.Now().After(*entry.OfferExpiresAt) {
+		if err := app.db.Model(entry).Update("status", models.WaitlistExpired).Error; err != nil {
+			app.logger.Error("Failed to expire waitlist offer: " + err.Error())
+		}
+		app.passOfferOn(entry)
+		c.JSON(http.StatusGone, gin.H{"error": "Waitlist offer has expired"})
+		return
+	}
+
+	var hold models.Booking
+	if err := app.db.First(&hold, *entry.OfferedBookingID).Error; err != nil {
+		app.logger.Error("Waitlist offer hold not found: " + err.Error())
+		c.JSON(http.StatusGone, gin.H{"error": "Waitlist offer has expired"})
+		return
+	}
+
+	// The offer's hold becomes the booking and is paid for now. A waiter who
+	// cannot pay keeps the offer until it expires, and may top up meanwhile.
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		if err := app.moveBooking(tx, &hold, models.BookingConfirmed, entry.UserID, "waitlist offer claimed"); err != nil {
+			return err
+		}
+		if err := tx.Model(&hold).Update("hold_expires_at", nil).Error; err != nil {
+			return err
+		}
+		if err := chargeBooking(tx, &hold); err != nil {
+			return err
+		}
+		return tx.Model(entry).Update("status", models.WaitlistClaimed).Error
+	})
+	var invalid *transitionError
+	var funds *fundsError
+	switch {
+	case errors.As(err, &invalid):
+		// The hold lapsed before the offer was swept up.
+		c.JSON(http.StatusGone, gin.H{"error": "Waitlist offer has expired"})
+		return
+	case errors.As(err, &funds):
+		fundsResponse(c, http.StatusPaymentRequired, funds)
+		return
+	}
+	if err != nil {
+		app.logger.Error("Failed to claim waitlist offer: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to claim waitlist offer"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Computer booked successfully", "booking_id": hold.ID})
+}
+
+// errNotOffered skips a waitlist entry that cannot be offered a window.
+var errNotOffered = errors.New("waitlist entry cannot be offered the window")
+
+// offerWaitlist offers a freed window on the computer to the longest-waiting
+// eligible entry: one that asked for this computer or any computer, whose
+// window overlaps the freed one and is now entirely free. The offer reserves
+// the entry's window with a hold until the offer expires, so no one else can
+// be offered or book it meanwhile. The hold is priced but not charged until
+// the waiter claims it. It must not run inside a transaction, as it notifies
+// the waiter once the offer is committed.
+func (app *application) offerWaitlist(computerID uint, freed schedule.Interval) {
+	var entries []models.WaitlistEntry
+	if err := app.db.Where("status = ?", models.WaitlistWaiting).
+		Where("computer_id IS NULL OR computer_id = ?", computerID).
+		Where("start_time < ? AND end_time > ?", freed.End, freed.Start).
+		Order("created_at, id").
+		Find(&entries).Error; err != nil {
+		app.logger.Error("Failed to retrieve waitlist: " + err.Error())
+		return
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		window := schedule.Interval{Start: entry.StartTime, End: entry.EndTime}
+		expiresAt := time.Now().Add(app.config.WaitlistClaimTTL)
+		hold := models.Booking{
+			UserID:        entry.UserID,
+			Email:         entry.Email,
+			ComputerID:    computerID,
+			StartTime:     entry.StartTime,
+			EndTime:       entry.EndTime,
+			Status:        models.BookingPending,
+			HoldExpiresAt: &expiresAt,
+		}
+
+		err := app.bookingTx([]uint{computerID}, func(tx *gorm.DB) error {
+			blocked, err := isBlocked(tx, computerID, window)
+			if err != nil {
+				return err
+			}
+			if blocked {
+				return errNotOffered
+			}
+			conflict, err := findConflict(tx, computerID, hold.StartTime, hold.EndTime, 0)
+			if err != nil {
+				return err
+			}
+			if conflict != nil {
+				return &conflictError{booking: conflict}
+			}
+			if err := priceBooking(tx, &hold); err != nil {
+				return err
+			}
+			if err := tx.Create(&hold).Error; err != nil {
+				return err
+			}
+
+			result := tx.Model(entry).
+				Where("status = ?", models.WaitlistWaiting).
+				Updates(map[string]interface{}{
+					"status":              models.WaitlistOffered,
+					"offered_computer_id": computerID,
+					"offered_booking_id":  hold.ID,
+					"offer_expires_at":    expiresAt,
+				})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				// The waiter left or was offered another window meanwhile.
+				return errNotOffered
+			}
+			return nil
+		})
+		var conflict *conflictError
+		if errors.Is(err, errNotOffered) || errors.As(err, &conflict) {
+			continue
+		}
+		if err != nil {
+			app.logger.Error("Failed to offer waitlist slot: " + err.Error())
+			return
+		}
+
+		var computer models.Computer
+		if err := app.db.First(&computer, computerID).Error; err == nil {
+			if err := refreshComputerStatus(app.db, &computer); err != nil {
+				app.logger.Error("Failed to update computer status: " + err.Error())
+			}
+		}
+
+		zone := app.computerZone(computerID)
+		err = app.notify(entry.Email, "waitlist_offer", "A computer is available",
+			fmt.Sprintf("A computer you were waiting for is free from %s to %s.", entry.StartTime.In(zone).Format(time.RFC1123), entry.EndTime.In(zone).Format(time.RFC1123)),
+			fmt.Sprintf("Claim waitlist entry %d before %s to book it.", entry.ID, expiresAt.In(zone).Format(time.RFC1123)),
+		)
+		if err != nil {
+			app.logger.Error("Failed to send waitlist offer: " + err.Error())
+		}
+		return
+	}
+}
+
+// passOfferOn releases the hold of an entry whose offer lapsed or was
+// declined, which hands its window to the next waiter.
+func (app *application) passOfferOn(entry *models.WaitlistEntry) {
+	if entry.OfferedBookingID == nil {
+		return
+	}
+
+	var hold models.Booking
+	if err := app.db.First(&hold, *entry.OfferedBookingID).Error; err != nil {
+		app.logger.Error("Waitlist offer hold not found: " + err.Error())
+		return
+	}
+	if hold.Status != models.BookingPending {
+		// Claimed, or already released when it expired.
+		return
+	}
+	if err := app.transitionBooking(app.db, &hold, models.BookingCancelled, systemActor, "waitlist offer lapsed"); err != nil {
+		app.logger.Error("Failed to release waitlist offer hold: " + err.Error())
+	}
+}
+
+// expireWaitlistOffers marks unclaimed offers past their deadline as expired
+// and passes each window on to the next waiter.
+func (app *application) expireWaitlistOffers(now time.Time) error {
+	var entries []models.WaitlistEntry
+	if err := app.db.Where("status = ? AND offer_expires_at < ?", models.WaitlistOffered, now).
+		Find(&entries).Error; err != nil {
+		return err
+	}
+
+	for i := range entries {
+		if err := app.db.Model(&entries[i]).Update("status", models.WaitlistExpired).Error; err != nil {
+			return err
+		}
+		app.passOfferOn(&entries[i])
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"booking/internal/models"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// fundsError is returned when a wallet cannot cover a charge.
+type fundsError struct {
+	currency        string
+	balance, amount int64
+}
+
+func (e *fundsError) Error() string {
+	return fmt.Sprintf("balance of %d %s does not cover %d", e.balance, e.currency, e.amount)
+}
+
+// fundsResponse writes the response for a charge the wallet cannot cover.
+func fundsResponse(c *gin.Context, code int, funds *fundsError) {
+	c.JSON(code, gin.H{
+		"error":    "Insufficient wallet balance",
+		"currency": funds.currency,
+		"balance":  funds.balance,
+		"amount":   funds.amount,
+	})
+}
+
+// postEntry appends the entry to the user's wallet in currency, opening the
+// wallet on first use, and moves the balance by the entry's amount. It fails
+// with a fundsError rather than take the balance below zero. It must run
+// inside a transaction.
+func postEntry(tx *gorm.DB, userID, currency string, entry *models.LedgerEntry) error {
+	wallet := models.Wallet{UserID: userID, Currency: currency}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&wallet).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("user_id = ? AND currency = ?", userID, currency).First(&wallet).Error; err != nil {
+		return err
+	}
+
+	result := tx.Model(&models.Wallet{}).
+		Where("id = ? AND balance + ? >= 0", wallet.ID, entry.Amount).
+		Update("balance", gorm.Expr("balance + ?", entry.Amount))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &fundsError{currency: currency, balance: wallet.Balance, amount: -entry.Amount}
+	}
+
+	if err := tx.First(&wallet, wallet.ID).Error; err != nil {
+		return err
+	}
+	entry.WalletID = wallet.ID
+	entry.Balance = wallet.Balance
+	return tx.Create(entry).Error
+}
+
+// bookingPaid returns what the booking's owner has paid for it so far, net of
+// refunds, by currency.
+func bookingPaid(tx *gorm.DB, bookingID uint) (map[string]int64, error) {
+	var rows []struct {
+		Currency string
+		Paid     int64
+	}
+	if err := tx.Model(&models.LedgerEntry{}).
+		Select("wallets.currency AS currency, -SUM(ledger_entries.amount) AS paid").
+		Joins("JOIN wallets ON wallets.id = ledger_entries.wallet_id").
+		Where("ledger_entries.booking_id = ? AND ledger_entries.kind IN ?", bookingID, []string{models.LedgerCharge, models.LedgerRefund}).
+		Group("wallets.currency").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	paid := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		paid[row.Currency] = row.Paid
+	}
+	return paid, nil
+}
+
+// sortedCurrencies returns the keys of amounts in a stable order.
+func sortedCurrencies(amounts map[string]int64) []string {
+	currencies := make([]string, 0, len(amounts))
+	for currency := range amounts {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	return currencies
+}
+
+// chargeBooking brings what the booking's owner has paid in line with the
+// booking's price, charging or refunding the difference. Bookings without an
+// owner are not charged. It must run inside the transaction that prices the
+// booking.
+func chargeBooking(tx *gorm.DB, booking *models.Booking) error {
+	if booking.UserID == "" {
+		return nil
+	}
+	paid, err := bookingPaid(tx, booking.ID)
+	if err != nil {
+		return err
+	}
+
+	owed := make(map[string]int64, len(paid)+1)
+	for currency := range paid {
+		owed[currency] = 0
+	}
+	if booking.Price > 0 {
+		owed[booking.Currency] = booking.Price
+	}
+
+	for _, currency := range sortedCurrencies(owed) {
+		difference := owed[currency] - paid[currency]
+		if difference == 0 {
+			continue
+		}
+		kind := models.LedgerCharge
+		if difference < 0 {
+			kind = models.LedgerRefund
+		}
+		err := postEntry(tx, booking.UserID, currency, &models.LedgerEntry{
+			Kind:      kind,
+			Amount:    -difference,
+			BookingID: &booking.ID,
+			ActorID:   systemActor,
+			Note:      fmt.Sprintf("Booking #%d", booking.ID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// refundBooking pays the owner back when the booking moves from one status
+// to another. Only cancellations are refunded. Owners cancelling their own
+// confirmed booking get what the refund policy allows for the notice given;
+// holds and cancellations by staff or the service are refunded in full.
+func (app *application) refundBooking(tx *gorm.DB, booking *models.Booking, from, to, actor string) error {
+	if to != models.BookingCancelled || booking.UserID == "" {
+		return nil
+	}
+	paid, err := bookingPaid(tx, booking.ID)
+	if err != nil {
+		return err
+	}
+
+	byOwner := from == models.BookingConfirmed && actor == booking.UserID
+	for _, currency := range sortedCurrencies(paid) {
+		refund := paid[currency]
+		if byOwner {
+			refund = app.config.Refunds.Refund(refund, time.Until(booking.StartTime))
+		}
+		if refund <= 0 {
+			continue
+		}
+		err := postEntry(tx, booking.UserID, currency, &models.LedgerEntry{
+			Kind:      models.LedgerRefund,
+			Amount:    refund,
+			BookingID: &booking.ID,
+			ActorID:   systemActor,
+			Note:      fmt.Sprintf("Booking #%d cancelled", booking.ID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// statementLine is a ledger entry with the currency of its wallet.
+type statementLine struct {
+	models.LedgerEntry
+	Currency string
+}
+
+// writeWallets responds with the user's balance in every currency they have
+// a wallet in.
+func (app *application) writeWallets(c *gin.Context, userID string) {
+	var wallets []models.Wallet
+	if err := app.db.Where("user_id = ?", userID).Order("currency").Find(&wallets).Error; err != nil {
+		app.logger.Error("Failed to retrieve wallets: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve wallets"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "wallets": wallets})
+}
+
+// writeStatement responds with the user's ledger entries, newest first,
+// narrowed by the optional currency, from and to query parameters.
+func (app *application) writeStatement(c *gin.Context, userID string) {
+	query := app.db.Model(&models.LedgerEntry{}).
+		Select("ledger_entries.*, wallets.currency AS currency").
+		Joins("JOIN wallets ON wallets.id = ledger_entries.wallet_id").
+		Where("wallets.user_id = ?", userID)
+	if currency := c.Query("currency"); currency != "" {
+		query = query.Where("wallets.currency = ?", strings.ToUpper(currency))
+	}
+	for _, bound := range []struct {
+		param, condition string
+	}{
+		{"from", "ledger_entries.created_at >= ?"},
+		{"to", "ledger_entries.created_at < ?"},
+	} {
+		raw := c.Query(bound.param)
+		if raw == "" {
+			continue
+		}
+		value, err := parseTime(raw, time.UTC)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.param})
+			return
+		}
+		query = query.Where(bound.condition, value)
+	}
+
+	var lines []statementLine
+	if err := query.Order("ledger_entries.created_at DESC, ledger_entries.id DESC").Scan(&lines).Error; err != nil {
+		app.logger.Error("Failed to retrieve statement: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve statement"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"user_id": userID, "entries": lines})
+}
+
+func (app *application) getMyWallet(c *gin.Context) {
+	app.writeWallets(c, c.GetString("userID"))
+}
+
+func (app *application) getMyStatement(c *gin.Context) {
+	app.writeStatement(c, c.GetString("userID"))
+}
+
+func (app *application) getWallet(c *gin.Context) {
+	app.writeWallets(c, c.Param("user_id"))
+}
+
+func (app *application) getStatement(c *gin.Context) {
+	app.writeStatement(c, c.Param("user_id"))
+}
+
+// createWalletEntry lets admins top up a user's wallet, for example after a
+// payment at the front desk, or correct its balance with an adjustment.
+func (app *application) createWalletEntry(c *gin.Context) {
+	var request struct {
+		Kind     string `json:"kind"`
+		Currency string `json:"currency"`
+		Amount   int64  `json:"amount"`
+		Note     string `json:"note"`
+	}
+	if err := c.BindJSON(&request); err != nil {
+		app.logger.Error("Invalid request format: " + err.Error())
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	switch {
+	case request.Kind != models.LedgerTopUp && request.Kind != models.LedgerAdjustment:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "kind must be top_up or adjustment"})
+		return
+	case len(request.Currency) != 3:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "currency must be a three letter code"})
+		return
+	case request.Kind == models.LedgerTopUp && request.Amount <= 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "top-ups must be positive"})
+		return
+	case request.Amount == 0:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must not be zero"})
+		return
+	case request.Kind == models.LedgerAdjustment && request.Note == "":
+		c.JSON(http.StatusBadRequest, gin.H{"error": "adjustments need a note"})
+		return
+	}
+
+	entry := models.LedgerEntry{
+		Kind:    request.Kind,
+		Amount:  request.Amount,
+		ActorID: c.GetString("userID"),
+		Note:    request.Note,
+	}
+	err := app.db.Transaction(func(tx *gorm.DB) error {
+		return postEntry(tx, c.Param("user_id"), strings.ToUpper(request.Currency), &entry)
+	})
+	var funds *fundsError
+	if errors.As(err, &funds) {
+		fundsResponse(c, http.StatusConflict, funds)
+		return
+	}
+	if err != nil {
+		app.logger.Error("Failed to post wallet entry: " + err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to post wallet entry"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"booking/internal/policy"
+	"booking/internal/pricing"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type Config struct {
@@ -18,6 +23,36 @@ type Config struct {
 	Seeder      string
 	RabbitUrl   string
 	PostgresURL string
+
+	WaitlistClaimTTL    time.Duration
+	CheckInEarly        time.Duration
+	NoShowGracePeriod   time.Duration
+	NoShowCheckInterval time.Duration
+	FinalizeInterval    time.Duration
+	JobJitter           time.Duration
+	ReminderOffsets     []time.Duration
+	ReminderInterval    time.Duration
+	IdempotencyTTL      time.Duration
+	HoldTTL             time.Duration
+
+	// HighSeverityMaintenance puts a computer into maintenance when a high
+	// severity issue is reported by someone checked in at it, or when an admin
+	// acknowledges one.
+	HighSeverityMaintenance bool
+
+	Policy  policy.Config
+	Refunds pricing.RefundPolicy
+
+	// PaymentProvider names the gateway that takes top-up payments; when it is
+	// empty, payments are disabled. Only "fake" is built in, and it is refused
+	// outside debug mode. Webhooks from it are signed with
+	// PaymentWebhookSecret, which must be set with it.
+	PaymentProvider          string
+	PaymentWebhookSecret     string
+	PaymentWebhookURL        string
+	PaymentFakeDelay         time.Duration
+	PaymentReconcileAfter    time.Duration
+	PaymentReconcileInterval time.Duration
 }
 
 func LoadConfig() *Config {
@@ -38,5 +73,119 @@ func LoadConfig() *Config {
 		Seeder:      os.Getenv("SEEDER"),
 		RabbitUrl:   os.Getenv("RABBIT_URL"),
 		PostgresURL: os.Getenv("POSTGRES_URL"),
+
+		WaitlistClaimTTL:    getDuration("WAITLIST_CLAIM_TTL", 15*time.Minute),
+		CheckInEarly:        getDuration("CHECK_IN_EARLY", 15*time.Minute),
+		NoShowGracePeriod:   getDuration("NO_SHOW_GRACE_PERIOD", 15*time.Minute),
+		NoShowCheckInterval: getDuration("NO_SHOW_CHECK_INTERVAL", time.Minute),
+		FinalizeInterval:    getDuration("FINALIZE_INTERVAL", time.Minute),
+		JobJitter:           getDuration("JOB_JITTER", 5*time.Second),
+		ReminderOffsets:     getDurations("REMINDER_OFFSETS", []time.Duration{24 * time.Hour, 15 * time.Minute}),
+		ReminderInterval:    getDuration("REMINDER_CHECK_INTERVAL", time.Minute),
+		IdempotencyTTL:      getDuration("IDEMPOTENCY_TTL", 24*time.Hour),
+		HoldTTL:             getDuration("HOLD_TTL", 10*time.Minute),
+
+		HighSeverityMaintenance: getBool("HIGH_SEVERITY_MAINTENANCE", false),
+
+		Policy: getPolicy("POLICY_FILE"),
+		Refunds: pricing.RefundPolicy{
+			FullNotice:  getDuration("REFUND_FULL_NOTICE", 24*time.Hour),
+			LatePercent: getPercent("REFUND_LATE_PERCENT", 50),
+		},
+
+		PaymentProvider:          os.Getenv("PAYMENT_PROVIDER"),
+		PaymentWebhookSecret:     os.Getenv("PAYMENT_WEBHOOK_SECRET"),
+		PaymentWebhookURL:        os.Getenv("PAYMENT_WEBHOOK_URL"),
+		PaymentFakeDelay:         getDuration("PAYMENT_FAKE_DELAY", 30*time.Second),
+		PaymentReconcileAfter:    getDuration("PAYMENT_RECONCILE_AFTER", 10*time.Minute),
+		PaymentReconcileInterval: getDuration("PAYMENT_RECONCILE_INTERVAL", 5*time.Minute),
+	}
+}
+
+// getPolicy loads the booking policy from the JSON file named by key, or
+// returns the default policy when the variable is unset.
+func getPolicy(key string) policy.Config {
+	path := os.Getenv(key)
+	if path == "" {
+		return policy.Default()
+	}
+
+	config, err := policy.Load(path)
+	if err != nil {
+		log.Fatalf("Invalid booking policy in %s: %v", key, err)
+	}
+	return config
+}
+
+// getDuration reads a Go duration such as "15m" from the environment, falling
+// back to def when the variable is unset.
+func getDuration(key string, def time.Duration) time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		log.Fatalf("Invalid duration in %s: %v", key, err)
+	}
+	return value
+}
+
+// getBool reads a boolean such as "true" or "0" from the environment, falling
+// back to def when the variable is unset.
+func getBool(key string, def bool) bool {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		log.Fatalf("Invalid boolean in %s: %v", key, err)
+	}
+	return value
+}
+
+// getInt reads an integer from the environment, falling back to def when the
+// variable is unset.
+func getInt(key string, def int) int {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil {
+		log.Fatalf("Invalid integer in %s: %v", key, err)
+	}
+	return value
+}
+
+// getPercent reads a percentage between 0 and 100 from the environment,
+// falling back to def when the variable is unset.
+func getPercent(key string, def int) int {
+	value := getInt(key, def)
+	if value < 0 || value > 100 {
+		log.Fatalf("Invalid percentage in %s: %d is not between 0 and 100", key, value)
+	}
+	return value
+}
+
+// getDurations reads a comma-separated list of durations such as "24h,15m".
+func getDurations(key string, def []time.Duration) []time.Duration {
+	raw := os.Getenv(key)
+	if raw == "" {
+		return def
+	}
+
+	var values []time.Duration
+	for _, part := range strings.Split(raw, ",") {
+		value, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil {
+			log.Fatalf("Invalid duration in %s: %v", key, err)
+		}
+		values = append(values, value)
 	}
+	return values
 }
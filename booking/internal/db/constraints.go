@@ -0,0 +1,117 @@
+package db
+
+import (
+	"booking/internal/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+)
+
+// overlapConstraint names the database guard that rejects overlapping active
+// bookings on the same computer.
+const overlapConstraint = "bookings_no_overlap"
+
+// EnsureBookingConstraints installs the database-level guard against
+// overlapping bookings, so that concurrent requests cannot both book the same
+// window even if they pass the application's own check. Postgres gets an
+// exclusion constraint over tstzrange; SQLite, which has no such constraint,
+// gets equivalent triggers.
+//
+// Bookings made before the guard existed may already overlap. The guard is not
+// installed over them; instead it fails naming the conflicting bookings, which
+// an admin has to cancel or move first.
+func EnsureBookingConstraints(db *gorm.DB) error {
+	quoted := make([]string, 0, len(models.ActiveBookingStatuses))
+	for _, status := range models.ActiveBookingStatuses {
+		quoted = append(quoted, "'"+status+"'")
+	}
+	active := strings.Join(quoted, ", ")
+
+	overlaps, err := findOverlaps(db)
+	if err != nil {
+		return err
+	}
+	if len(overlaps) > 0 {
+		return fmt.Errorf("active bookings overlap, cancel or move one of each pair first: %s", strings.Join(overlaps, ", "))
+	}
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		return db.Exec(fmt.Sprintf(`
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+DO $$
+BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = '%[1]s') THEN
+		ALTER TABLE bookings ADD CONSTRAINT %[1]s EXCLUDE USING gist (
+			computer_id WITH =,
+			tstzrange(start_time, end_time, '[)') WITH &&
+		) WHERE (deleted_at IS NULL AND status IN (%[2]s));
+	END IF;
+END $$;`, overlapConstraint, active)).Error
+	case "sqlite":
+		overlaps := fmt.Sprintf(`NEW.deleted_at IS NULL AND NEW.status IN (%s) AND EXISTS (
+	SELECT 1 FROM bookings
+	WHERE computer_id = NEW.computer_id AND id IS NOT NEW.id
+		AND deleted_at IS NULL AND status IN (%s)
+		AND start_time < NEW.end_time AND end_time > NEW.start_time
+)`, active, active)
+
+		for _, trigger := range []string{
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_insert BEFORE INSERT ON bookings
+WHEN %[2]s
+BEGIN SELECT RAISE(ABORT, '%[1]s'); END;`, overlapConstraint, overlaps),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_update BEFORE UPDATE ON bookings
+WHEN %[2]s
+BEGIN SELECT RAISE(ABORT, '%[1]s'); END;`, overlapConstraint, overlaps),
+		} {
+			if err := db.Exec(trigger).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("no booking constraints for dialect %s", db.Dialector.Name())
+	}
+}
+
+// findOverlaps describes each pair of active bookings on the same computer
+// whose windows overlap, as "#<earlier id> and #<later id> on computer <id>".
+func findOverlaps(db *gorm.DB) ([]string, error) {
+	var pairs []struct {
+		ComputerID uint
+		FirstID    uint
+		SecondID   uint
+	}
+	err := db.Table("bookings AS a").
+		Select("a.computer_id, a.id AS first_id, b.id AS second_id").
+		Joins("JOIN bookings AS b ON b.computer_id = a.computer_id AND b.id > a.id").
+		Where("a.deleted_at IS NULL AND a.status IN ?", models.ActiveBookingStatuses).
+		Where("b.deleted_at IS NULL AND b.status IN ?", models.ActiveBookingStatuses).
+		Where("a.start_time < b.end_time AND a.end_time > b.start_time").
+		Order("a.id, b.id").
+		Scan(&pairs).Error
+	if err != nil {
+		return nil, err
+	}
+
+	overlaps := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		overlaps = append(overlaps, fmt.Sprintf("#%d and #%d on computer %d", pair.FirstID, pair.SecondID, pair.ComputerID))
+	}
+	return overlaps, nil
+}
+
+// IsOverlapError reports whether err was raised by the overlap guard.
+func IsOverlapError(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// pgconn.PgError; 23P01 is exclusion_violation.
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) && pgErr.SQLState() == "23P01" {
+		return true
+	}
+	return strings.Contains(err.Error(), overlapConstraint)
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"booking/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"testing"
+	"time"
+)
+
+func TestEnsureBookingConstraints(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.Computer{}, &models.Booking{}))
+
+	start := time.Date(2030, 6, 1, 10, 0, 0, 0, time.UTC)
+	legacy := []models.Booking{
+		{UserID: "user1", ComputerID: 1, StartTime: start, EndTime: start.Add(2 * time.Hour), Status: models.BookingConfirmed},
+		{UserID: "user2", ComputerID: 1, StartTime: start.Add(time.Hour), EndTime: start.Add(3 * time.Hour), Status: models.BookingConfirmed},
+		{UserID: "user3", ComputerID: 1, StartTime: start.Add(3 * time.Hour), EndTime: start.Add(4 * time.Hour), Status: models.BookingConfirmed},
+		{UserID: "user4", ComputerID: 2, StartTime: start, EndTime: start.Add(time.Hour), Status: models.BookingConfirmed},
+		{UserID: "user5", ComputerID: 2, StartTime: start, EndTime: start.Add(time.Hour), Status: models.BookingCancelled},
+	}
+	assert.NoError(t, db.Create(&legacy).Error)
+
+	err = EnsureBookingConstraints(db)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "#1 and #2 on computer 1")
+	assert.NotContains(t, err.Error(), "computer 2")
+
+	assert.NoError(t, db.Model(&legacy[1]).Update("status", models.BookingCancelled).Error)
+	assert.NoError(t, EnsureBookingConstraints(db))
+
+	overlap := models.Booking{UserID: "user6", ComputerID: 1, StartTime: start, EndTime: start.Add(time.Hour), Status: models.BookingConfirmed}
+	assert.True(t, IsOverlapError(db.Create(&overlap).Error))
+}
@@ -0,0 +1,109 @@
+// Package floorplan validates room seat layouts and works out which seats are
+// next to each other. Seats are next to each other only when they are side by
+// side in the same row; seats in front or behind do not count, as a group
+// seated that way could not share a desk.
+package floorplan
+
+import (
+	"booking/internal/models"
+	"fmt"
+	"sort"
+)
+
+var orientations = map[string]bool{
+	models.OrientationNorth: true,
+	models.OrientationEast:  true,
+	models.OrientationSouth: true,
+	models.OrientationWest:  true,
+}
+
+// Validate checks that every seat lies inside a rows×columns grid, has a known
+// orientation, and that no cell or computer is used twice.
+func Validate(rows, columns int, seats []models.Seat) error {
+	if rows < 1 || columns < 1 {
+		return fmt.Errorf("floor plan needs at least one row and one column")
+	}
+
+	cells := make(map[[2]int]bool, len(seats))
+	computers := make(map[uint]bool, len(seats))
+	for _, seat := range seats {
+		if seat.Row < 0 || seat.Row >= rows || seat.Column < 0 || seat.Column >= columns {
+			return fmt.Errorf("seat for computer %d is outside the %dx%d grid", seat.ComputerID, rows, columns)
+		}
+		if seat.Orientation != "" && !orientations[seat.Orientation] {
+			return fmt.Errorf("unknown orientation %q", seat.Orientation)
+		}
+
+		cell := [2]int{seat.Row, seat.Column}
+		if cells[cell] {
+			return fmt.Errorf("more than one seat at row %d, column %d", seat.Row, seat.Column)
+		}
+		cells[cell] = true
+
+		if computers[seat.ComputerID] {
+			return fmt.Errorf("computer %d is placed more than once", seat.ComputerID)
+		}
+		computers[seat.ComputerID] = true
+	}
+	return nil
+}
+
+// Neighbours maps each computer to the computers seated directly beside it,
+// that is in the same row and an adjacent column, in column order.
+func Neighbours(seats []models.Seat) map[uint][]uint {
+	byCell := make(map[[2]int]uint, len(seats))
+	for _, seat := range seats {
+		byCell[[2]int{seat.Row, seat.Column}] = seat.ComputerID
+	}
+
+	neighbours := make(map[uint][]uint, len(seats))
+	for _, seat := range seats {
+		list := []uint{}
+		for _, column := range []int{seat.Column - 1, seat.Column + 1} {
+			if id, ok := byCell[[2]int{seat.Row, column}]; ok {
+				list = append(list, id)
+			}
+		}
+		neighbours[seat.ComputerID] = list
+	}
+	return neighbours
+}
+
+// FindAdjacent returns the first run of size free computers seated side by
+// side in one row, scanning rows top to bottom and left to right. It returns
+// nil when there is none.
+func FindAdjacent(seats []models.Seat, free map[uint]bool, size int) []uint {
+	if size < 1 {
+		return nil
+	}
+
+	sorted := append([]models.Seat(nil), seats...)
+	Sort(sorted)
+
+	var run []uint
+	for i, seat := range sorted {
+		contiguous := i > 0 && sorted[i-1].Row == seat.Row && sorted[i-1].Column == seat.Column-1
+		if !free[seat.ComputerID] {
+			run = nil
+			continue
+		}
+		if !contiguous {
+			run = nil
+		}
+		run = append(run, seat.ComputerID)
+		if len(run) == size {
+			return run
+		}
+	}
+	return nil
+}
+
+// Sort orders seats row by row, left to right.
+func Sort(seats []models.Seat) {
+	sort.Slice(seats, func(a, b int) bool {
+		if seats[a].Row != seats[b].Row {
+			return seats[a].Row < seats[b].Row
+		}
+		return seats[a].Column < seats[b].Column
+	})
+}
@@ -0,0 +1,59 @@
+package floorplan
+
+import (
+	"booking/internal/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	seats := []models.Seat{
+		{ComputerID: 1, Row: 0, Column: 0, Orientation: models.OrientationNorth},
+		{ComputerID: 2, Row: 0, Column: 1},
+	}
+	assert.NoError(t, Validate(2, 2, seats))
+
+	assert.Error(t, Validate(0, 2, seats))
+	assert.Error(t, Validate(1, 1, seats))
+	assert.Error(t, Validate(2, 2, append(seats, models.Seat{ComputerID: 3, Row: 0, Column: 1})))
+	assert.Error(t, Validate(2, 2, append(seats, models.Seat{ComputerID: 1, Row: 1, Column: 1})))
+	assert.Error(t, Validate(2, 2, []models.Seat{{ComputerID: 1, Orientation: "up"}}))
+}
+
+func TestNeighbours(t *testing.T) {
+	seats := []models.Seat{
+		{ComputerID: 1, Row: 0, Column: 0},
+		{ComputerID: 2, Row: 0, Column: 1},
+		{ComputerID: 3, Row: 0, Column: 2},
+		{ComputerID: 4, Row: 0, Column: 4},
+		{ComputerID: 5, Row: 1, Column: 1},
+	}
+
+	neighbours := Neighbours(seats)
+	assert.Equal(t, []uint{2}, neighbours[1])
+	assert.Equal(t, []uint{1, 3}, neighbours[2])
+	assert.Equal(t, []uint{2}, neighbours[3])
+	assert.Equal(t, []uint{}, neighbours[4])
+	assert.Equal(t, []uint{}, neighbours[5])
+}
+
+func TestFindAdjacent(t *testing.T) {
+	seats := []models.Seat{
+		{ComputerID: 1, Row: 0, Column: 0},
+		{ComputerID: 2, Row: 0, Column: 1},
+		{ComputerID: 3, Row: 0, Column: 3},
+		{ComputerID: 4, Row: 1, Column: 0},
+		{ComputerID: 5, Row: 1, Column: 1},
+		{ComputerID: 6, Row: 1, Column: 2},
+	}
+	free := map[uint]bool{1: true, 2: true, 3: true, 4: true, 5: false, 6: true}
+
+	assert.Equal(t, []uint{1}, FindAdjacent(seats, free, 1))
+	assert.Equal(t, []uint{1, 2}, FindAdjacent(seats, free, 2))
+	// 2 and 3 are not side by side, and 5 breaks the second row.
+	assert.Nil(t, FindAdjacent(seats, free, 3))
+
+	free[5] = true
+	assert.Equal(t, []uint{4, 5, 6}, FindAdjacent(seats, free, 3))
+	assert.Nil(t, FindAdjacent(seats, free, 0))
+}
@@ -0,0 +1,133 @@
+// Package hours works out when a location is closed, from its weekly opening
+// hours and its holiday and ad-hoc closure calendars.
+package hours
+
+import (
+	"booking/internal/schedule"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const day = 24 * time.Hour
+
+// Period is a span of one weekday during which a location is open. Opens and
+// Closes are offsets from local midnight; Closes may be 24h for midnight.
+type Period struct {
+	Weekday time.Weekday
+	Opens   time.Duration
+	Closes  time.Duration
+}
+
+// ParseClock reads a wall clock time such as "09:30" as an offset from
+// midnight. "24:00" stands for the end of the day.
+func ParseClock(raw string) (time.Duration, error) {
+	var hour, minute int
+	if n, err := fmt.Sscanf(raw, "%d:%d", &hour, &minute); err != nil || n != 2 || len(raw) != 5 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", raw)
+	}
+	if hour < 0 || minute < 0 || minute > 59 || hour > 24 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", raw)
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// FormatClock renders an offset from midnight as HH:MM.
+func FormatClock(offset time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(offset/time.Hour), int(offset%time.Hour/time.Minute))
+}
+
+// Validate checks that every period opens before it closes, within the day,
+// and that periods of the same weekday do not overlap.
+func Validate(periods []Period) error {
+	byDay := make(map[time.Weekday][]Period)
+	for _, period := range periods {
+		if period.Weekday < time.Sunday || period.Weekday > time.Saturday {
+			return fmt.Errorf("invalid weekday %d", period.Weekday)
+		}
+		if period.Opens < 0 || period.Closes > day || period.Closes <= period.Opens {
+			return fmt.Errorf("%s: opening hours %s-%s must open before they close", period.Weekday, FormatClock(period.Opens), FormatClock(period.Closes))
+		}
+		byDay[period.Weekday] = append(byDay[period.Weekday], period)
+	}
+
+	for weekday, periods := range byDay {
+		sort.Slice(periods, func(a, b int) bool { return periods[a].Opens < periods[b].Opens })
+		for i := 1; i < len(periods); i++ {
+			if periods[i].Opens < periods[i-1].Closes {
+				return fmt.Errorf("%s: opening hours %s-%s and %s-%s overlap", weekday,
+					FormatClock(periods[i-1].Opens), FormatClock(periods[i-1].Closes),
+					FormatClock(periods[i].Opens), FormatClock(periods[i].Closes))
+			}
+		}
+	}
+	return nil
+}
+
+// Calendar is everything that decides when one location is open. A calendar
+// without weekly periods is open around the clock apart from its closures.
+type Calendar struct {
+	Zone     *time.Location
+	Weekly   []Period
+	Closures []schedule.Interval
+}
+
+// Closed returns the merged intervals within window during which the location
+// is closed.
+func (c Calendar) Closed(window schedule.Interval) []schedule.Interval {
+	closed := make([]schedule.Interval, 0, len(c.Closures))
+	for _, closure := range c.Closures {
+		if closure = closure.Clip(window); !closure.Empty() {
+			closed = append(closed, closure)
+		}
+	}
+	if len(c.Weekly) > 0 {
+		closed = append(closed, schedule.Free(window, c.open(window))...)
+	}
+	return schedule.Merge(closed)
+}
+
+// IsOpen reports whether the location is open throughout window. An empty
+// window asks about the single instant it starts at.
+func (c Calendar) IsOpen(window schedule.Interval) bool {
+	if window.Empty() {
+		window.End = window.Start.Add(time.Nanosecond)
+	}
+	return len(c.Closed(window)) == 0
+}
+
+// open returns the weekly opening periods that fall on the local days
+// touching window. Days are walked by calendar date so that periods keep their
+// wall clock times across daylight saving changes.
+func (c Calendar) open(window schedule.Interval) []schedule.Interval {
+	zone := c.Zone
+	if zone == nil {
+		zone = time.UTC
+	}
+
+	start := window.Start.In(zone)
+	date := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, zone)
+	var open []schedule.Interval
+	for ; date.Before(window.End); date = date.AddDate(0, 0, 1) {
+		for _, period := range c.Weekly {
+			if period.Weekday != date.Weekday() {
+				continue
+			}
+			open = append(open, schedule.Interval{
+				Start: WallClock(date, period.Opens),
+				End:   WallClock(date, period.Closes),
+			})
+		}
+	}
+	return open
+}
+
+// WallClock returns the instant offset past midnight on date, read as a wall
+// clock time in date's zone. An offset of 24h is the following midnight.
+func WallClock(date time.Time, offset time.Duration) time.Time {
+	if offset >= day {
+		return date.AddDate(0, 0, 1)
+	}
+	hour, minute := int(offset/time.Hour), int(offset%time.Hour/time.Minute)
+	return time.Date(date.Year(), date.Month(), date.Day(), hour, minute, 0, 0, date.Location())
+}
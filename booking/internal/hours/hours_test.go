@@ -0,0 +1,90 @@
+package hours
+
+import (
+	"booking/internal/schedule"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	offset, err := ParseClock("09:30")
+	assert.NoError(t, err)
+	assert.Equal(t, 9*time.Hour+30*time.Minute, offset)
+
+	offset, err = ParseClock("24:00")
+	assert.NoError(t, err)
+	assert.Equal(t, 24*time.Hour, offset)
+	assert.Equal(t, "24:00", FormatClock(offset))
+
+	for _, raw := range []string{"", "9:30", "09:60", "24:30", "25:00", "noon"} {
+		_, err := ParseClock(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	periods := []Period{
+		{Weekday: time.Monday, Opens: 9 * time.Hour, Closes: 12 * time.Hour},
+		{Weekday: time.Monday, Opens: 13 * time.Hour, Closes: 18 * time.Hour},
+	}
+	assert.NoError(t, Validate(periods))
+
+	assert.Error(t, Validate(append(periods, Period{Weekday: time.Monday, Opens: 11 * time.Hour, Closes: 14 * time.Hour})))
+	assert.Error(t, Validate([]Period{{Weekday: time.Monday, Opens: 18 * time.Hour, Closes: 9 * time.Hour}}))
+	assert.Error(t, Validate([]Period{{Weekday: 7, Opens: 9 * time.Hour, Closes: 18 * time.Hour}}))
+}
+
+func TestClosed(t *testing.T) {
+	zone, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02T15:04", value, zone)
+		assert.NoError(t, err)
+		return parsed
+	}
+
+	calendar := Calendar{
+		Zone: zone,
+		Weekly: []Period{
+			{Weekday: time.Monday, Opens: 9 * time.Hour, Closes: 17 * time.Hour},
+			{Weekday: time.Tuesday, Opens: 9 * time.Hour, Closes: 17 * time.Hour},
+		},
+		Closures: []schedule.Interval{{Start: at("2030-06-04T12:00"), End: at("2030-06-04T13:00")}},
+	}
+
+	// Monday 2030-06-03 to Wednesday 2030-06-05.
+	window := schedule.Interval{Start: at("2030-06-03T00:00"), End: at("2030-06-05T00:00")}
+	assert.Equal(t, []schedule.Interval{
+		{Start: at("2030-06-03T00:00"), End: at("2030-06-03T09:00")},
+		{Start: at("2030-06-03T17:00"), End: at("2030-06-04T09:00")},
+		{Start: at("2030-06-04T12:00"), End: at("2030-06-04T13:00")},
+		{Start: at("2030-06-04T17:00"), End: at("2030-06-05T00:00")},
+	}, calendar.Closed(window))
+
+	assert.True(t, calendar.IsOpen(schedule.Interval{Start: at("2030-06-03T09:00"), End: at("2030-06-03T17:00")}))
+	assert.False(t, calendar.IsOpen(schedule.Interval{Start: at("2030-06-03T16:00"), End: at("2030-06-03T18:00")}))
+	assert.False(t, calendar.IsOpen(schedule.Interval{Start: at("2030-06-04T12:30"), End: at("2030-06-04T12:30")}))
+	assert.True(t, calendar.IsOpen(schedule.Interval{Start: at("2030-06-04T13:00"), End: at("2030-06-04T13:00")}))
+
+	// Without weekly hours only the closures count.
+	calendar.Weekly = nil
+	assert.Len(t, calendar.Closed(window), 1)
+}
+
+func TestClosedAcrossDaylightSaving(t *testing.T) {
+	zone, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+
+	// Clocks go forward on Sunday 2030-03-31; opening hours keep their wall
+	// clock times.
+	calendar := Calendar{Zone: zone, Weekly: []Period{
+		{Weekday: time.Saturday, Opens: 10 * time.Hour, Closes: 24 * time.Hour},
+		{Weekday: time.Sunday, Opens: 0, Closes: 10 * time.Hour},
+	}}
+	start := time.Date(2030, 3, 30, 10, 0, 0, 0, zone)
+	end := time.Date(2030, 3, 31, 10, 0, 0, 0, zone)
+	assert.Equal(t, 23*time.Hour, end.Sub(start))
+	assert.True(t, calendar.IsOpen(schedule.Interval{Start: start, End: end}))
+	assert.False(t, calendar.IsOpen(schedule.Interval{Start: start, End: end.Add(time.Minute)}))
+}
@@ -5,15 +5,426 @@ import (
 	"time"
 )
 
+const (
+	ComputerAvailable = "available"
+	ComputerBooked    = "booked"
+	// ComputerMaintenance is set and cleared by maintenance windows.
+	ComputerMaintenance = "maintenance"
+)
+
+// Location is a site, such as a lab building, whose rooms hold computers.
+// Booking times at a location are interpreted and rendered in its TimeZone.
+type Location struct {
+	gorm.Model
+	Name     string `gorm:"unique;not null"`
+	TimeZone string `gorm:"not null;default:'UTC'"`
+}
+
+// Zone returns the location's time zone, or UTC when it is unset or unknown.
+func (l *Location) Zone() *time.Location {
+	if l == nil || l.TimeZone == "" {
+		return time.UTC
+	}
+	zone, err := time.LoadLocation(l.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return zone
+}
+
+type Room struct {
+	gorm.Model
+	LocationID uint   `gorm:"not null;uniqueIndex:idx_rooms_location_name"`
+	Name       string `gorm:"not null;uniqueIndex:idx_rooms_location_name"`
+}
+
+// OpeningHours is one span of a weekday during which a location is open.
+// Weekday counts from Sunday as 0; Opens and Closes are local wall clock times
+// as HH:MM, with "24:00" for midnight. A location without opening hours is
+// open around the clock.
+type OpeningHours struct {
+	gorm.Model
+	LocationID uint   `gorm:"not null;index"`
+	Weekday    int    `gorm:"not null"`
+	Opens      string `gorm:"type:varchar(5);not null"`
+	Closes     string `gorm:"type:varchar(5);not null"`
+}
+
+const (
+	ClosureHoliday = "holiday"
+	ClosureAdHoc   = "closure"
+)
+
+// Closure is a period during which a location is closed whatever its opening
+// hours say: a public holiday or an ad-hoc closure.
+type Closure struct {
+	gorm.Model
+	LocationID uint      `gorm:"not null;index"`
+	Kind       string    `gorm:"type:varchar(20);not null"`
+	Reason     string    `gorm:"type:text"`
+	StartTime  time.Time `gorm:"not null"`
+	EndTime    time.Time `gorm:"not null"`
+}
+
+// FloorPlan is the seat grid of a room.
+type FloorPlan struct {
+	gorm.Model
+	RoomID  uint `gorm:"uniqueIndex;not null"`
+	Rows    int
+	Columns int
+}
+
+const (
+	OrientationNorth = "north"
+	OrientationEast  = "east"
+	OrientationSouth = "south"
+	OrientationWest  = "west"
+)
+
+// Seat places a computer on its room's floor plan. Row and Column are zero
+// based; Orientation is the direction the user faces when seated.
+type Seat struct {
+	ID          uint   `gorm:"primarykey"`
+	RoomID      uint   `gorm:"not null;uniqueIndex:idx_seats_room_cell"`
+	ComputerID  uint   `gorm:"not null;uniqueIndex"`
+	Row         int    `gorm:"column:grid_row;uniqueIndex:idx_seats_room_cell"`
+	Column      int    `gorm:"column:grid_column;uniqueIndex:idx_seats_room_cell"`
+	Orientation string `gorm:"type:varchar(10)"`
+	Label       string
+}
+
 type Computer struct {
 	gorm.Model
-	Number int    `gorm:"unique;not null"`
-	Status string `gorm:"type:varchar(20);default:'available'"`
+	RoomID      *uint      `gorm:"index"`
+	Number      int        `gorm:"unique;not null"`
+	Status      string     `gorm:"type:varchar(20);default:'available'"`
+	Class       string     `gorm:"type:varchar(50)"`
+	CPU         string     `gorm:"column:cpu"`
+	GPU         string     `gorm:"column:gpu"`
+	RAMGB       int        `gorm:"column:ram_gb"`
+	Monitor     string     `gorm:"column:monitor"`
+	Peripherals StringList `gorm:"type:text"`
+	Tags        StringList `gorm:"type:text"`
+}
+
+// MaintenanceWindow takes a computer out of service from StartTime until
+// ExpectedEnd, or until it is ended by hand when no end is expected. EndedAt
+// records when the window actually ended; the computer reopens then.
+type MaintenanceWindow struct {
+	gorm.Model
+	ComputerID  uint       `gorm:"not null;index"`
+	Reason      string     `gorm:"type:text;not null"`
+	ReportedBy  string     `gorm:"type:varchar(255);not null"`
+	StartTime   time.Time  `gorm:"not null;index"`
+	ExpectedEnd *time.Time `gorm:"index"`
+	EndedAt     *time.Time `gorm:"index"`
+}
+
+// End returns when the window stops blocking its computer, or nil while it
+// is open ended.
+func (m *MaintenanceWindow) End() *time.Time {
+	if m.EndedAt != nil {
+		return m.EndedAt
+	}
+	return m.ExpectedEnd
+}
+
+const (
+	BookingPending   = "pending"
+	BookingConfirmed = "confirmed"
+	BookingCheckedIn = "checked_in"
+	BookingCompleted = "completed"
+	BookingCancelled = "cancelled"
+	BookingNoShow    = "no_show"
+)
+
+// ActiveBookingStatuses are the statuses in which a booking occupies its
+// computer and blocks overlapping bookings.
+var ActiveBookingStatuses = []string{BookingPending, BookingConfirmed, BookingCheckedIn}
+
+// bookingTransitions lists the statuses each booking status may move to.
+// Statuses without an entry are terminal.
+var bookingTransitions = map[string][]string{
+	BookingPending:   {BookingConfirmed, BookingCancelled},
+	BookingConfirmed: {BookingCheckedIn, BookingCancelled, BookingNoShow},
+	BookingCheckedIn: {BookingCompleted},
 }
+
 type Booking struct {
 	gorm.Model
 	UserID     string    `gorm:"type:varchar(255);not null"`
+	Email      string    `gorm:"type:varchar(255)"`
 	ComputerID uint      `gorm:"not null"`
 	StartTime  time.Time `gorm:"not null"`
 	EndTime    time.Time `gorm:"not null"`
+	SeriesID   *uint     `gorm:"index"`
+	GroupID    *uint     `gorm:"index"`
+	Status     string    `gorm:"type:varchar(20);default:'confirmed';index"`
+	// HoldExpiresAt is set on pending bookings created as tentative holds;
+	// the hold is released if it is not confirmed by then.
+	HoldExpiresAt *time.Time `gorm:"index"`
+	// Price is what the booking costs in minor units of Currency, quoted when
+	// it was made or last moved. It is zero when no tariff applies.
+	Price    int64
+	Currency string `gorm:"type:varchar(3)"`
+}
+
+// CanTransition reports whether the booking may move from its current status
+// to the given one.
+func (b *Booking) CanTransition(to string) bool {
+	for _, next := range bookingTransitions[b.Status] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IsActive reports whether the booking still occupies its computer.
+func (b *Booking) IsActive() bool {
+	for _, status := range ActiveBookingStatuses {
+		if b.Status == status {
+			return true
+		}
+	}
+	return false
+}
+
+// BookingReminder records a reminder that was sent for a booking so that it is
+// never sent twice, even across restarts. StartTime is part of the key: moving
+// a booking re-arms its reminders for the new time.
+type BookingReminder struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	BookingID uint          `gorm:"not null;uniqueIndex:idx_booking_reminder"`
+	Offset    time.Duration `gorm:"not null;uniqueIndex:idx_booking_reminder"`
+	StartTime time.Time     `gorm:"not null;uniqueIndex:idx_booking_reminder"`
+}
+
+// BookingTransition records one status change of a booking: who made it, when
+// and why.
+type BookingTransition struct {
+	ID         uint `gorm:"primarykey"`
+	CreatedAt  time.Time
+	BookingID  uint   `gorm:"not null;index"`
+	FromStatus string `gorm:"type:varchar(20);not null"`
+	ToStatus   string `gorm:"type:varchar(20);not null"`
+	ActorID    string `gorm:"type:varchar(255);not null"`
+	Reason     string `gorm:"type:text"`
+}
+
+// BookingSeries groups the bookings expanded from one recurrence rule.
+// StartTime and EndTime describe the first occurrence.
+type BookingSeries struct {
+	gorm.Model
+	UserID     string    `gorm:"type:varchar(255);not null"`
+	ComputerID uint      `gorm:"not null"`
+	RRule      string    `gorm:"type:varchar(255);not null"`
+	StartTime  time.Time `gorm:"not null"`
+	EndTime    time.Time `gorm:"not null"`
+	Bookings   []Booking `gorm:"foreignKey:SeriesID"`
+}
+
+// BookingGroup ties together the bookings of several computers for the same
+// window that were made, and are cancelled, as one.
+type BookingGroup struct {
+	gorm.Model
+	UserID    string    `gorm:"type:varchar(255);not null;index"`
+	StartTime time.Time `gorm:"not null"`
+	EndTime   time.Time `gorm:"not null"`
+	Bookings  []Booking `gorm:"foreignKey:GroupID"`
+}
+
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistOffered   = "offered"
+	WaitlistClaimed   = "claimed"
+	WaitlistExpired   = "expired"
+	WaitlistCancelled = "cancelled"
+)
+
+// WaitlistEntry is a user's request for a computer in a window that was fully
+// booked. A nil ComputerID means any computer will do. When a slot frees up the
+// entry is offered a computer until OfferExpiresAt, held for it by the hold
+// OfferedBookingID.
+type WaitlistEntry struct {
+	gorm.Model
+	UserID            string    `gorm:"type:varchar(255);not null;index"`
+	Email             string    `gorm:"type:varchar(255)"`
+	ComputerID        *uint     `gorm:"index"`
+	StartTime         time.Time `gorm:"not null"`
+	EndTime           time.Time `gorm:"not null"`
+	Status            string    `gorm:"type:varchar(20);default:'waiting';index"`
+	OfferedComputerID *uint
+	OfferedBookingID  *uint
+	OfferExpiresAt    *time.Time
+}
+
+const (
+	IssueOpen         = "open"
+	IssueAcknowledged = "acknowledged"
+	IssueInProgress   = "in_progress"
+	IssueResolved     = "resolved"
+)
+
+const (
+	SeverityLow    = "low"
+	SeverityMedium = "medium"
+	SeverityHigh   = "high"
+)
+
+// issueTransitions lists the statuses each issue status may move to. A
+// resolved issue may be reopened.
+var issueTransitions = map[string][]string{
+	IssueOpen:         {IssueAcknowledged, IssueInProgress, IssueResolved},
+	IssueAcknowledged: {IssueInProgress, IssueResolved},
+	IssueInProgress:   {IssueResolved},
+	IssueResolved:     {IssueOpen},
+}
+
+// Issue is a hardware problem a user reported against a computer, optionally
+// during one of their bookings. MaintenanceWindowID is set when the report
+// took the computer out of service.
+type Issue struct {
+	gorm.Model
+	ComputerID          uint   `gorm:"not null;index"`
+	BookingID           *uint  `gorm:"index"`
+	ReporterID          string `gorm:"type:varchar(255);not null;index"`
+	ReporterEmail       string `gorm:"type:varchar(255)"`
+	Title               string `gorm:"type:varchar(255);not null"`
+	Description         string `gorm:"type:text"`
+	Severity            string `gorm:"type:varchar(10);not null;default:'medium'"`
+	Status              string `gorm:"type:varchar(20);not null;default:'open';index"`
+	AssigneeID          string `gorm:"type:varchar(255);index"`
+	MaintenanceWindowID *uint
+	ResolvedAt          *time.Time
+	Comments            []IssueComment
+}
+
+// CanTransition reports whether the issue may move from its current status
+// to the given one.
+func (i *Issue) CanTransition(to string) bool {
+	for _, next := range issueTransitions[i.Status] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// IssueComment is a note on an issue by its reporter or an admin. Status
+// changes are recorded as comments too.
+type IssueComment struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	IssueID   uint   `gorm:"not null;index"`
+	AuthorID  string `gorm:"type:varchar(255);not null"`
+	Body      string `gorm:"type:text;not null"`
+}
+
+// Tariff prices bookings. HourlyRate and MinimumCharge are in minor units of
+// Currency, such as cents. A tariff with a LocationID applies at that
+// location; the one without applies everywhere else. Each location, and the
+// default, has at most one tariff.
+type Tariff struct {
+	gorm.Model
+	Name              string `gorm:"unique;not null"`
+	LocationID        *uint  `gorm:"index"`
+	Currency          string `gorm:"type:varchar(3);not null"`
+	HourlyRate        int64  `gorm:"not null"`
+	WeekendMultiplier float64
+	MinimumCharge     int64
+	Peaks             []TariffPeak
+	Classes           []TariffClass
+}
+
+// TariffPeak multiplies the hourly rate during a span of one weekday. Weekday
+// counts from Sunday as 0; Starts and Ends are local times as HH:MM.
+type TariffPeak struct {
+	ID         uint   `gorm:"primarykey"`
+	TariffID   uint   `gorm:"not null;index"`
+	Weekday    int    `gorm:"not null"`
+	Starts     string `gorm:"type:varchar(5);not null"`
+	Ends       string `gorm:"type:varchar(5);not null"`
+	Multiplier float64
+}
+
+// TariffClass multiplies the hourly rate for computers of a class.
+type TariffClass struct {
+	ID         uint   `gorm:"primarykey"`
+	TariffID   uint   `gorm:"not null;uniqueIndex:idx_tariff_class"`
+	Class      string `gorm:"type:varchar(50);not null;uniqueIndex:idx_tariff_class"`
+	Multiplier float64
+}
+
+const (
+	LedgerTopUp      = "top_up"
+	LedgerCharge     = "charge"
+	LedgerRefund     = "refund"
+	LedgerAdjustment = "adjustment"
+)
+
+// Wallet holds what a user has to spend in one currency, in minor units.
+// Balance always equals the sum of the wallet's ledger entries and never
+// drops below zero.
+type Wallet struct {
+	gorm.Model
+	UserID   string `gorm:"not null;uniqueIndex:idx_wallet_user_currency"`
+	Currency string `gorm:"type:varchar(3);not null;uniqueIndex:idx_wallet_user_currency"`
+	Balance  int64  `gorm:"not null;default:0"`
+}
+
+// LedgerEntry is one movement of money in or out of a wallet. Entries are
+// only ever appended; mistakes are corrected with an adjustment. Amount is
+// negative for money leaving the wallet, and Balance is the wallet's balance
+// right after the entry.
+type LedgerEntry struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	WalletID  uint   `gorm:"not null;index"`
+	Kind      string `gorm:"type:varchar(20);not null"`
+	Amount    int64  `gorm:"not null"`
+	Balance   int64  `gorm:"not null"`
+	BookingID *uint  `gorm:"index"`
+	PaymentID *uint  `gorm:"index"`
+	ActorID   string
+	Note      string
+}
+
+const (
+	PaymentPending   = "pending"
+	PaymentSucceeded = "succeeded"
+	PaymentFailed    = "failed"
+	PaymentRefunded  = "refunded"
+)
+
+// Payment is a wallet top-up paid through a payment provider. ProviderRef is
+// the provider's id for the payment intent. A payment stays pending until
+// the provider settles it, and credits the wallet when it succeeds.
+type Payment struct {
+	gorm.Model
+	UserID        string `gorm:"not null;index"`
+	Email         string `gorm:"type:varchar(255)"`
+	Provider      string `gorm:"type:varchar(50);not null"`
+	ProviderRef   string `gorm:"index"`
+	Amount        int64  `gorm:"not null"`
+	Currency      string `gorm:"type:varchar(3);not null"`
+	Status        string `gorm:"type:varchar(20);not null;index"`
+	FailureReason string
+	SettledAt     *time.Time
+}
+
+// IdempotencyKey stores the outcome of a request made with an
+// Idempotency-Key header so that retries replay it instead of repeating it.
+// Keys are scoped to the user; Fingerprint identifies the original request.
+type IdempotencyKey struct {
+	ID           uint `gorm:"primarykey"`
+	CreatedAt    time.Time
+	UserID       string `gorm:"type:varchar(255);not null;uniqueIndex:idx_idempotency_key"`
+	Key          string `gorm:"column:idempotency_key;type:varchar(255);not null;uniqueIndex:idx_idempotency_key"`
+	Fingerprint  string `gorm:"type:varchar(64);not null"`
+	Completed    bool   `gorm:"not null;default:false"`
+	StatusCode   int
+	ResponseBody []byte
+	ExpiresAt    time.Time `gorm:"not null;index"`
 }
@@ -47,3 +47,35 @@ func TestCreateBooking(t *testing.T) {
 	assert.NoError(t, result.Error)
 	assert.Equal(t, uint(1), booking.ID)
 }
+
+func TestBookingTransitions(t *testing.T) {
+	booking := Booking{Status: BookingConfirmed}
+	assert.True(t, booking.IsActive())
+	assert.True(t, booking.CanTransition(BookingCheckedIn))
+	assert.True(t, booking.CanTransition(BookingCancelled))
+	assert.False(t, booking.CanTransition(BookingCompleted))
+
+	booking.Status = BookingCheckedIn
+	assert.True(t, booking.CanTransition(BookingCompleted))
+	assert.False(t, booking.CanTransition(BookingCancelled))
+
+	for _, status := range []string{BookingCompleted, BookingCancelled, BookingNoShow} {
+		booking.Status = status
+		assert.False(t, booking.IsActive())
+		assert.False(t, booking.CanTransition(BookingConfirmed))
+	}
+}
+
+func TestIssueTransitions(t *testing.T) {
+	issue := Issue{Status: IssueOpen}
+	assert.True(t, issue.CanTransition(IssueAcknowledged))
+	assert.True(t, issue.CanTransition(IssueResolved))
+
+	issue.Status = IssueInProgress
+	assert.True(t, issue.CanTransition(IssueResolved))
+	assert.False(t, issue.CanTransition(IssueAcknowledged))
+
+	issue.Status = IssueResolved
+	assert.True(t, issue.CanTransition(IssueOpen))
+	assert.False(t, issue.CanTransition(IssueInProgress))
+}
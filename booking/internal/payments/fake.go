@@ -0,0 +1,216 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Payment methods understood by the fake provider. Any other method pays
+// successfully.
+const (
+	FakeSucceed = "fake_success"
+	FakeDecline = "fake_decline"
+	FakeDelay   = "fake_delay"
+)
+
+// Fake is an in-memory provider for local development and tests. The method
+// of an intent decides its fate: FakeDecline fails on capture, FakeDelay
+// stays processing for Delay after capture, anything else succeeds at once.
+// When WebhookURL is set, settlements of delayed intents are posted to it,
+// signed with Secret, like a real provider would.
+type Fake struct {
+	Secret     string
+	Delay      time.Duration
+	WebhookURL string
+	Client     *http.Client
+	// Now is the clock; time.Now when nil.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	next    int
+	intents map[string]*fakeIntent
+}
+
+type fakeIntent struct {
+	Intent
+	method   string
+	settleAt time.Time
+}
+
+// NewFake returns a fake provider signing webhooks with secret.
+func NewFake(secret string, delay time.Duration, webhookURL string) *Fake {
+	return &Fake{Secret: secret, Delay: delay, WebhookURL: webhookURL}
+}
+
+func (f *Fake) Name() string {
+	return "fake"
+}
+
+func (f *Fake) now() time.Time {
+	if f.Now != nil {
+		return f.Now()
+	}
+	return time.Now()
+}
+
+func (f *Fake) CreateIntent(ctx context.Context, request IntentRequest) (Intent, error) {
+	if request.Amount <= 0 {
+		return Intent{}, fmt.Errorf("amount must be positive")
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.intents == nil {
+		f.intents = make(map[string]*fakeIntent)
+	}
+	f.next++
+	intent := &fakeIntent{
+		Intent: Intent{
+			ID:        fmt.Sprintf("pi_fake_%d", f.next),
+			Amount:    request.Amount,
+			Currency:  request.Currency,
+			Status:    IntentRequiresCapture,
+			Reference: request.Reference,
+		},
+		method: request.Method,
+	}
+	f.intents[intent.ID] = intent
+	return intent.Intent, nil
+}
+
+func (f *Fake) Capture(ctx context.Context, id string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, err := f.find(id)
+	if err != nil {
+		return Intent{}, err
+	}
+	if intent.Status != IntentRequiresCapture {
+		return intent.Intent, nil
+	}
+
+	switch intent.method {
+	case FakeDecline:
+		intent.Status = IntentFailed
+		intent.FailureReason = "card declined"
+	case FakeDelay:
+		intent.Status = IntentProcessing
+		intent.settleAt = f.now().Add(f.Delay)
+		if f.WebhookURL != "" {
+			time.AfterFunc(f.Delay, func() { f.deliver(id) })
+		}
+	default:
+		intent.Status = IntentSucceeded
+	}
+	return intent.Intent, nil
+}
+
+func (f *Fake) Intent(ctx context.Context, id string) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, err := f.find(id)
+	if err != nil {
+		return Intent{}, err
+	}
+	return intent.Intent, nil
+}
+
+func (f *Fake) Refund(ctx context.Context, id string, amount int64) (Intent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	intent, err := f.find(id)
+	if err != nil {
+		return Intent{}, err
+	}
+	if intent.Status != IntentSucceeded {
+		return Intent{}, fmt.Errorf("cannot refund a %s payment", intent.Status)
+	}
+	if amount != intent.Amount {
+		return Intent{}, fmt.Errorf("only full refunds are supported")
+	}
+	intent.Status = IntentRefunded
+	return intent.Intent, nil
+}
+
+func (f *Fake) VerifyWebhook(payload []byte, signature string) (Event, error) {
+	if err := Verify(f.Secret, payload, signature, f.now()); err != nil {
+		return Event{}, err
+	}
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Event{}, fmt.Errorf("invalid webhook body: %w", err)
+	}
+	return event, nil
+}
+
+// Webhook returns the signed webhook the fake sends about the intent's
+// current state. Tests use it to play the provider's part.
+func (f *Fake) Webhook(id string) ([]byte, string, error) {
+	f.mu.Lock()
+	intent, err := f.find(id)
+	if err != nil {
+		f.mu.Unlock()
+		return nil, "", err
+	}
+	f.next++
+	event := Event{ID: fmt.Sprintf("evt_fake_%d", f.next), Intent: intent.Intent}
+	f.mu.Unlock()
+
+	switch event.Intent.Status {
+	case IntentSucceeded:
+		event.Type = EventSucceeded
+	case IntentFailed:
+		event.Type = EventFailed
+	case IntentRefunded:
+		event.Type = EventRefunded
+	default:
+		return nil, "", fmt.Errorf("intent %s has not settled", id)
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+	return payload, Sign(f.Secret, payload, f.now()), nil
+}
+
+// deliver posts the intent's webhook to WebhookURL. Delivery is best effort,
+// as the service reconciles intents it has not heard about.
+func (f *Fake) deliver(id string) {
+	payload, signature, err := f.Webhook(id)
+	if err != nil {
+		return
+	}
+	request, err := http.NewRequest(http.MethodPost, f.WebhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(SignatureHeader, signature)
+
+	client := f.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if response, err := client.Do(request); err == nil {
+		response.Body.Close()
+	}
+}
+
+// find returns the intent, settling it first if its delay has passed. The
+// caller must hold f.mu.
+func (f *Fake) find(id string) (*fakeIntent, error) {
+	intent, ok := f.intents[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if intent.Status == IntentProcessing && !f.now().Before(intent.settleAt) {
+		intent.Status = IntentSucceeded
+	}
+	return intent, nil
+}
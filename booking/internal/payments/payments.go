@@ -0,0 +1,132 @@
+// Package payments talks to the payment provider that funds wallet top-ups.
+// A payment is an intent: created for an amount, captured to take the money,
+// and settled as succeeded or failed, possibly some time after the capture.
+// The provider reports settlements through signed webhooks.
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	IntentRequiresCapture = "requires_capture"
+	IntentProcessing      = "processing"
+	IntentSucceeded       = "succeeded"
+	IntentFailed          = "failed"
+	IntentRefunded        = "refunded"
+)
+
+// Event types sent to the webhook.
+const (
+	EventSucceeded = "payment.succeeded"
+	EventFailed    = "payment.failed"
+	EventRefunded  = "payment.refunded"
+)
+
+// SignatureHeader is the request header carrying a webhook's signature.
+const SignatureHeader = "X-Payment-Signature"
+
+// SignatureTolerance is how old a webhook signature may be before it is
+// rejected as a replay.
+const SignatureTolerance = 5 * time.Minute
+
+var (
+	ErrNotFound         = errors.New("payment intent not found")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+)
+
+// IntentRequest asks for a new intent. Method picks the payment method, such
+// as a saved card; Reference is our own id for the payment.
+type IntentRequest struct {
+	Amount    int64
+	Currency  string
+	Method    string
+	Reference string
+}
+
+// Intent is the provider's view of one payment.
+type Intent struct {
+	ID            string `json:"id"`
+	Amount        int64  `json:"amount"`
+	Currency      string `json:"currency"`
+	Status        string `json:"status"`
+	Reference     string `json:"reference"`
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// Final reports whether the intent has settled one way or the other.
+func (i Intent) Final() bool {
+	return i.Status == IntentSucceeded || i.Status == IntentFailed || i.Status == IntentRefunded
+}
+
+// Event is a webhook notification about an intent.
+type Event struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Intent Intent `json:"intent"`
+}
+
+// Provider is a payment gateway.
+type Provider interface {
+	// Name identifies the provider in stored payments.
+	Name() string
+	CreateIntent(ctx context.Context, request IntentRequest) (Intent, error)
+	// Capture takes the money. The intent may still be processing when it
+	// returns; the outcome then arrives by webhook.
+	Capture(ctx context.Context, id string) (Intent, error)
+	// Intent looks up the current state of an intent.
+	Intent(ctx context.Context, id string) (Intent, error)
+	// Refund returns amount of a succeeded intent to the payer.
+	Refund(ctx context.Context, id string, amount int64) (Intent, error)
+	// VerifyWebhook checks the signature of a webhook body and decodes it.
+	VerifyWebhook(payload []byte, signature string) (Event, error)
+}
+
+// Sign signs a webhook body sent at the given time. The signature has the
+// form "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<payload>">".
+func Sign(secret string, payload []byte, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return "t=" + timestamp + ",v1=" + digest(secret, timestamp, payload)
+}
+
+// Verify checks a signature made by Sign and that it is no older than
+// SignatureTolerance at now.
+func Verify(secret string, payload []byte, signature string, now time.Time) error {
+	var timestamp, mac string
+	for _, part := range strings.Split(signature, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			mac = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || mac == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(mac), []byte(digest(secret, timestamp, payload))) {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > SignatureTolerance || age < -SignatureTolerance {
+		return fmt.Errorf("%w: signed %s ago", ErrInvalidSignature, age.Round(time.Second))
+	}
+	return nil
+}
+
+func digest(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
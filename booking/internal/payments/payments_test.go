@@ -0,0 +1,67 @@
+package payments
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1"}`)
+	now := time.Date(2030, 6, 3, 9, 0, 0, 0, time.UTC)
+	signature := Sign("secret", payload, now)
+
+	assert.NoError(t, Verify("secret", payload, signature, now.Add(time.Minute)))
+	assert.ErrorIs(t, Verify("other", payload, signature, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", []byte(`{"id":"evt_2"}`), signature, now), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", payload, "v1=abc", now), ErrInvalidSignature)
+	// Old signatures are replays.
+	assert.ErrorIs(t, Verify("secret", payload, signature, now.Add(time.Hour)), ErrInvalidSignature)
+}
+
+func TestFake(t *testing.T) {
+	now := time.Date(2030, 6, 3, 9, 0, 0, 0, time.UTC)
+	fake := NewFake("secret", time.Minute, "")
+	fake.Now = func() time.Time { return now }
+	ctx := context.Background()
+
+	intent, err := fake.CreateIntent(ctx, IntentRequest{Amount: 1000, Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.Equal(t, IntentRequiresCapture, intent.Status)
+	intent, err = fake.Capture(ctx, intent.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, IntentSucceeded, intent.Status)
+	_, err = fake.Refund(ctx, intent.ID, 500)
+	assert.Error(t, err)
+	intent, err = fake.Refund(ctx, intent.ID, 1000)
+	assert.NoError(t, err)
+	assert.Equal(t, IntentRefunded, intent.Status)
+
+	declined, _ := fake.CreateIntent(ctx, IntentRequest{Amount: 1000, Currency: "EUR", Method: FakeDecline})
+	declined, err = fake.Capture(ctx, declined.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, IntentFailed, declined.Status)
+	assert.NotEmpty(t, declined.FailureReason)
+
+	delayed, _ := fake.CreateIntent(ctx, IntentRequest{Amount: 1000, Currency: "EUR", Method: FakeDelay})
+	delayed, _ = fake.Capture(ctx, delayed.ID)
+	assert.Equal(t, IntentProcessing, delayed.Status)
+	_, _, err = fake.Webhook(delayed.ID)
+	assert.Error(t, err)
+
+	now = now.Add(time.Minute)
+	delayed, err = fake.Intent(ctx, delayed.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, IntentSucceeded, delayed.Status)
+
+	payload, signature, err := fake.Webhook(delayed.ID)
+	assert.NoError(t, err)
+	event, err := fake.VerifyWebhook(payload, signature)
+	assert.NoError(t, err)
+	assert.Equal(t, EventSucceeded, event.Type)
+	assert.Equal(t, delayed.ID, event.Intent.ID)
+
+	_, err = fake.Intent(ctx, "pi_missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
@@ -0,0 +1,304 @@
+// Package policy holds the declarative rules a booking has to satisfy:
+// duration bounds, slot alignment, how far ahead one may book and per-user
+// quotas. Rules are layered: defaults, then role overrides, then location
+// overrides, then role overrides within the location.
+package policy
+
+import (
+	"booking/internal/schedule"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// clockSkew is how far in the past a booking may start, so that "now" sent
+// by a client is not rejected for being a few seconds old.
+const clockSkew = time.Minute
+
+// Duration is a time.Duration read from JSON as a Go duration string such
+// as "90m". The string "none" stands for no limit.
+type Duration time.Duration
+
+// None removes a limit set by an outer layer.
+const None = Duration(-1)
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	if d < 0 {
+		return json.Marshal("none")
+	}
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var raw string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if raw == "none" {
+		*d = None
+		return nil
+	}
+	value, err := time.ParseDuration(raw)
+	if err != nil {
+		return err
+	}
+	if value < 0 {
+		return fmt.Errorf("duration %q must not be negative", raw)
+	}
+	*d = Duration(value)
+	return nil
+}
+
+// Rules are the limits for one role at one location. A zero field inherits
+// from the outer layer; a negative one (None, or -1 for MaxConcurrent) means
+// no limit.
+type Rules struct {
+	MinDuration   Duration `json:"min_duration,omitempty"`
+	MaxDuration   Duration `json:"max_duration,omitempty"`
+	Alignment     Duration `json:"alignment,omitempty"`
+	MaxAdvance    Duration `json:"max_advance,omitempty"`
+	MaxConcurrent int      `json:"max_concurrent,omitempty"`
+	MaxPerDay     Duration `json:"max_per_day,omitempty"`
+	MaxPerWeek    Duration `json:"max_per_week,omitempty"`
+}
+
+// Merge returns r with every limit that override sets replacing r's.
+func (r Rules) Merge(override Rules) Rules {
+	pick := func(base, over Duration) Duration {
+		if over != 0 {
+			return over
+		}
+		return base
+	}
+
+	r.MinDuration = pick(r.MinDuration, override.MinDuration)
+	r.MaxDuration = pick(r.MaxDuration, override.MaxDuration)
+	r.Alignment = pick(r.Alignment, override.Alignment)
+	r.MaxAdvance = pick(r.MaxAdvance, override.MaxAdvance)
+	r.MaxPerDay = pick(r.MaxPerDay, override.MaxPerDay)
+	r.MaxPerWeek = pick(r.MaxPerWeek, override.MaxPerWeek)
+	if override.MaxConcurrent != 0 {
+		r.MaxConcurrent = override.MaxConcurrent
+	}
+	return r
+}
+
+// Scope is a set of rules with per-role overrides.
+type Scope struct {
+	Rules
+	Roles map[string]Rules `json:"roles,omitempty"`
+}
+
+// Config is the whole policy. Locations are keyed by location id.
+type Config struct {
+	Scope
+	Locations map[string]Scope `json:"locations,omitempty"`
+}
+
+// Default is the policy used when none is configured.
+func Default() Config {
+	unlimited := Rules{
+		MaxDuration:   None,
+		MaxAdvance:    None,
+		MaxConcurrent: -1,
+		MaxPerDay:     None,
+		MaxPerWeek:    None,
+	}
+
+	return Config{Scope: Scope{
+		Rules: Rules{
+			MinDuration:   Duration(15 * time.Minute),
+			MaxDuration:   Duration(8 * time.Hour),
+			Alignment:     Duration(5 * time.Minute),
+			MaxAdvance:    Duration(30 * 24 * time.Hour),
+			MaxConcurrent: 2,
+			MaxPerDay:     Duration(8 * time.Hour),
+			MaxPerWeek:    Duration(24 * time.Hour),
+		},
+		Roles: map[string]Rules{"admin": unlimited},
+	}}
+}
+
+// Load reads a policy from a JSON file.
+func Load(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("invalid policy file %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// For resolves the rules that apply to role at the location with the given
+// id, or at no particular location when locationID is zero.
+func (c Config) For(role string, locationID uint) Rules {
+	rules := c.Rules.Merge(c.Roles[role])
+	if locationID == 0 {
+		return rules
+	}
+
+	location, ok := c.Locations[fmt.Sprint(locationID)]
+	if !ok {
+		return rules
+	}
+	return rules.Merge(location.Rules).Merge(location.Roles[role])
+}
+
+// Violation is a rule a booking breaks, reported against a request field.
+type Violation struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Request is a booking to check. Existing holds the user's other active
+// bookings; the quotas count them together with Window. Started marks a
+// booking already in progress, whose start is no longer checked. Recurring
+// marks an occurrence of a series other than its first; only a series' first
+// occurrence has to fall within MaxAdvance.
+type Request struct {
+	Window    schedule.Interval
+	Now       time.Time
+	Zone      *time.Location
+	Existing  []schedule.Interval
+	Started   bool
+	Recurring bool
+}
+
+// Check returns every rule the request breaks.
+func (r Rules) Check(req Request) []Violation {
+	zone := req.Zone
+	if zone == nil {
+		zone = time.UTC
+	}
+	window := schedule.Interval{Start: req.Window.Start.In(zone), End: req.Window.End.In(zone)}
+
+	var violations []Violation
+	add := func(field, code, format string, args ...interface{}) {
+		violations = append(violations, Violation{Field: field, Code: code, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if window.Empty() {
+		add("end_time", "invalid_window", "end_time must be after start_time")
+		return violations
+	}
+	if !req.Started && window.Start.Before(req.Now.Add(-clockSkew)) {
+		add("start_time", "in_past", "start_time must not be in the past")
+	}
+
+	duration := window.Duration()
+	if r.MinDuration > 0 && duration < time.Duration(r.MinDuration) {
+		add("end_time", "too_short", "bookings must last at least %s", time.Duration(r.MinDuration))
+	}
+	if r.MaxDuration > 0 && duration > time.Duration(r.MaxDuration) {
+		add("end_time", "too_long", "bookings may last at most %s", time.Duration(r.MaxDuration))
+	}
+
+	if r.Alignment > 0 {
+		step := time.Duration(r.Alignment)
+		if !req.Started && !aligned(window.Start, step) {
+			add("start_time", "misaligned", "start_time must be a multiple of %s past the hour", step)
+		}
+		if !aligned(window.End, step) {
+			add("end_time", "misaligned", "end_time must be a multiple of %s past the hour", step)
+		}
+	}
+
+	if r.MaxAdvance > 0 && !req.Started && !req.Recurring && window.Start.After(req.Now.Add(time.Duration(r.MaxAdvance))) {
+		add("start_time", "too_far_ahead", "bookings may start at most %s ahead", time.Duration(r.MaxAdvance))
+	}
+
+	if r.MaxConcurrent > 0 && maxOverlap(window, req.Existing)+1 > r.MaxConcurrent {
+		add("start_time", "max_concurrent", "at most %d bookings may run at the same time", r.MaxConcurrent)
+	}
+
+	if r.MaxPerDay > 0 {
+		for day := startOfDay(window.Start); day.Before(window.End); day = day.AddDate(0, 0, 1) {
+			period := schedule.Interval{Start: day, End: day.AddDate(0, 0, 1)}
+			if usage(period, window, req.Existing) > time.Duration(r.MaxPerDay) {
+				add("end_time", "max_per_day", "at most %s may be booked on %s", time.Duration(r.MaxPerDay), day.Format("2006-01-02"))
+				break
+			}
+		}
+	}
+
+	if r.MaxPerWeek > 0 {
+		for week := startOfWeek(window.Start); week.Before(window.End); week = week.AddDate(0, 0, 7) {
+			period := schedule.Interval{Start: week, End: week.AddDate(0, 0, 7)}
+			if usage(period, window, req.Existing) > time.Duration(r.MaxPerWeek) {
+				add("end_time", "max_per_week", "at most %s may be booked in the week of %s", time.Duration(r.MaxPerWeek), week.Format("2006-01-02"))
+				break
+			}
+		}
+	}
+
+	return violations
+}
+
+// aligned reports whether t falls on a step boundary counted from the start
+// of its hour in its own zone.
+func aligned(t time.Time, step time.Duration) bool {
+	hour := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	return t.Sub(hour)%step == 0
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns the Monday midnight on or before t.
+func startOfWeek(t time.Time) time.Time {
+	day := startOfDay(t)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// usage sums the time within period taken by window and existing.
+func usage(period, window schedule.Interval, existing []schedule.Interval) time.Duration {
+	total := window.Clip(period).Duration()
+	for _, interval := range existing {
+		total += interval.Clip(period).Duration()
+	}
+	return total
+}
+
+// maxOverlap returns the largest number of existing intervals that are in
+// progress at the same instant within window.
+func maxOverlap(window schedule.Interval, existing []schedule.Interval) int {
+	type event struct {
+		at    time.Time
+		delta int
+	}
+
+	var events []event
+	for _, interval := range existing {
+		interval = interval.Clip(window)
+		if interval.Empty() {
+			continue
+		}
+		events = append(events, event{interval.Start, 1}, event{interval.End, -1})
+	}
+	// Ends sort before starts at the same instant, since intervals are
+	// half-open.
+	sort.Slice(events, func(a, b int) bool {
+		if !events[a].at.Equal(events[b].at) {
+			return events[a].at.Before(events[b].at)
+		}
+		return events[a].delta < events[b].delta
+	})
+
+	current, peak := 0, 0
+	for _, e := range events {
+		current += e.delta
+		if current > peak {
+			peak = current
+		}
+	}
+	return peak
+}
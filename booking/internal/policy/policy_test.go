@@ -0,0 +1,93 @@
+package policy
+
+import (
+	"booking/internal/schedule"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2030, 6, 3, 8, 0, 0, 0, time.UTC) // a Monday
+
+func window(startHour, endHour float64) schedule.Interval {
+	return schedule.Interval{
+		Start: now.Add(time.Duration(startHour * float64(time.Hour))),
+		End:   now.Add(time.Duration(endHour * float64(time.Hour))),
+	}
+}
+
+func codes(violations []Violation) []string {
+	result := []string{}
+	for _, v := range violations {
+		result = append(result, v.Code)
+	}
+	return result
+}
+
+func TestCheckWindow(t *testing.T) {
+	rules := Rules{
+		MinDuration: Duration(30 * time.Minute),
+		MaxDuration: Duration(4 * time.Hour),
+		Alignment:   Duration(15 * time.Minute),
+		MaxAdvance:  Duration(7 * 24 * time.Hour),
+	}
+	check := func(w schedule.Interval) []string {
+		return codes(rules.Check(Request{Window: w, Now: now}))
+	}
+
+	assert.Empty(t, check(window(1, 3)))
+	assert.Equal(t, []string{"invalid_window"}, check(window(3, 1)))
+	assert.Equal(t, []string{"in_past"}, check(window(-2, -1)))
+	assert.Equal(t, []string{"too_short"}, check(window(1, 1.25)))
+	assert.Equal(t, []string{"too_long"}, check(window(1, 6)))
+	assert.Equal(t, []string{"misaligned", "misaligned"}, check(window(1.1, 2.1)))
+	assert.Equal(t, []string{"too_far_ahead"}, check(window(24*8, 24*8+1)))
+
+	// Extending a booking in progress only checks its new end.
+	started := rules.Check(Request{Window: window(-1.1, 1), Now: now, Started: true})
+	assert.Empty(t, started)
+
+	// Later occurrences of a series may run past the booking horizon.
+	assert.Empty(t, rules.Check(Request{Window: window(24*8, 24*8+1), Now: now, Recurring: true}))
+}
+
+func TestCheckQuotas(t *testing.T) {
+	rules := Rules{MaxConcurrent: 2, MaxPerDay: Duration(4 * time.Hour), MaxPerWeek: Duration(6 * time.Hour)}
+	check := func(w schedule.Interval, existing ...schedule.Interval) []string {
+		return codes(rules.Check(Request{Window: w, Now: now, Existing: existing}))
+	}
+
+	// Back-to-back bookings never run at the same time.
+	assert.Empty(t, check(window(1, 2), window(0, 1.5), window(1.5, 3)))
+	assert.Equal(t, []string{"max_concurrent"}, check(window(1, 2), window(0.5, 1.5), window(1, 1.5)))
+	assert.Equal(t, []string{"max_per_day"}, check(window(5, 7), window(1, 4)))
+	// Tuesday and Wednesday stay within the day quota but not the week's.
+	assert.Equal(t, []string{"max_per_week"}, check(window(48, 51), window(24, 28)))
+	// The following Monday starts a new week.
+	assert.Empty(t, check(window(24*7, 24*7+3), window(24, 28)))
+}
+
+func TestConfigFor(t *testing.T) {
+	var config Config
+	err := json.Unmarshal([]byte(`{
+		"max_duration": "4h",
+		"max_concurrent": 1,
+		"roles": {"staff": {"max_duration": "none"}},
+		"locations": {"2": {"max_duration": "2h", "roles": {"staff": {"max_concurrent": 3}}}}
+	}`), &config)
+	assert.NoError(t, err)
+
+	assert.Equal(t, Duration(4*time.Hour), config.For("user", 0).MaxDuration)
+	assert.Equal(t, None, config.For("staff", 0).MaxDuration)
+	assert.Equal(t, Duration(2*time.Hour), config.For("user", 2).MaxDuration)
+	assert.Equal(t, Duration(2*time.Hour), config.For("staff", 2).MaxDuration)
+	assert.Equal(t, 3, config.For("staff", 2).MaxConcurrent)
+	assert.Equal(t, 1, config.For("user", 2).MaxConcurrent)
+	assert.Equal(t, Duration(4*time.Hour), config.For("user", 7).MaxDuration)
+
+	assert.Error(t, json.Unmarshal([]byte(`{"max_duration": "soon"}`), &config))
+
+	admin := Default().For("admin", 0)
+	assert.Empty(t, admin.Check(Request{Window: window(1, 48), Now: now}))
+}
@@ -0,0 +1,225 @@
+// Package pricing quotes what a booking costs under a tariff: an hourly rate
+// scaled by peak and weekend multipliers for the local time of day, and by
+// the computer's class, with a minimum charge per booking.
+package pricing
+
+import (
+	"booking/internal/hours"
+	"booking/internal/schedule"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	RateOffPeak = "off_peak"
+	RatePeak    = "peak"
+	RateWeekend = "weekend"
+)
+
+// Peak is a span of one weekday, as offsets from local midnight, during which
+// the hourly rate is multiplied by Multiplier.
+type Peak struct {
+	Weekday    time.Weekday
+	Start      time.Duration
+	End        time.Duration
+	Multiplier float64
+}
+
+// Tariff holds the pricing rules. Amounts are in minor units of Currency,
+// such as cents. A zero WeekendMultiplier prices weekends like weekdays;
+// classes without a multiplier are charged the plain rate.
+type Tariff struct {
+	Currency          string
+	HourlyRate        int64
+	Peaks             []Peak
+	WeekendMultiplier float64
+	ClassMultipliers  map[string]float64
+	MinimumCharge     int64
+}
+
+// Validate checks that the tariff's amounts and multipliers are not negative
+// and that its peaks lie within their day without overlapping.
+func (t Tariff) Validate() error {
+	if len(t.Currency) != 3 {
+		return fmt.Errorf("currency %q must be a three letter code", t.Currency)
+	}
+	if t.HourlyRate < 0 || t.MinimumCharge < 0 {
+		return fmt.Errorf("amounts must not be negative")
+	}
+	if t.WeekendMultiplier < 0 {
+		return fmt.Errorf("weekend multiplier must not be negative")
+	}
+	for class, multiplier := range t.ClassMultipliers {
+		if multiplier < 0 {
+			return fmt.Errorf("multiplier of class %q must not be negative", class)
+		}
+	}
+
+	byDay := make(map[time.Weekday][]Peak)
+	for _, peak := range t.Peaks {
+		if peak.Weekday < time.Sunday || peak.Weekday > time.Saturday {
+			return fmt.Errorf("invalid weekday %d", peak.Weekday)
+		}
+		if peak.Start < 0 || peak.End > 24*time.Hour || peak.End <= peak.Start {
+			return fmt.Errorf("%s: peak %s-%s must start before it ends", peak.Weekday, hours.FormatClock(peak.Start), hours.FormatClock(peak.End))
+		}
+		if peak.Multiplier < 0 {
+			return fmt.Errorf("%s: peak multiplier must not be negative", peak.Weekday)
+		}
+		byDay[peak.Weekday] = append(byDay[peak.Weekday], peak)
+	}
+	for weekday, peaks := range byDay {
+		sort.Slice(peaks, func(a, b int) bool { return peaks[a].Start < peaks[b].Start })
+		for i := 1; i < len(peaks); i++ {
+			if peaks[i].Start < peaks[i-1].End {
+				return fmt.Errorf("%s: peaks %s-%s and %s-%s overlap", weekday,
+					hours.FormatClock(peaks[i-1].Start), hours.FormatClock(peaks[i-1].End),
+					hours.FormatClock(peaks[i].Start), hours.FormatClock(peaks[i].End))
+			}
+		}
+	}
+	return nil
+}
+
+// Line is a stretch of a booking charged at one rate.
+type Line struct {
+	Start      time.Time `json:"start_time"`
+	End        time.Time `json:"end_time"`
+	Rate       string    `json:"rate"`
+	Multiplier float64   `json:"multiplier"`
+	Amount     int64     `json:"amount"`
+}
+
+// Quote is the price of a booking, broken down by rate.
+type Quote struct {
+	Currency        string  `json:"currency"`
+	HourlyRate      int64   `json:"hourly_rate"`
+	ClassMultiplier float64 `json:"class_multiplier"`
+	Lines           []Line  `json:"lines"`
+	Subtotal        int64   `json:"subtotal"`
+	MinimumCharge   int64   `json:"minimum_charge"`
+	Total           int64   `json:"total"`
+}
+
+// Quote prices window for a computer of the given class. Peaks and weekends
+// are read in zone. A peak takes precedence over the weekend multiplier.
+func (t Tariff) Quote(window schedule.Interval, zone *time.Location, class string) Quote {
+	if zone == nil {
+		zone = time.UTC
+	}
+
+	classMultiplier := 1.0
+	if multiplier, ok := t.ClassMultipliers[class]; ok {
+		classMultiplier = multiplier
+	}
+	quote := Quote{
+		Currency:        t.Currency,
+		HourlyRate:      t.HourlyRate,
+		ClassMultiplier: classMultiplier,
+		Lines:           []Line{},
+		MinimumCharge:   t.MinimumCharge,
+	}
+
+	breaks := t.breakpoints(window, zone)
+	for i := 0; i+1 < len(breaks); i++ {
+		start, end := breaks[i], breaks[i+1]
+		rate, multiplier := t.rateAt(start.In(zone))
+
+		last := len(quote.Lines) - 1
+		if last >= 0 && quote.Lines[last].Rate == rate && quote.Lines[last].Multiplier == multiplier {
+			quote.Lines[last].End = end
+			continue
+		}
+		quote.Lines = append(quote.Lines, Line{Start: start.In(zone), End: end, Rate: rate, Multiplier: multiplier})
+	}
+
+	for i := range quote.Lines {
+		line := &quote.Lines[i]
+		line.End = line.End.In(zone)
+		hoursCharged := line.End.Sub(line.Start).Hours()
+		line.Amount = int64(math.Round(float64(t.HourlyRate) * hoursCharged * line.Multiplier * classMultiplier))
+		quote.Subtotal += line.Amount
+	}
+
+	quote.Total = quote.Subtotal
+	if quote.Total < t.MinimumCharge {
+		quote.Total = t.MinimumCharge
+	}
+	return quote
+}
+
+// breakpoints returns the window's ends together with every local midnight
+// and peak boundary within it, sorted. The rate is constant between two
+// consecutive breakpoints.
+func (t Tariff) breakpoints(window schedule.Interval, zone *time.Location) []time.Time {
+	breaks := []time.Time{window.Start, window.End}
+	inside := func(instant time.Time) bool {
+		return instant.After(window.Start) && instant.Before(window.End)
+	}
+
+	start := window.Start.In(zone)
+	date := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, zone)
+	for ; date.Before(window.End); date = date.AddDate(0, 0, 1) {
+		if inside(date) {
+			breaks = append(breaks, date)
+		}
+		for _, peak := range t.Peaks {
+			if peak.Weekday != date.Weekday() {
+				continue
+			}
+			for _, boundary := range []time.Time{hours.WallClock(date, peak.Start), hours.WallClock(date, peak.End)} {
+				if inside(boundary) {
+					breaks = append(breaks, boundary)
+				}
+			}
+		}
+	}
+
+	sort.Slice(breaks, func(a, b int) bool { return breaks[a].Before(breaks[b]) })
+	unique := breaks[:0]
+	for _, instant := range breaks {
+		if len(unique) == 0 || !unique[len(unique)-1].Equal(instant) {
+			unique = append(unique, instant)
+		}
+	}
+	return unique
+}
+
+// rateAt returns the rate that applies at the local instant.
+func (t Tariff) rateAt(local time.Time) (string, float64) {
+	offset := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute + time.Duration(local.Second())*time.Second
+	for _, peak := range t.Peaks {
+		if peak.Weekday == local.Weekday() && offset >= peak.Start && offset < peak.End {
+			return RatePeak, peak.Multiplier
+		}
+	}
+
+	weekend := local.Weekday() == time.Saturday || local.Weekday() == time.Sunday
+	if weekend && t.WeekendMultiplier > 0 {
+		return RateWeekend, t.WeekendMultiplier
+	}
+	return RateOffPeak, 1
+}
+
+// RefundPolicy decides how much of what a customer paid comes back when they
+// cancel. Cancelling at least FullNotice before the start refunds everything;
+// later cancellations get LatePercent percent back until the booking starts,
+// and nothing after.
+type RefundPolicy struct {
+	FullNotice  time.Duration
+	LatePercent int
+}
+
+// Refund returns how much of paid is refunded for a cancellation notice
+// ahead of the start. A negative notice means the booking already started.
+func (p RefundPolicy) Refund(paid int64, notice time.Duration) int64 {
+	switch {
+	case notice >= p.FullNotice && notice >= 0:
+		return paid
+	case notice >= 0:
+		return int64(math.Round(float64(paid) * float64(p.LatePercent) / 100))
+	}
+	return 0
+}
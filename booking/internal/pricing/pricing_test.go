@@ -0,0 +1,97 @@
+package pricing
+
+import (
+	"booking/internal/schedule"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func tariff() Tariff {
+	return Tariff{
+		Currency:   "EUR",
+		HourlyRate: 400,
+		Peaks: []Peak{
+			{Weekday: time.Monday, Start: 12 * time.Hour, End: 14 * time.Hour, Multiplier: 1.5},
+			{Weekday: time.Saturday, Start: 10 * time.Hour, End: 12 * time.Hour, Multiplier: 2},
+		},
+		WeekendMultiplier: 0.5,
+		ClassMultipliers:  map[string]float64{"gpu": 2},
+		MinimumCharge:     200,
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, tariff().Validate())
+
+	invalid := tariff()
+	invalid.Currency = "euro"
+	assert.Error(t, invalid.Validate())
+
+	invalid = tariff()
+	invalid.Peaks = append(invalid.Peaks, Peak{Weekday: time.Monday, Start: 13 * time.Hour, End: 15 * time.Hour, Multiplier: 1})
+	assert.Error(t, invalid.Validate())
+
+	invalid = tariff()
+	invalid.Peaks = []Peak{{Weekday: time.Monday, Start: 14 * time.Hour, End: 12 * time.Hour, Multiplier: 1}}
+	assert.Error(t, invalid.Validate())
+
+	invalid = tariff()
+	invalid.ClassMultipliers["gpu"] = -1
+	assert.Error(t, invalid.Validate())
+}
+
+func TestQuote(t *testing.T) {
+	zone, err := time.LoadLocation("Europe/Berlin")
+	assert.NoError(t, err)
+	at := func(value string) time.Time {
+		parsed, err := time.ParseInLocation("2006-01-02T15:04", value, zone)
+		assert.NoError(t, err)
+		return parsed
+	}
+
+	// Monday 11:00-15:00: one off-peak hour, two peak hours, one off-peak hour.
+	quote := tariff().Quote(schedule.Interval{Start: at("2030-06-03T11:00"), End: at("2030-06-03T15:00")}, zone, "")
+	assert.Len(t, quote.Lines, 3)
+	assert.Equal(t, RateOffPeak, quote.Lines[0].Rate)
+	assert.Equal(t, int64(400), quote.Lines[0].Amount)
+	assert.Equal(t, RatePeak, quote.Lines[1].Rate)
+	assert.Equal(t, int64(1200), quote.Lines[1].Amount)
+	assert.Equal(t, int64(400), quote.Lines[2].Amount)
+	assert.Equal(t, int64(2000), quote.Total)
+
+	// The computer class scales every line.
+	quote = tariff().Quote(schedule.Interval{Start: at("2030-06-03T11:00"), End: at("2030-06-03T12:00")}, zone, "gpu")
+	assert.Equal(t, 2.0, quote.ClassMultiplier)
+	assert.Equal(t, int64(800), quote.Total)
+
+	// Saturday: a peak beats the weekend rate.
+	quote = tariff().Quote(schedule.Interval{Start: at("2030-06-08T09:00"), End: at("2030-06-08T11:00")}, zone, "")
+	assert.Len(t, quote.Lines, 2)
+	assert.Equal(t, RateWeekend, quote.Lines[0].Rate)
+	assert.Equal(t, int64(200), quote.Lines[0].Amount)
+	assert.Equal(t, RatePeak, quote.Lines[1].Rate)
+	assert.Equal(t, int64(800), quote.Lines[1].Amount)
+
+	// Friday night into Saturday splits at midnight.
+	quote = tariff().Quote(schedule.Interval{Start: at("2030-06-07T23:00"), End: at("2030-06-08T01:00")}, zone, "")
+	assert.Len(t, quote.Lines, 2)
+	assert.Equal(t, at("2030-06-08T00:00"), quote.Lines[1].Start)
+	assert.Equal(t, int64(600), quote.Total)
+
+	// Short bookings pay the minimum charge.
+	quote = tariff().Quote(schedule.Interval{Start: at("2030-06-03T09:00"), End: at("2030-06-03T09:15")}, zone, "")
+	assert.Equal(t, int64(100), quote.Subtotal)
+	assert.Equal(t, int64(200), quote.Total)
+}
+
+func TestRefund(t *testing.T) {
+	policy := RefundPolicy{FullNotice: 24 * time.Hour, LatePercent: 50}
+	assert.Equal(t, int64(1000), policy.Refund(1000, 48*time.Hour))
+	assert.Equal(t, int64(1000), policy.Refund(1000, 24*time.Hour))
+	assert.Equal(t, int64(500), policy.Refund(1000, time.Hour))
+	assert.Equal(t, int64(0), policy.Refund(1000, -time.Minute))
+
+	// Without a notice period every cancellation before the start is free.
+	assert.Equal(t, int64(1000), RefundPolicy{}.Refund(1000, time.Minute))
+}
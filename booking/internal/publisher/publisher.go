@@ -12,6 +12,11 @@ type Message struct {
 	Recipient string `json:"recipient"`
 }
 
+// Publisher delivers messages to the notification service.
+type Publisher interface {
+	PublishMessage(msg Message) error
+}
+
 type RabbitPublisher struct {
 	rabbitUrl string
 }
@@ -0,0 +1,221 @@
+// Package recurrence implements the subset of iCalendar (RFC 5545) RRULE
+// semantics used for recurring bookings: DAILY and WEEKLY frequencies with
+// INTERVAL, COUNT, UNTIL and BYDAY.
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxOccurrences caps how many occurrences a single rule may expand into.
+const MaxOccurrences = 366
+
+const (
+	Daily  = "DAILY"
+	Weekly = "WEEKLY"
+)
+
+var (
+	ErrNoBound        = errors.New("rrule must set COUNT or UNTIL")
+	ErrTooManyResults = fmt.Errorf("rrule expands to more than %d occurrences", MaxOccurrences)
+)
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+type Rule struct {
+	Freq     string
+	Interval int
+	Count    int
+	Until    time.Time
+	ByDay    []time.Weekday
+}
+
+// Parse reads an RRULE value such as "FREQ=WEEKLY;BYDAY=TU;COUNT=16". The
+// optional "RRULE:" prefix is accepted.
+func Parse(value string) (Rule, error) {
+	rule := Rule{Interval: 1}
+	value = strings.TrimPrefix(strings.TrimSpace(value), "RRULE:")
+
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(part, "=")
+		if !ok {
+			return Rule{}, fmt.Errorf("malformed rrule part %q", part)
+		}
+
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(val)
+			if rule.Freq != Daily && rule.Freq != Weekly {
+				return Rule{}, fmt.Errorf("unsupported FREQ %q", val)
+			}
+		case "INTERVAL":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return Rule{}, fmt.Errorf("invalid INTERVAL %q", val)
+			}
+			rule.Interval = n
+		case "COUNT":
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return Rule{}, fmt.Errorf("invalid COUNT %q", val)
+			}
+			rule.Count = n
+		case "UNTIL":
+			until, err := parseUntil(val)
+			if err != nil {
+				return Rule{}, fmt.Errorf("invalid UNTIL %q", val)
+			}
+			rule.Until = until
+		case "BYDAY":
+			for _, day := range strings.Split(val, ",") {
+				weekday, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return Rule{}, fmt.Errorf("invalid BYDAY %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+		case "WKST":
+			if strings.ToUpper(val) != "MO" {
+				return Rule{}, fmt.Errorf("unsupported WKST %q", val)
+			}
+		default:
+			return Rule{}, fmt.Errorf("unsupported rrule part %q", key)
+		}
+	}
+
+	if rule.Freq == "" {
+		return Rule{}, errors.New("rrule must set FREQ")
+	}
+	if rule.Count == 0 && rule.Until.IsZero() {
+		return Rule{}, ErrNoBound
+	}
+	if rule.Count > 0 && !rule.Until.IsZero() {
+		return Rule{}, errors.New("rrule must not set both COUNT and UNTIL")
+	}
+	if rule.Count > MaxOccurrences {
+		return Rule{}, ErrTooManyResults
+	}
+	return rule, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("20060102", value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// A date-only UNTIL includes the whole day.
+	return t.Add(24*time.Hour - time.Second), nil
+}
+
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, weekday := range r.ByDay {
+			for name, day := range weekdays {
+				if day == weekday {
+					days = append(days, name)
+				}
+			}
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if !r.Until.IsZero() {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// Expand returns the start times of every occurrence of the rule beginning at
+// start, in chronological order. Like RFC 5545, COUNT is applied before the
+// exception dates are removed. Wall-clock time is preserved across DST changes
+// in start's location.
+func (r Rule) Expand(start time.Time, exdates []time.Time) ([]time.Time, error) {
+	var occurrences []time.Time
+
+	add := func(t time.Time) bool {
+		if t.Before(start) {
+			return true
+		}
+		if !r.Until.IsZero() && t.After(r.Until) {
+			return false
+		}
+		if r.Count > 0 && len(occurrences) >= r.Count {
+			return false
+		}
+		occurrences = append(occurrences, t)
+		return len(occurrences) <= MaxOccurrences
+	}
+
+	switch r.Freq {
+	case Daily:
+		for i := 0; add(start.AddDate(0, 0, i*r.Interval)); i++ {
+		}
+	case Weekly:
+		days := r.ByDay
+		if len(days) == 0 {
+			days = []time.Weekday{start.Weekday()}
+		}
+		offsets := make([]int, 0, len(days))
+		for _, day := range days {
+			offsets = append(offsets, (int(day)+6)%7)
+		}
+		sort.Ints(offsets)
+
+		monday := start.AddDate(0, 0, -((int(start.Weekday()) + 6) % 7))
+	weeks:
+		for week := 0; ; week++ {
+			for _, offset := range offsets {
+				if !add(monday.AddDate(0, 0, week*7*r.Interval+offset)) {
+					break weeks
+				}
+			}
+		}
+	}
+
+	if len(occurrences) > MaxOccurrences {
+		return nil, ErrTooManyResults
+	}
+
+	result := occurrences[:0]
+	for _, occurrence := range occurrences {
+		if !excluded(occurrence, exdates) {
+			result = append(result, occurrence)
+		}
+	}
+	return result, nil
+}
+
+func excluded(t time.Time, exdates []time.Time) bool {
+	for _, exdate := range exdates {
+		if t.Equal(exdate) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package recurrence
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	rule, err := Parse("RRULE:FREQ=WEEKLY;INTERVAL=2;BYDAY=TU,TH;COUNT=4")
+	assert.NoError(t, err)
+	assert.Equal(t, Weekly, rule.Freq)
+	assert.Equal(t, 2, rule.Interval)
+	assert.Equal(t, 4, rule.Count)
+	assert.Equal(t, []time.Weekday{time.Tuesday, time.Thursday}, rule.ByDay)
+
+	_, err = Parse("FREQ=WEEKLY")
+	assert.ErrorIs(t, err, ErrNoBound)
+
+	_, err = Parse("FREQ=MONTHLY;COUNT=2")
+	assert.Error(t, err)
+
+	_, err = Parse("FREQ=DAILY;COUNT=2;UNTIL=20240701")
+	assert.Error(t, err)
+}
+
+func TestExpandWeekly(t *testing.T) {
+	// 2024-09-03 is a Tuesday.
+	start := time.Date(2024, 9, 3, 14, 0, 0, 0, time.UTC)
+	rule, err := Parse("FREQ=WEEKLY;COUNT=16")
+	assert.NoError(t, err)
+
+	occurrences, err := rule.Expand(start, []time.Time{start.AddDate(0, 0, 7)})
+	assert.NoError(t, err)
+	assert.Len(t, occurrences, 15)
+	assert.Equal(t, start, occurrences[0])
+	assert.Equal(t, start.AddDate(0, 0, 14), occurrences[1])
+	assert.Equal(t, start.AddDate(0, 0, 15*7), occurrences[14])
+}
+
+func TestExpandWeeklyByDay(t *testing.T) {
+	// Starts on a Wednesday, so Monday of the first week is skipped.
+	start := time.Date(2024, 9, 4, 9, 0, 0, 0, time.UTC)
+	rule, err := Parse("FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20240916")
+	assert.NoError(t, err)
+
+	occurrences, err := rule.Expand(start, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []time.Time{
+		time.Date(2024, 9, 4, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 9, 9, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 9, 11, 9, 0, 0, 0, time.UTC),
+		time.Date(2024, 9, 16, 9, 0, 0, 0, time.UTC),
+	}, occurrences)
+}
+
+func TestExpandDaily(t *testing.T) {
+	start := time.Date(2024, 9, 1, 8, 0, 0, 0, time.UTC)
+	rule, err := Parse("FREQ=DAILY;INTERVAL=3;UNTIL=20240910T080000Z")
+	assert.NoError(t, err)
+
+	occurrences, err := rule.Expand(start, nil)
+	assert.NoError(t, err)
+	assert.Len(t, occurrences, 4)
+	assert.Equal(t, time.Date(2024, 9, 10, 8, 0, 0, 0, time.UTC), occurrences[3])
+
+	rule, err = Parse("FREQ=DAILY;UNTIL=20300101")
+	assert.NoError(t, err)
+	_, err = rule.Expand(start, nil)
+	assert.ErrorIs(t, err, ErrTooManyResults)
+}
@@ -0,0 +1,159 @@
+package schedule
+
+import (
+	"sort"
+	"time"
+)
+
+// Interval is a half-open time range [Start, End).
+type Interval struct {
+	Start time.Time `json:"start_time"`
+	End   time.Time `json:"end_time"`
+}
+
+func (i Interval) Empty() bool {
+	return !i.End.After(i.Start)
+}
+
+func (i Interval) Duration() time.Duration {
+	if i.Empty() {
+		return 0
+	}
+	return i.End.Sub(i.Start)
+}
+
+// Overlaps reports whether the two intervals share any instant.
+func (i Interval) Overlaps(other Interval) bool {
+	return i.Start.Before(other.End) && other.Start.Before(i.End)
+}
+
+// Contains reports whether other lies entirely within i.
+func (i Interval) Contains(other Interval) bool {
+	return !other.Start.Before(i.Start) && !other.End.After(i.End)
+}
+
+// Clip returns the part of i that lies within window.
+func (i Interval) Clip(window Interval) Interval {
+	if i.Start.Before(window.Start) {
+		i.Start = window.Start
+	}
+	if i.End.After(window.End) {
+		i.End = window.End
+	}
+	return i
+}
+
+// Align widens the interval outwards to multiples of slot on the wall clock of
+// its time zone, so that hourly slots start on the hour even where the offset
+// from UTC is not a whole number of hours. A non-positive slot leaves the
+// interval unchanged.
+func (i Interval) Align(slot time.Duration) Interval {
+	if slot <= 0 {
+		return i
+	}
+	start := truncate(i.Start, slot)
+	end := truncate(i.End, slot)
+	if end.Before(i.End) {
+		end = end.Add(slot)
+	}
+	return Interval{Start: start, End: end}
+}
+
+// truncate rounds t down to a multiple of d on the wall clock of t's time
+// zone. time.Time.Truncate counts from the zero time in UTC instead.
+func truncate(t time.Time, d time.Duration) time.Time {
+	_, offset := t.Zone()
+	shift := time.Duration(offset) * time.Second
+	return t.Add(shift).Truncate(d).Add(-shift)
+}
+
+// In returns the interval with both ends expressed in loc.
+func (i Interval) In(loc *time.Location) Interval {
+	return Interval{Start: i.Start.In(loc), End: i.End.In(loc)}
+}
+
+// Merge sorts the intervals and joins the ones that overlap or touch. Empty
+// intervals are dropped.
+func Merge(intervals []Interval) []Interval {
+	sorted := make([]Interval, 0, len(intervals))
+	for _, interval := range intervals {
+		if !interval.Empty() {
+			sorted = append(sorted, interval)
+		}
+	}
+	sort.Slice(sorted, func(a, b int) bool {
+		return sorted[a].Start.Before(sorted[b].Start)
+	})
+
+	merged := make([]Interval, 0, len(sorted))
+	for _, interval := range sorted {
+		last := len(merged) - 1
+		if last >= 0 && !interval.Start.After(merged[last].End) {
+			if interval.End.After(merged[last].End) {
+				merged[last].End = interval.End
+			}
+			continue
+		}
+		merged = append(merged, interval)
+	}
+	return merged
+}
+
+// Free returns the gaps of window not covered by busy.
+func Free(window Interval, busy []Interval) []Interval {
+	free := make([]Interval, 0)
+	cursor := window.Start
+	for _, interval := range Merge(busy) {
+		interval = interval.Clip(window)
+		if interval.Empty() {
+			continue
+		}
+		if interval.Start.After(cursor) {
+			free = append(free, Interval{Start: cursor, End: interval.Start})
+		}
+		if interval.End.After(cursor) {
+			cursor = interval.End
+		}
+	}
+	if window.End.After(cursor) {
+		free = append(free, Interval{Start: cursor, End: window.End})
+	}
+	return free
+}
+
+// Build clips busy to window, aligns it to slot in the window's time zone and
+// returns the merged busy intervals together with the complementary free gaps.
+func Build(window Interval, busy []Interval, slot time.Duration) ([]Interval, []Interval) {
+	aligned := make([]Interval, 0, len(busy))
+	for _, interval := range busy {
+		interval = interval.In(window.Start.Location()).Align(slot).Clip(window)
+		if !interval.Empty() {
+			aligned = append(aligned, interval)
+		}
+	}
+	merged := Merge(aligned)
+	return merged, Free(window, merged)
+}
+
+// EarliestFit returns the earliest interval of the given duration that lies
+// within window without overlapping busy. Start times are rounded up to a
+// multiple of step on the wall clock of the window's time zone when step is
+// positive.
+func EarliestFit(window Interval, busy []Interval, duration, step time.Duration) (Interval, bool) {
+	if duration <= 0 {
+		return Interval{}, false
+	}
+
+	for _, gap := range Free(window, busy) {
+		start := gap.Start.In(window.Start.Location())
+		if step > 0 {
+			if rounded := truncate(start, step); rounded.Before(start) {
+				start = rounded.Add(step)
+			}
+		}
+		if end := start.Add(duration); !end.After(gap.End) {
+			return Interval{Start: start, End: end}, true
+		}
+	}
+	return Interval{}, false
+}
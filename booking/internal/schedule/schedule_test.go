@@ -0,0 +1,115 @@
+package schedule
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func at(hour, minute int) time.Time {
+	return time.Date(2024, 6, 1, hour, minute, 0, 0, time.UTC)
+}
+
+func TestMerge(t *testing.T) {
+	merged := Merge([]Interval{
+		{Start: at(12, 0), End: at(13, 0)},
+		{Start: at(10, 0), End: at(11, 0)},
+		{Start: at(11, 0), End: at(11, 30)},
+		{Start: at(12, 30), End: at(12, 45)},
+		{Start: at(15, 0), End: at(15, 0)},
+	})
+
+	assert.Equal(t, []Interval{
+		{Start: at(10, 0), End: at(11, 30)},
+		{Start: at(12, 0), End: at(13, 0)},
+	}, merged)
+}
+
+func TestFree(t *testing.T) {
+	window := Interval{Start: at(9, 0), End: at(18, 0)}
+	free := Free(window, []Interval{
+		{Start: at(8, 0), End: at(10, 0)},
+		{Start: at(12, 0), End: at(13, 0)},
+	})
+
+	assert.Equal(t, []Interval{
+		{Start: at(10, 0), End: at(12, 0)},
+		{Start: at(13, 0), End: at(18, 0)},
+	}, free)
+
+	assert.Empty(t, Free(window, []Interval{{Start: at(0, 0), End: at(23, 0)}}))
+}
+
+func TestBuildAlignsToSlot(t *testing.T) {
+	window := Interval{Start: at(9, 0), End: at(12, 0)}
+	busy, free := Build(window, []Interval{
+		{Start: at(9, 10), End: at(9, 40)},
+		{Start: at(10, 50), End: at(11, 5)},
+	}, 30*time.Minute)
+
+	assert.Equal(t, []Interval{
+		{Start: at(9, 0), End: at(10, 0)},
+		{Start: at(10, 30), End: at(11, 30)},
+	}, busy)
+	assert.Equal(t, []Interval{
+		{Start: at(10, 0), End: at(10, 30)},
+		{Start: at(11, 30), End: at(12, 0)},
+	}, free)
+}
+
+func TestOverlaps(t *testing.T) {
+	a := Interval{Start: at(10, 0), End: at(11, 0)}
+
+	assert.True(t, a.Overlaps(Interval{Start: at(10, 30), End: at(11, 30)}))
+	assert.False(t, a.Overlaps(Interval{Start: at(11, 0), End: at(12, 0)}))
+	assert.True(t, a.Contains(Interval{Start: at(10, 15), End: at(10, 45)}))
+}
+
+func TestEarliestFit(t *testing.T) {
+	window := Interval{Start: at(9, 0), End: at(18, 0)}
+	busy := []Interval{
+		{Start: at(9, 0), End: at(10, 10)},
+		{Start: at(11, 0), End: at(12, 0)},
+	}
+
+	fit, ok := EarliestFit(window, busy, 30*time.Minute, 0)
+	assert.True(t, ok)
+	assert.Equal(t, Interval{Start: at(10, 10), End: at(10, 40)}, fit)
+
+	fit, ok = EarliestFit(window, busy, 50*time.Minute, 15*time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, Interval{Start: at(12, 0), End: at(12, 50)}, fit)
+
+	fit, ok = EarliestFit(window, busy, 30*time.Minute, 15*time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, Interval{Start: at(10, 15), End: at(10, 45)}, fit)
+
+	_, ok = EarliestFit(window, busy, 7*time.Hour, 0)
+	assert.False(t, ok)
+}
+
+func TestAlignInLocalTime(t *testing.T) {
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	assert.NoError(t, err)
+	kathmandu, err := time.LoadLocation("Asia/Kathmandu")
+	assert.NoError(t, err)
+	local := func(loc *time.Location, hour, minute int) time.Time {
+		return time.Date(2024, 6, 1, hour, minute, 0, 0, loc)
+	}
+
+	// Hourly slots start on the local hour at +05:30 ...
+	aligned := Interval{Start: local(kolkata, 10, 10), End: local(kolkata, 10, 40)}.Align(time.Hour)
+	assert.True(t, aligned.Start.Equal(local(kolkata, 10, 0)))
+	assert.True(t, aligned.End.Equal(local(kolkata, 11, 0)))
+
+	// ... and half hour slots on the local half hour at +05:45.
+	aligned = Interval{Start: local(kathmandu, 10, 10), End: local(kathmandu, 10, 40)}.Align(30 * time.Minute)
+	assert.True(t, aligned.Start.Equal(local(kathmandu, 10, 0)))
+	assert.True(t, aligned.End.Equal(local(kathmandu, 11, 0)))
+
+	window := Interval{Start: local(kolkata, 9, 0), End: local(kolkata, 18, 0)}
+	busy := []Interval{Interval{Start: local(kolkata, 9, 0), End: local(kolkata, 10, 10)}.In(time.UTC)}
+	fit, ok := EarliestFit(window, busy, 30*time.Minute, time.Hour)
+	assert.True(t, ok)
+	assert.True(t, fit.Start.Equal(local(kolkata, 11, 0)))
+}
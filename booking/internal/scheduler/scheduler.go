@@ -0,0 +1,181 @@
+// Package scheduler runs periodic in-process jobs, each on its own interval
+// with optional random jitter, and keeps track of their last runs.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+type Logger interface {
+	Info(msg string)
+	Error(msg string)
+}
+
+type Job struct {
+	Name string
+	// Interval is the pause between the end of one run and the start of the
+	// next.
+	Interval time.Duration
+	// Jitter adds a random delay of up to this duration before each run so
+	// that replicas do not hit the database in lockstep.
+	Jitter time.Duration
+	Run    func(ctx context.Context, now time.Time) error
+}
+
+// JobStatus is the bookkeeping kept for each job.
+type JobStatus struct {
+	Name         string        `json:"name"`
+	Interval     time.Duration `json:"interval"`
+	Runs         int           `json:"runs"`
+	Failures     int           `json:"failures"`
+	LastRun      time.Time     `json:"last_run"`
+	LastDuration time.Duration `json:"last_duration"`
+	LastError    string        `json:"last_error,omitempty"`
+	NextRun      time.Time     `json:"next_run"`
+}
+
+type entry struct {
+	job    Job
+	status JobStatus
+}
+
+type Scheduler struct {
+	logger Logger
+
+	mu      sync.Mutex
+	entries []*entry
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+func New(logger Logger) *Scheduler {
+	return &Scheduler{logger: logger}
+}
+
+// Add registers a job. Jobs must be added before Start. It rejects jobs whose
+// interval is not positive, as they would run in a busy loop.
+func (s *Scheduler) Add(job Job) error {
+	if job.Interval <= 0 {
+		return fmt.Errorf("job %s: interval must be positive, got %s", job.Name, job.Interval)
+	}
+	if job.Jitter < 0 {
+		return fmt.Errorf("job %s: jitter must not be negative, got %s", job.Name, job.Jitter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, &entry{
+		job:    job,
+		status: JobStatus{Name: job.Name, Interval: job.Interval},
+	})
+	return nil
+}
+
+// Start launches every registered job in its own goroutine. The first run of
+// each job happens after one interval.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancel != nil {
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	for _, e := range s.entries {
+		s.wg.Add(1)
+		go s.loop(ctx, e)
+	}
+}
+
+// Stop cancels all jobs and waits for running ones to return.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return
+	}
+	cancel()
+	s.wg.Wait()
+}
+
+// Status returns a snapshot of every job's bookkeeping.
+func (s *Scheduler) Status() []JobStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make([]JobStatus, 0, len(s.entries))
+	for _, e := range s.entries {
+		statuses = append(statuses, e.status)
+	}
+	return statuses
+}
+
+func (s *Scheduler) loop(ctx context.Context, e *entry) {
+	defer s.wg.Done()
+
+	timer := time.NewTimer(s.schedule(e))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+			s.run(ctx, e)
+			timer.Reset(s.schedule(e))
+		}
+	}
+}
+
+// schedule picks the delay before the next run and records it.
+func (s *Scheduler) schedule(e *entry) time.Duration {
+	delay := e.job.Interval
+	if e.job.Jitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(e.job.Jitter)))
+	}
+
+	s.mu.Lock()
+	e.status.NextRun = time.Now().Add(delay)
+	s.mu.Unlock()
+	return delay
+}
+
+func (s *Scheduler) run(ctx context.Context, e *entry) {
+	start := time.Now()
+	err := safeRun(ctx, e.job, start)
+	duration := time.Since(start)
+
+	s.mu.Lock()
+	e.status.Runs++
+	e.status.LastRun = start
+	e.status.LastDuration = duration
+	e.status.LastError = ""
+	if err != nil {
+		e.status.Failures++
+		e.status.LastError = err.Error()
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.Error(fmt.Sprintf("Job %s failed: %s", e.job.Name, err))
+	}
+}
+
+// safeRun turns a panicking job into an error so one bad run does not take
+// the service down.
+func safeRun(ctx context.Context, job Job, now time.Time) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx, now)
+}
@@ -0,0 +1,98 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testLogger struct {
+	mu     sync.Mutex
+	errors []string
+}
+
+func (l *testLogger) Info(msg string) {}
+
+func (l *testLogger) Error(msg string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, msg)
+}
+
+func TestSchedulerRunsJobs(t *testing.T) {
+	logger := &testLogger{}
+	s := New(logger)
+
+	var ticks int32
+	s.Add(Job{
+		Name:     "tick",
+		Interval: 5 * time.Millisecond,
+		Jitter:   time.Millisecond,
+		Run: func(ctx context.Context, now time.Time) error {
+			atomic.AddInt32(&ticks, 1)
+			return nil
+		},
+	})
+	s.Add(Job{
+		Name:     "broken",
+		Interval: 5 * time.Millisecond,
+		Run: func(ctx context.Context, now time.Time) error {
+			return errors.New("boom")
+		},
+	})
+	s.Add(Job{
+		Name:     "panicky",
+		Interval: 5 * time.Millisecond,
+		Run: func(ctx context.Context, now time.Time) error {
+			panic("oops")
+		},
+	})
+
+	s.Start(context.Background())
+	time.Sleep(60 * time.Millisecond)
+	s.Stop()
+
+	after := atomic.LoadInt32(&ticks)
+	assert.Greater(t, after, int32(2))
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Equal(t, after, atomic.LoadInt32(&ticks))
+
+	statuses := s.Status()
+	assert.Len(t, statuses, 3)
+	assert.Equal(t, "tick", statuses[0].Name)
+	assert.Equal(t, int(after), statuses[0].Runs)
+	assert.Zero(t, statuses[0].Failures)
+	assert.False(t, statuses[0].LastRun.IsZero())
+
+	assert.Equal(t, statuses[1].Runs, statuses[1].Failures)
+	assert.Equal(t, "boom", statuses[1].LastError)
+	assert.Equal(t, "panic: oops", statuses[2].LastError)
+
+	logger.mu.Lock()
+	defer logger.mu.Unlock()
+	assert.NotEmpty(t, logger.errors)
+}
+
+func TestStopWithoutStart(t *testing.T) {
+	s := New(&testLogger{})
+	s.Stop()
+	assert.Empty(t, s.Status())
+}
+
+func TestAddRejectsInvalidJobs(t *testing.T) {
+	s := New(&testLogger{})
+	run := func(ctx context.Context, now time.Time) error { return nil }
+
+	assert.Error(t, s.Add(Job{Name: "unset", Run: run}))
+	assert.Error(t, s.Add(Job{Name: "negative", Interval: -time.Second, Run: run}))
+	assert.Error(t, s.Add(Job{Name: "jitter", Interval: time.Second, Jitter: -time.Second, Run: run}))
+	assert.Empty(t, s.Status())
+
+	assert.NoError(t, s.Add(Job{Name: "valid", Interval: time.Second, Run: run}))
+	assert.Len(t, s.Status(), 1)
+}
@@ -0,0 +1,144 @@
+// Package specs filters computers by predicates over their hardware specs,
+// such as "gpu=rtx*" or "ram_gb>=16".
+package specs
+
+import (
+	"booking/internal/models"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Operators in the order they are tried, so that ">=" is not read as ">".
+var operators = []string{"!=", ">=", "<=", "=", ">", "<"}
+
+var numericFields = map[string]func(*models.Computer) int{
+	"ram_gb": func(c *models.Computer) int { return c.RAMGB },
+}
+
+var textFields = map[string]func(*models.Computer) []string{
+	"cpu":        func(c *models.Computer) []string { return []string{c.CPU} },
+	"gpu":        func(c *models.Computer) []string { return []string{c.GPU} },
+	"monitor":    func(c *models.Computer) []string { return []string{c.Monitor} },
+	"peripheral": func(c *models.Computer) []string { return c.Peripherals },
+	"tag":        func(c *models.Computer) []string { return c.Tags },
+}
+
+// Predicate is a single comparison of a computer field against a value.
+// Text fields compare case-insensitively and accept shell-style globs; list
+// fields match when any element does.
+type Predicate struct {
+	Field string
+	Op    string
+	Value string
+
+	number int
+}
+
+// Parse reads a predicate of the form <field><op><value>.
+func Parse(expr string) (Predicate, error) {
+	for _, op := range operators {
+		i := strings.Index(expr, op)
+		if i <= 0 {
+			continue
+		}
+
+		p := Predicate{
+			Field: strings.ToLower(strings.TrimSpace(expr[:i])),
+			Op:    op,
+			Value: strings.TrimSpace(expr[i+len(op):]),
+		}
+		return p, p.validate()
+	}
+	return Predicate{}, fmt.Errorf("invalid spec %q", expr)
+}
+
+// ParseAll parses every expression, failing on the first invalid one.
+func ParseAll(exprs []string) ([]Predicate, error) {
+	predicates := make([]Predicate, 0, len(exprs))
+	for _, expr := range exprs {
+		p, err := Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		predicates = append(predicates, p)
+	}
+	return predicates, nil
+}
+
+func (p *Predicate) validate() error {
+	if _, ok := numericFields[p.Field]; ok {
+		number, err := strconv.Atoi(p.Value)
+		if err != nil {
+			return fmt.Errorf("spec %s needs a whole number", p.Field)
+		}
+		p.number = number
+		return nil
+	}
+
+	if _, ok := textFields[p.Field]; !ok {
+		return fmt.Errorf("unknown spec field %q", p.Field)
+	}
+	if p.Op != "=" && p.Op != "!=" {
+		return fmt.Errorf("spec %s only supports = and !=", p.Field)
+	}
+	p.Value = strings.ToLower(p.Value)
+	if _, err := path.Match(p.Value, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q", p.Value)
+	}
+	return nil
+}
+
+// Match reports whether the computer satisfies the predicate.
+func (p Predicate) Match(computer *models.Computer) bool {
+	if get, ok := numericFields[p.Field]; ok {
+		value := get(computer)
+		switch p.Op {
+		case "=":
+			return value == p.number
+		case "!=":
+			return value != p.number
+		case ">":
+			return value > p.number
+		case ">=":
+			return value >= p.number
+		case "<":
+			return value < p.number
+		case "<=":
+			return value <= p.number
+		}
+		return false
+	}
+
+	matched := false
+	for _, value := range textFields[p.Field](computer) {
+		if ok, _ := path.Match(p.Value, strings.ToLower(value)); ok {
+			matched = true
+			break
+		}
+	}
+	return matched == (p.Op == "=")
+}
+
+// Filter returns the computers that satisfy every predicate.
+func Filter(computers []models.Computer, predicates []Predicate) []models.Computer {
+	if len(predicates) == 0 {
+		return computers
+	}
+
+	filtered := make([]models.Computer, 0, len(computers))
+	for i := range computers {
+		ok := true
+		for _, p := range predicates {
+			if !p.Match(&computers[i]) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			filtered = append(filtered, computers[i])
+		}
+	}
+	return filtered
+}
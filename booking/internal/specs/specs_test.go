@@ -0,0 +1,53 @@
+package specs
+
+import (
+	"booking/internal/models"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	p, err := Parse("ram_gb>=16")
+	assert.NoError(t, err)
+	assert.Equal(t, "ram_gb", p.Field)
+	assert.Equal(t, ">=", p.Op)
+	assert.Equal(t, "16", p.Value)
+
+	p, err = Parse("GPU=RTX*")
+	assert.NoError(t, err)
+	assert.Equal(t, "gpu", p.Field)
+	assert.Equal(t, "rtx*", p.Value)
+
+	for _, expr := range []string{"", "gpu", "=rtx", "ram_gb>=lots", "gpu>rtx", "disk=ssd", "gpu=[rtx"} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	computers := []models.Computer{
+		{Number: 1, GPU: "RTX 4070", RAMGB: 32, Tags: models.StringList{"streaming"}},
+		{Number: 2, GPU: "GTX 1660", RAMGB: 16, Peripherals: models.StringList{"Wheel"}},
+		{Number: 3, RAMGB: 8},
+	}
+
+	numbers := func(exprs ...string) []int {
+		predicates, err := ParseAll(exprs)
+		assert.NoError(t, err)
+
+		var result []int
+		for _, c := range Filter(computers, predicates) {
+			result = append(result, c.Number)
+		}
+		return result
+	}
+
+	assert.Equal(t, []int{1, 2, 3}, numbers())
+	assert.Equal(t, []int{1}, numbers("gpu=rtx*"))
+	assert.Equal(t, []int{1, 2}, numbers("ram_gb>=16"))
+	assert.Equal(t, []int{2}, numbers("ram_gb>=16", "gpu!=rtx*"))
+	assert.Equal(t, []int{3}, numbers("ram_gb<16"))
+	assert.Equal(t, []int{1}, numbers("tag=streaming"))
+	assert.Equal(t, []int{2}, numbers("peripheral=wheel"))
+	assert.Equal(t, []int{2, 3}, numbers("tag!=streaming"))
+}